@@ -15,10 +15,11 @@ package config
 
 // Config contains configurations for tikv client.
 type Config struct {
-	RPC         RPC
-	Raw         Raw
-	Txn         Txn
-	RegionCache RegionCache
+	RPC         RPC         `toml:"rpc" json:"rpc"`
+	Raw         Raw         `toml:"raw" json:"raw"`
+	Txn         Txn         `toml:"txn" json:"txn"`
+	RegionCache RegionCache `toml:"region-cache" json:"region-cache"`
+	Retry       Retry       `toml:"retry" json:"retry"`
 }
 
 // Default returns the default config.
@@ -28,5 +29,6 @@ func Default() Config {
 		Raw:         DefaultRaw(),
 		Txn:         DefaultTxn(),
 		RegionCache: DefaultRegionCache(),
+		Retry:       DefaultRetry(),
 	}
 }
@@ -0,0 +1,291 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The keys of the fields in config files and environment variables are named
+// by the toml tags, like "region-cache" and "max-batch-size". Durations are
+// written as strings, like "100ms" or "1m30s".
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadFile loads the config from a TOML or YAML file, judged by the extension
+// of the file name. The fields that are not in the file keep the default
+// values. The config is not validated.
+func LoadFile(path string) (Config, error) {
+	conf := Default()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return conf, errors.WithStack(err)
+	}
+	var values map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		if _, err = toml.Decode(string(data), &values); err != nil {
+			return conf, errors.Wrapf(err, "parse %s", path)
+		}
+	case ".yaml", ".yml":
+		var raw map[interface{}]interface{}
+		if err = yaml.Unmarshal(data, &raw); err != nil {
+			return conf, errors.Wrapf(err, "parse %s", path)
+		}
+		values = normalizeYAML(raw)
+	default:
+		return conf, errors.Errorf("unknown config file type %q, should be .toml, .yaml or .yml", ext)
+	}
+	if err = setValue(reflect.ValueOf(&conf).Elem(), values, ""); err != nil {
+		return conf, errors.Wrapf(err, "load %s", path)
+	}
+	return conf, nil
+}
+
+// FromEnv loads the config from the environment variables. The name of a
+// variable is the prefix and the upper-cased path of the field joined by
+// underscores, like PREFIX_RPC_BATCH_MAX_BATCH_SIZE for rpc.batch.max-batch-size.
+// A list is written as comma separated items, and a map of scalars is written
+// as comma separated pairs, like
+// PREFIX_REGION_CACHE_LABELS="zone=z1,host=h1". Maps of structs, like
+// retry.policies, can only be set in files. The fields that are not set keep
+// the default values. The config is not validated.
+func FromEnv(prefix string) (Config, error) {
+	conf := Default()
+	err := setFromEnv(reflect.ValueOf(&conf).Elem(), strings.ToUpper(prefix), "")
+	return conf, err
+}
+
+func setFromEnv(v reflect.Value, name, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("toml")
+		if key == "-" {
+			continue
+		}
+		fieldName := name + "_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+		fieldPath := joinPath(path, key)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := setFromEnv(field, fieldName, fieldPath); err != nil {
+				return err
+			}
+			continue
+		}
+		env, ok := os.LookupEnv(fieldName)
+		if !ok {
+			continue
+		}
+		var raw interface{} = env
+		if field.Kind() == reflect.Slice {
+			var items []interface{}
+			for _, item := range strings.Split(env, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			raw = items
+		}
+		if field.Kind() == reflect.Map {
+			if field.Type().Elem().Kind() == reflect.Struct {
+				return errors.Errorf("%s: %s can not be set by environment variables", fieldName, fieldPath)
+			}
+			m := make(map[string]interface{})
+			for _, pair := range strings.Split(env, ",") {
+				if pair = strings.TrimSpace(pair); pair == "" {
+					continue
+				}
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 {
+					return errors.Errorf("%s: %s: invalid pair %q, should be key=value", fieldName, fieldPath, pair)
+				}
+				m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+			raw = m
+		}
+		if err := setValue(field, raw, fieldPath); err != nil {
+			return errors.WithMessage(err, fieldName)
+		}
+	}
+	return nil
+}
+
+// setValue sets v to the raw value decoded from a file or read from the
+// environment. The fields of structs and the entries of maps not in raw are
+// not changed.
+func setValue(v reflect.Value, raw interface{}, path string) error {
+	if v.Type() == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return errors.Errorf("%s: invalid duration %v, should be a string like \"1s\"", path, raw)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.Errorf("%s: invalid duration %q", path, s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be a table", path)
+		}
+		fields := make(map[string]int)
+		for i := 0; i < v.NumField(); i++ {
+			if key := v.Type().Field(i).Tag.Get("toml"); key != "-" {
+				fields[key] = i
+			}
+		}
+		for key, value := range m {
+			i, ok := fields[key]
+			if !ok {
+				return errors.Errorf("%s: unknown field", joinPath(path, key))
+			}
+			if err := setValue(v.Field(i), value, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be a table", path)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for key, value := range m {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if old := v.MapIndex(reflect.ValueOf(key)); old.IsValid() {
+				elem.Set(old)
+			}
+			if err := setValue(elem, value, joinPath(path, key)); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be a list", path)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return errors.Errorf("%s: invalid string %v", path, raw)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		switch b := raw.(type) {
+		case bool:
+			v.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return errors.Errorf("%s: invalid bool %q", path, b)
+			}
+			v.SetBool(parsed)
+		default:
+			return errors.Errorf("%s: invalid bool %v", path, raw)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt(raw)
+		if !ok || v.OverflowInt(n) {
+			return errors.Errorf("%s: invalid integer %v", path, raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := toInt(raw)
+		if !ok || n < 0 || v.OverflowUint(uint64(n)) {
+			return errors.Errorf("%s: invalid unsigned integer %v", path, raw)
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := toFloat(raw)
+		if !ok {
+			return errors.Errorf("%s: invalid number %v", path, raw)
+		}
+		v.SetFloat(n)
+	default:
+		return errors.Errorf("%s: unsupported type %v", path, v.Type())
+	}
+	return nil
+}
+
+func toInt(raw interface{}) (int64, bool) {
+	switch n := raw.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat(raw interface{}) (float64, bool) {
+	switch n := raw.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// normalizeYAML converts the maps decoded by yaml to map[string]interface{},
+// which is what toml decodes to.
+func normalizeYAML(raw map[interface{}]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		if sub, ok := v.(map[interface{}]interface{}); ok {
+			v = normalizeYAML(sub)
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/pingcap/check"
+	// Register the gzip compressor, which is registered by the rpc package.
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testLoadSuite struct{}
+
+var _ = Suite(&testLoadSuite{})
+
+// checkGolden compares the data with the golden file in testdata.
+func checkGolden(c *C, name string, data []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		c.Assert(ioutil.WriteFile(path, data, 0644), IsNil)
+	}
+	expected, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, string(expected))
+}
+
+func dumpConfig(c *C, conf Config) []byte {
+	data, err := json.MarshalIndent(conf, "", "  ")
+	c.Assert(err, IsNil)
+	return append(data, '\n')
+}
+
+func (s *testLoadSuite) TestLoadFile(c *C) {
+	for _, name := range []string{"full.toml", "full.yaml"} {
+		conf, err := LoadFile(filepath.Join("testdata", name))
+		c.Assert(err, IsNil, Commentf("%s", name))
+		c.Assert(conf.Validate(), IsNil)
+		checkGolden(c, "full.golden.json", dumpConfig(c, conf))
+	}
+}
+
+func (s *testLoadSuite) TestLoadFileErrors(c *C) {
+	dir, err := ioutil.TempDir("", "config")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	for content, expected := range map[string]string{
+		"[rpc]\nunknown = 1\n":                                ".*rpc.unknown: unknown field",
+		"[rpc]\ndial-timeout = 3\n":                           ".*rpc.dial-timeout: invalid duration 3.*",
+		"[rpc]\ndial-timeout = \"3\"\n":                       ".*rpc.dial-timeout: invalid duration \"3\"",
+		"[rpc]\nmax-connection-count = -1\n":                  ".*rpc.max-connection-count: invalid unsigned integer -1",
+		"[rpc.batch]\nadaptive = \"maybe\"\n":                 ".*rpc.batch.adaptive: invalid bool \"maybe\"",
+		"[rpc.grpc-initial-conn-window-size]\n":               ".*rpc.grpc-initial-conn-window-size: invalid integer.*",
+		"[rpc]\ngrpc-initial-conn-window-size = 4294967296\n": ".*rpc.grpc-initial-conn-window-size: invalid integer 4294967296",
+		"[rpc.security]\nallowed-sans = \"tikv\"\n":           ".*rpc.security.allowed-sans: should be a list",
+		"[rpc.security]\nallowed-sans = [1]\n":                ".*rpc.security.allowed-sans\\[0\\]: invalid string 1",
+	} {
+		path := filepath.Join(dir, "config.toml")
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+		_, err = LoadFile(path)
+		c.Assert(err, ErrorMatches, expected)
+	}
+
+	_, err = LoadFile(filepath.Join(dir, "config.json"))
+	c.Assert(err, ErrorMatches, ".*no such file.*")
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0644), IsNil)
+	_, err = LoadFile(filepath.Join(dir, "config.json"))
+	c.Assert(err, ErrorMatches, "unknown config file type \".json\".*")
+}
+
+func (s *testLoadSuite) TestFromEnv(c *C) {
+	env := map[string]string{
+		"TIKV_RPC_MAX_CONNECTION_COUNT":          "4",
+		"TIKV_RPC_BATCH_MAX_WAIT_TIME":           "1ms",
+		"TIKV_RPC_HEDGE_ENABLE":                  "true",
+		"TIKV_RPC_HEDGE_PERCENTILE":              "0.99",
+		"TIKV_RPC_SECURITY_SSL_CA":               "/etc/tikv/ca.pem",
+		"TIKV_RPC_SECURITY_ALLOWED_SANS":         "tikv.example.com, 10.0.0.1",
+		"TIKV_RAW_MAX_SCAN_LIMIT":                "1024",
+		"TIKV_TXN_MAX_LOCK_TTL":                  "60000",
+		"TIKV_TXN_LATCH_EXPIRE_DURATION":         "1m30s",
+		"TIKV_REGION_CACHE_BTREE_DEGREE":         "16",
+		"TIKV_REGION_CACHE_LABELS":               "zone=z1, host=h1",
+		"TIKV_RETRY_BUDGETS":                     "get=5s,commit=1m",
+		"TIKV_REGION_CACHE_STORE_DOWN_COOL_DOWN": "2s",
+	}
+	for k, v := range env {
+		c.Assert(os.Setenv(k, v), IsNil)
+	}
+	defer func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}()
+
+	conf, err := FromEnv("tikv")
+	c.Assert(err, IsNil)
+	c.Assert(conf.Validate(), IsNil)
+	checkGolden(c, "env.golden.json", dumpConfig(c, conf))
+
+	os.Setenv("TIKV_RPC_DIAL_TIMEOUT", "soon")
+	defer os.Unsetenv("TIKV_RPC_DIAL_TIMEOUT")
+	_, err = FromEnv("tikv")
+	c.Assert(err, ErrorMatches, "TIKV_RPC_DIAL_TIMEOUT: rpc.dial-timeout: invalid duration \"soon\"")
+}
+
+func (s *testLoadSuite) TestValidate(c *C) {
+	conf, err := LoadFile(filepath.Join("testdata", "invalid.toml"))
+	c.Assert(err, IsNil)
+	err = conf.Validate()
+	c.Assert(err, NotNil)
+	checkGolden(c, "invalid.golden", []byte(err.Error()+"\n"))
+
+	conf = Default()
+	c.Assert(conf.Validate(), IsNil)
+	conf.Txn.Latch.ListCount = 0
+	c.Assert(conf.Validate(), IsNil)
+	conf.Txn.Latch.Enable = true
+	c.Assert(conf.Validate(), ErrorMatches, "invalid config:\ntxn.latch.list-count: 0 should be positive")
+}
+
+// TestTags makes sure that every field can be loaded.
+func (s *testLoadSuite) TestTags(c *C) {
+	var check func(t reflect.Type, path string)
+	check = func(t reflect.Type, path string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("toml")
+			c.Assert(tag, Not(Equals), "", Commentf("%s.%s has no toml tag", path, f.Name))
+			c.Assert(f.Tag.Get("json"), Equals, tag)
+			if f.Type.Kind() == reflect.Struct {
+				check(f.Type, path+"."+tag)
+			}
+		}
+	}
+	check(reflect.TypeOf(Config{}), "config")
+}
@@ -16,13 +16,13 @@ package config
 // Raw is rawkv configurations.
 type Raw struct {
 	// MaxScanLimit is the maximum scan limit for rawkv Scan.
-	MaxScanLimit int
+	MaxScanLimit int `toml:"max-scan-limit" json:"max-scan-limit"`
 
 	// MaxBatchPutSize is the maximum size limit for rawkv each batch put request.
-	MaxBatchPutSize int
+	MaxBatchPutSize int `toml:"max-batch-put-size" json:"max-batch-put-size"`
 
 	// BatchPairCount is the maximum limit for rawkv each batch get/delete request.
-	BatchPairCount int
+	BatchPairCount int `toml:"batch-pair-count" json:"batch-pair-count"`
 }
 
 // DefaultRaw returns default rawkv configuration.
@@ -17,14 +17,35 @@ import "time"
 
 // RegionCache contains the configurations for region cache.
 type RegionCache struct {
-	BTreeDegree int
-	CacheTTL    time.Duration
+	BTreeDegree int           `toml:"btree-degree" json:"btree-degree"`
+	CacheTTL    time.Duration `toml:"cache-ttl" json:"cache-ttl"`
+	// Labels are the labels of the client, such as {"zone": "z1"}. Follower
+	// reads prefer the replicas on stores that have all these labels.
+	Labels map[string]string `toml:"labels" json:"labels"`
+	// ScanRegionsLimit is the number of regions loaded from PD in one batch.
+	ScanRegionsLimit int `toml:"scan-regions-limit" json:"scan-regions-limit"`
+	// Warmup loads all the regions in batch when the client starts.
+	Warmup bool `toml:"warmup" json:"warmup"`
+	// StoreFailureThreshold is the number of consecutive failures after which
+	// a store is marked down.
+	StoreFailureThreshold int `toml:"store-failure-threshold" json:"store-failure-threshold"`
+	// StoreDownCoolDown is how long requests are not sent to a down store,
+	// before a trial request is let through.
+	StoreDownCoolDown time.Duration `toml:"store-down-cool-down" json:"store-down-cool-down"`
+	// StoreProbeInterval is the interval to probe the stores that are not
+	// healthy. Set 0 to disable probing.
+	StoreProbeInterval time.Duration `toml:"store-probe-interval" json:"store-probe-interval"`
 }
 
 // DefaultRegionCache returns the default region cache config.
 func DefaultRegionCache() RegionCache {
 	return RegionCache{
-		BTreeDegree: 32,
-		CacheTTL:    10 * time.Minute,
+		BTreeDegree:      32,
+		CacheTTL:         10 * time.Minute,
+		ScanRegionsLimit: 128,
+
+		StoreFailureThreshold: 3,
+		StoreDownCoolDown:     5 * time.Second,
+		StoreProbeInterval:    time.Second,
 	}
 }
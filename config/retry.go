@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "time"
+
+// Jitter strategies of BackoffPolicy.
+const (
+	// JitterNone makes the backoff sequence strict exponential.
+	JitterNone = "none"
+	// JitterFull applies random factors to strict exponential.
+	JitterFull = "full"
+	// JitterEqual is also randomized, but prevents very short sleeps.
+	JitterEqual = "equal"
+	// JitterDecorr increases the maximum jitter based on the last random value.
+	JitterDecorr = "decorr"
+)
+
+// BackoffPolicy is the exponential backoff policy for a type of error.
+type BackoffPolicy struct {
+	// Base is the sleep time of the first retry.
+	Base time.Duration `toml:"base" json:"base"`
+	// Cap is the max sleep time of a retry.
+	Cap time.Duration `toml:"cap" json:"cap"`
+	// Jitter is the jitter strategy, one of JitterNone, JitterFull,
+	// JitterEqual and JitterDecorr.
+	Jitter string `toml:"jitter" json:"jitter"`
+}
+
+// Retry contains configurations for retrying failed requests.
+type Retry struct {
+	// Policies are the backoff policies keyed by the names of the backoff
+	// types, like "tikvRPC" and "regionMiss".
+	Policies map[string]BackoffPolicy `toml:"policies" json:"policies"`
+	// Budgets are the max total sleep time of the retries of an operation,
+	// keyed by the names of the operations, like "get" and "commit".
+	Budgets map[string]time.Duration `toml:"budgets" json:"budgets"`
+}
+
+// DefaultRetry returns the default Retry config.
+func DefaultRetry() Retry {
+	return Retry{
+		Policies: map[string]BackoffPolicy{
+			"tikvRPC":     {Base: 100 * time.Millisecond, Cap: 2 * time.Second, Jitter: JitterEqual},
+			"txnLock":     {Base: 200 * time.Millisecond, Cap: 3 * time.Second, Jitter: JitterEqual},
+			"txnLockFast": {Base: 50 * time.Millisecond, Cap: 3 * time.Second, Jitter: JitterEqual},
+			"pdRPC":       {Base: 500 * time.Millisecond, Cap: 3 * time.Second, Jitter: JitterEqual},
+			// The base time is 2ms, because it may recover soon.
+			"regionMiss":   {Base: 2 * time.Millisecond, Cap: 500 * time.Millisecond, Jitter: JitterNone},
+			"updateLeader": {Base: 1 * time.Millisecond, Cap: 10 * time.Millisecond, Jitter: JitterNone},
+			"serverBusy":   {Base: 2 * time.Second, Cap: 10 * time.Second, Jitter: JitterEqual},
+		},
+		Budgets: map[string]time.Duration{
+			"copBuildTask":            5 * time.Second,
+			"tso":                     15 * time.Second,
+			"scannerNext":             20 * time.Second,
+			"batchGet":                20 * time.Second,
+			"copNext":                 20 * time.Second,
+			"get":                     20 * time.Second,
+			"prewrite":                20 * time.Second,
+			"cleanup":                 20 * time.Second,
+			"commit":                  41 * time.Second,
+			"gcOneRegion":             20 * time.Second,
+			"gcResolveLock":           100 * time.Second,
+			"deleteRangeOneRegion":    100 * time.Second,
+			"rawkv":                   20 * time.Second,
+			"splitRegion":             20 * time.Second,
+			"waitScatterRegionFinish": 120 * time.Second,
+			"warmupRegionCache":       20 * time.Second,
+		},
+	}
+}
+
+// Budget returns the budget of the operation, and whether it is configured.
+func (r *Retry) Budget(op string) (time.Duration, bool) {
+	if r == nil {
+		return 0, false
+	}
+	budget, ok := r.Budgets[op]
+	return budget, ok
+}
@@ -15,61 +15,66 @@ package config
 
 import (
 	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // RPC configurations.
 type RPC struct {
 	// MaxConnectionCount is the max gRPC connections that will be established with
 	// each tikv-server.
-	MaxConnectionCount uint
+	MaxConnectionCount uint `toml:"max-connection-count" json:"max-connection-count"`
 
 	// GrpcKeepAliveTime is the duration of time after which if the client doesn't see
 	// any activity it pings the server to see if the transport is still alive.
-	GrpcKeepAliveTime time.Duration
+	GrpcKeepAliveTime time.Duration `toml:"grpc-keep-alive-time" json:"grpc-keep-alive-time"`
 
 	// GrpcKeepAliveTimeout is the duration of time for which the client waits after having
 	// pinged for keepalive check and if no activity is seen even after that the connection
 	// is closed.
-	GrpcKeepAliveTimeout time.Duration
+	GrpcKeepAliveTimeout time.Duration `toml:"grpc-keep-alive-timeout" json:"grpc-keep-alive-timeout"`
 
 	// GrpcMaxSendMsgSize set max gRPC request message size sent to server. If any request message size is larger than
 	// current value, an error will be reported from gRPC.
-	GrpcMaxSendMsgSize int
+	GrpcMaxSendMsgSize int `toml:"grpc-max-send-msg-size" json:"grpc-max-send-msg-size"`
 
 	// GrpcMaxCallMsgSize set max gRPC receive message size received from server. If any message size is larger than
 	// current value, an error will be reported from gRPC.
-	GrpcMaxCallMsgSize int
+	GrpcMaxCallMsgSize int `toml:"grpc-max-call-msg-size" json:"grpc-max-call-msg-size"`
 
 	// The value for initial window size on a gRPC stream.
-	GrpcInitialWindowSize int
+	GrpcInitialWindowSize int `toml:"grpc-initial-window-size" json:"grpc-initial-window-size"`
 
 	// The value for initial windows size on a gRPC connection.
-	GrpcInitialConnWindowSize int32
+	GrpcInitialConnWindowSize int32 `toml:"grpc-initial-conn-window-size" json:"grpc-initial-conn-window-size"`
 
 	// The max time to establish a gRPC connection.
-	DialTimeout time.Duration
+	DialTimeout time.Duration `toml:"dial-timeout" json:"dial-timeout"`
 
 	// For requests that read/write several key-values.
-	ReadTimeoutShort time.Duration
+	ReadTimeoutShort time.Duration `toml:"read-timeout-short" json:"read-timeout-short"`
 
 	// For requests that may need scan region.
-	ReadTimeoutMedium time.Duration
+	ReadTimeoutMedium time.Duration `toml:"read-timeout-medium" json:"read-timeout-medium"`
 
 	// For requests that may need scan region multiple times.
-	ReadTimeoutLong time.Duration
+	ReadTimeoutLong time.Duration `toml:"read-timeout-long" json:"read-timeout-long"`
 
 	// The flag to enable open tracing.
-	EnableOpenTracing bool
+	EnableOpenTracing bool `toml:"enable-open-tracing" json:"enable-open-tracing"`
 
 	// Batch system configurations.
-	Batch Batch
+	Batch Batch `toml:"batch" json:"batch"`
+
+	// Hedged read configurations.
+	Hedge Hedge `toml:"hedge" json:"hedge"`
+
+	// Retry budget configurations.
+	RetryBudget RetryBudget `toml:"retry-budget" json:"retry-budget"`
 
-	Security Security
+	// Compression of the requests.
+	Compression Compression `toml:"compression" json:"compression"`
+
+	Security Security `toml:"security" json:"security"`
 }
 
 // DefaultRPC returns the default RPC config.
@@ -88,8 +93,74 @@ func DefaultRPC() RPC {
 		ReadTimeoutLong:           150 * time.Second,
 		EnableOpenTracing:         false,
 
-		Batch:    DefaultBatch(),
-		Security: DefaultSecurity(),
+		Batch:       DefaultBatch(),
+		Hedge:       DefaultHedge(),
+		RetryBudget: DefaultRetryBudget(),
+		Compression: DefaultCompression(),
+		Security:    DefaultSecurity(),
+	}
+}
+
+// Hedge contains configurations for hedged reads. A hedged read is a follower
+// read sent to another replica when the first read is slow.
+type Hedge struct {
+	// Enable enables hedged reads for Get requests.
+	Enable bool `toml:"enable" json:"enable"`
+
+	// Percentile is the percentile of the latency of a store, after which the
+	// hedged read is sent.
+	Percentile float64 `toml:"percentile" json:"percentile"`
+
+	// MinDelay and MaxDelay limit the time to wait before sending the hedged
+	// read. MaxDelay is used for stores without latency samples.
+	MinDelay time.Duration `toml:"min-delay" json:"min-delay"`
+	MaxDelay time.Duration `toml:"max-delay" json:"max-delay"`
+
+	// BudgetRatio is the max ratio of hedged reads to all the reads, so that
+	// hedging does not double the load when stores are slow.
+	BudgetRatio float64 `toml:"budget-ratio" json:"budget-ratio"`
+}
+
+// DefaultHedge returns the default Hedge config.
+func DefaultHedge() Hedge {
+	return Hedge{
+		Enable:      false,
+		Percentile:  0.95,
+		MinDelay:    5 * time.Millisecond,
+		MaxDelay:    500 * time.Millisecond,
+		BudgetRatio: 0.05,
+	}
+}
+
+// RetryBudget contains configurations for the retry budget, which limits the
+// retries of a client with token buckets. When the stores are in trouble,
+// retries over the budget fail fast instead of multiplying the load.
+type RetryBudget struct {
+	// Enable enables the retry budget. It is disabled by default, set
+	// rpc.retry-budget.enable to true in the config file, or
+	// <PREFIX>_RPC_RETRY_BUDGET_ENABLE to true for FromEnv, to turn it on.
+	Enable bool `toml:"enable" json:"enable"`
+
+	// ClientBurst and ClientRate are the max retries at once and the retries
+	// per second of all the requests of a client. Only the retries after
+	// store failures are counted, the retries waiting for locks or PD are not.
+	ClientBurst int     `toml:"client-burst" json:"client-burst"`
+	ClientRate  float64 `toml:"client-rate" json:"client-rate"`
+
+	// StoreBurst and StoreRate are the max retries at once and the retries
+	// per second of the requests that fail to be sent to a store.
+	StoreBurst int     `toml:"store-burst" json:"store-burst"`
+	StoreRate  float64 `toml:"store-rate" json:"store-rate"`
+}
+
+// DefaultRetryBudget returns the default RetryBudget config.
+func DefaultRetryBudget() RetryBudget {
+	return RetryBudget{
+		Enable:      false,
+		ClientBurst: 1000,
+		ClientRate:  200,
+		StoreBurst:  100,
+		StoreRate:   20,
 	}
 }
 
@@ -97,17 +168,24 @@ func DefaultRPC() RPC {
 type Batch struct {
 	// MaxBatchSize is the max batch size when calling batch commands API. Set 0 to
 	// turn off message batch.
-	MaxBatchSize uint
+	MaxBatchSize uint `toml:"max-batch-size" json:"max-batch-size"`
 
 	// OverloadThreshold is a threshold of TiKV load. If TiKV load is greater than
 	// this, TiDB will wait for a while to avoid little batch.
-	OverloadThreshold uint
+	OverloadThreshold uint `toml:"overload-threshold" json:"overload-threshold"`
 
 	// MaxWaitSize is the max wait size for batch.
-	MaxWaitSize uint
+	MaxWaitSize uint `toml:"max-wait-size" json:"max-wait-size"`
+
+	// MaxWaitTime  is the max wait time for batch. Set 0 to never wait.
+	MaxWaitTime time.Duration `toml:"max-wait-time" json:"max-wait-time"`
 
-	// MaxWaitTime  is the max wait time for batch.
-	MaxWaitTime time.Duration
+	// Adaptive makes the wait time and size depend on how busy the store is,
+	// judging by the TiKV load and the number of requests in flight. If it is
+	// false, the batch waits MaxWaitTime for MaxWaitSize requests when TiKV load
+	// is greater than OverloadThreshold. The waiting only takes effect when
+	// message batch is turned on by MaxBatchSize.
+	Adaptive bool `toml:"adaptive" json:"adaptive"`
 }
 
 // DefaultBatch returns the default Batch config.
@@ -116,7 +194,30 @@ func DefaultBatch() Batch {
 		MaxBatchSize:      0,
 		OverloadThreshold: 200,
 		MaxWaitSize:       8,
-		MaxWaitTime:       0,
+		MaxWaitTime:       2 * time.Millisecond,
+		Adaptive:          true,
+	}
+}
+
+// Compression contains configurations for the gRPC compression of the
+// requests. Only the requests of the listed command types are compressed, so
+// the small requests like point gets do not pay for it.
+type Compression struct {
+	// Compressor is the name of the gRPC compressor, "gzip" or the name of a
+	// compressor registered by google.golang.org/grpc/encoding. "gzip" is
+	// registered by the rpc package. The requests are not compressed if it is
+	// empty.
+	Compressor string `toml:"compressor" json:"compressor"`
+	// Commands are the types of the compressed requests, like "RawBatchPut"
+	// and "Prewrite". The compressed requests are not sent in batch commands.
+	Commands []string `toml:"commands" json:"commands"`
+}
+
+// DefaultCompression returns the default Compression config, which does not
+// compress the requests.
+func DefaultCompression() Compression {
+	return Compression{
+		Commands: []string{"RawBatchPut", "Prewrite"},
 	}
 }
 
@@ -125,41 +226,58 @@ type Security struct {
 	SSLCA   string `toml:"ssl-ca" json:"ssl-ca"`
 	SSLCert string `toml:"ssl-cert" json:"ssl-cert"`
 	SSLKey  string `toml:"ssl-key" json:"ssl-key"`
+
+	// SSLCAPEM, SSLCertPEM and SSLKeyPEM are the PEM encoded CA, cert and key.
+	// They are used instead of the files if they are set. The PD client only
+	// supports the files, so they can not be used with PD.
+	SSLCAPEM   string `toml:"ssl-ca-pem" json:"ssl-ca-pem"`
+	SSLCertPEM string `toml:"ssl-cert-pem" json:"ssl-cert-pem"`
+	SSLKeyPEM  string `toml:"ssl-key-pem" json:"ssl-key-pem"`
+
+	// AllowedCommonNames and AllowedSANs restrict the identities of the
+	// servers. If any of them is set, a server certificate is accepted only if
+	// its common name is in AllowedCommonNames, or one of its DNS names, IP
+	// addresses, URIs and email addresses is in AllowedSANs. They are not
+	// applied to the connections to PD.
+	AllowedCommonNames []string `toml:"allowed-common-names" json:"allowed-common-names"`
+	AllowedSANs        []string `toml:"allowed-sans" json:"allowed-sans"`
+
+	// MinVersion is the minimum TLS version, one of "1.0", "1.1", "1.2" and
+	// "1.3". The default of crypto/tls is used if it is empty.
+	MinVersion string `toml:"min-version" json:"min-version"`
+	// CipherSuites are the names of the cipher suites used by TLS 1.2 and
+	// below, like "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". The defaults of
+	// crypto/tls are used if it is empty.
+	CipherSuites []string `toml:"cipher-suites" json:"cipher-suites"`
+
+	// CredentialProvider provides the CA and the client certificate, e.g.
+	// from a secret store. The files and the PEMs are not used if it is set.
+	// It can only be set in code, and can not be used with PD.
+	CredentialProvider CredentialProvider `toml:"-" json:"-"`
+}
+
+// Enabled returns whether TLS is used to connect to the servers.
+func (s *Security) Enabled() bool {
+	return len(s.SSLCA) != 0 || len(s.SSLCAPEM) != 0 || s.CredentialProvider != nil
 }
 
 // ToTLSConfig generates tls's config based on security section of the config.
+// It returns nil if TLS is not enabled. The CA, cert and key files are
+// watched, and the rotated certificates are used by the handshakes after the
+// rotation.
 func (s *Security) ToTLSConfig() (*tls.Config, error) {
-	var tlsConfig *tls.Config
-	if len(s.SSLCA) != 0 {
-		var certificates = make([]tls.Certificate, 0)
-		if len(s.SSLCert) != 0 && len(s.SSLKey) != 0 {
-			// Load the client certificates from disk
-			certificate, err := tls.LoadX509KeyPair(s.SSLCert, s.SSLKey)
-			if err != nil {
-				return nil, errors.Errorf("could not load client key pair: %s", err)
-			}
-			certificates = append(certificates, certificate)
-		}
-
-		// Create a certificate pool from the certificate authority
-		certPool := x509.NewCertPool()
-		ca, err := ioutil.ReadFile(s.SSLCA)
+	if !s.Enabled() {
+		return nil, nil
+	}
+	provider := s.CredentialProvider
+	if provider == nil {
+		r, err := newCertReloader(*s)
 		if err != nil {
-			return nil, errors.Errorf("could not read ca certificate: %s", err)
-		}
-
-		// Append the certificates from the CA
-		if !certPool.AppendCertsFromPEM(ca) {
-			return nil, errors.New("failed to append ca certs")
-		}
-
-		tlsConfig = &tls.Config{
-			Certificates: certificates,
-			RootCAs:      certPool,
+			return nil, err
 		}
+		provider = r
 	}
-
-	return tlsConfig, nil
+	return newTLSVerifier(s, provider).tlsConfig()
 }
 
 // DefaultSecurity returns the default Security config.
@@ -0,0 +1,333 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// CredentialProvider provides the TLS credentials to connect to the servers.
+// The methods are called on every TLS handshake, so the implementations
+// should cache the credentials, and they can rotate the credentials by
+// returning the new ones.
+type CredentialProvider interface {
+	// RootCAs returns the CAs to verify the server certificates.
+	RootCAs() (*x509.CertPool, error)
+	// ClientCertificate returns the client certificate. It returns nil if no
+	// client certificate is used.
+	ClientCertificate() (*tls.Certificate, error)
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, errors.Errorf("unknown tls version %q, should be one of \"1.0\", \"1.1\", \"1.2\" and \"1.3\"", version)
+	}
+	return v, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, errors.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// tlsVerifier verifies the servers with the credentials from a provider and
+// the identity restrictions of a Security config.
+type tlsVerifier struct {
+	sec      *Security
+	provider CredentialProvider
+	allowed  map[string]struct{}
+}
+
+func newTLSVerifier(sec *Security, provider CredentialProvider) *tlsVerifier {
+	v := &tlsVerifier{sec: sec, provider: provider}
+	if len(sec.AllowedCommonNames) > 0 || len(sec.AllowedSANs) > 0 {
+		v.allowed = make(map[string]struct{})
+		for _, name := range sec.AllowedCommonNames {
+			v.allowed["CN:"+name] = struct{}{}
+		}
+		for _, name := range sec.AllowedSANs {
+			v.allowed["SAN:"+name] = struct{}{}
+		}
+	}
+	return v
+}
+
+func (v *tlsVerifier) tlsConfig() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(v.sec.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(v.sec.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := v.provider.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs: pool,
+		// The server certificates are verified by verifyConnection with the
+		// CAs from the provider.
+		InsecureSkipVerify:   true,
+		VerifyConnection:     v.verifyConnection,
+		GetClientCertificate: v.getClientCertificate,
+		MinVersion:           minVersion,
+		CipherSuites:         cipherSuites,
+	}, nil
+}
+
+func (v *tlsVerifier) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := v.provider.ClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		// An empty certificate means that no certificate is sent.
+		return &tls.Certificate{}, nil
+	}
+	return cert, nil
+}
+
+// verifyConnection verifies the server certificates with the current CAs, the
+// same as the default verification of crypto/tls, and then checks the identity
+// of the server. It is used instead of VerifyPeerCertificate because the
+// server name is needed to verify the host. Without a server name, the host
+// can not be verified, so the handshake fails unless the identity is
+// restricted by the allowed names.
+func (v *tlsVerifier) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+	if cs.ServerName == "" && v.allowed == nil {
+		return errors.New("no server name to verify the server certificate")
+	}
+	pool, err := v.provider.RootCAs()
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	leaf := cs.PeerCertificates[0]
+	if _, err = leaf.Verify(opts); err != nil {
+		return errors.WithStack(err)
+	}
+	return v.checkIdentity(leaf)
+}
+
+func (v *tlsVerifier) checkIdentity(cert *x509.Certificate) error {
+	if v.allowed == nil {
+		return nil
+	}
+	names := []string{"CN:" + cert.Subject.CommonName}
+	for _, name := range cert.DNSNames {
+		names = append(names, "SAN:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "SAN:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "SAN:"+uri.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		names = append(names, "SAN:"+email)
+	}
+	for _, name := range names {
+		if _, ok := v.allowed[name]; ok {
+			return nil
+		}
+	}
+	return errors.Errorf("server identity is not allowed, names: %v", names)
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, errors.WithStack(err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// readPEM returns the PEM if it is set, otherwise it reads the file. The
+// stamp of the file is returned to detect the changes, it is zero for a PEM.
+func readPEM(pem, path string) ([]byte, fileStamp, error) {
+	if len(pem) != 0 {
+		return []byte(pem), fileStamp{}, nil
+	}
+	stamp, err := statFile(path)
+	if err != nil {
+		return nil, stamp, err
+	}
+	data, err := ioutil.ReadFile(path)
+	return data, stamp, errors.WithStack(err)
+}
+
+// certReloader is the CredentialProvider of the CA, cert and key in a
+// Security config, and reloads them when the files change. The files are
+// checked on every TLS handshake, so the connections established after a
+// rotation use the new certificates without rebuilding the clients.
+type certReloader struct {
+	sec Security
+
+	mu     sync.Mutex
+	stamps [3]fileStamp // CA, cert and key.
+	pool   *x509.CertPool
+	cert   *tls.Certificate
+}
+
+func newCertReloader(sec Security) (*certReloader, error) {
+	r := &certReloader{sec: sec}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) hasCert() bool {
+	return (len(r.sec.SSLCert) != 0 || len(r.sec.SSLCertPEM) != 0) &&
+		(len(r.sec.SSLKey) != 0 || len(r.sec.SSLKeyPEM) != 0)
+}
+
+// changed returns the current stamps of the files, and whether any of them
+// changed since the last load.
+func (r *certReloader) changed() ([3]fileStamp, bool) {
+	var stamps [3]fileStamp
+	pems := []string{r.sec.SSLCAPEM, r.sec.SSLCertPEM, r.sec.SSLKeyPEM}
+	for i, path := range []string{r.sec.SSLCA, r.sec.SSLCert, r.sec.SSLKey} {
+		if path == "" || pems[i] != "" {
+			continue
+		}
+		// The files that could not be stated are treated as changed, and
+		// reported by reload.
+		stamp, err := statFile(path)
+		if err != nil {
+			return stamps, true
+		}
+		stamps[i] = stamp
+	}
+	return stamps, r.pool == nil || stamps != r.stamps
+}
+
+// reload loads the files if any of them changed since the last load. If the
+// files can not be loaded, e.g. the cert is rotated but the key is not yet,
+// the loaded certificates are kept and the files are loaded again next time.
+func (r *certReloader) reload() error {
+	if _, changed := r.changed(); !changed {
+		return nil
+	}
+	var stamps [3]fileStamp
+
+	var cert *tls.Certificate
+	if r.hasCert() {
+		// Load the client certificates
+		certPEM, certStamp, err := readPEM(r.sec.SSLCertPEM, r.sec.SSLCert)
+		if err != nil {
+			return errors.Errorf("could not load client key pair: %s", err)
+		}
+		keyPEM, keyStamp, err := readPEM(r.sec.SSLKeyPEM, r.sec.SSLKey)
+		if err != nil {
+			return errors.Errorf("could not load client key pair: %s", err)
+		}
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return errors.Errorf("could not load client key pair: %s", err)
+		}
+		cert, stamps[1], stamps[2] = &certificate, certStamp, keyStamp
+	}
+
+	// Create a certificate pool from the certificate authority
+	pool := x509.NewCertPool()
+	ca, caStamp, err := readPEM(r.sec.SSLCAPEM, r.sec.SSLCA)
+	if err != nil {
+		return errors.Errorf("could not read ca certificate: %s", err)
+	}
+	// Append the certificates from the CA
+	if !pool.AppendCertsFromPEM(ca) {
+		return errors.New("failed to append ca certs")
+	}
+	stamps[0] = caStamp
+
+	if r.pool != nil {
+		log.Infof("reloaded tls certificates, ca: %s, cert: %s", r.sec.SSLCA, r.sec.SSLCert)
+	}
+	r.stamps, r.pool, r.cert = stamps, pool, cert
+	return nil
+}
+
+// load reloads the files if needed, and returns the loaded certificates.
+func (r *certReloader) load() (*x509.CertPool, *tls.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reload(); err != nil {
+		log.Warnf("failed to reload tls certificates, keep using the loaded ones: %v", err)
+	}
+	return r.pool, r.cert
+}
+
+// RootCAs implements CredentialProvider.
+func (r *certReloader) RootCAs() (*x509.CertPool, error) {
+	pool, _ := r.load()
+	return pool, nil
+}
+
+// ClientCertificate implements CredentialProvider.
+func (r *certReloader) ClientCertificate() (*tls.Certificate, error) {
+	_, cert := r.load()
+	return cert, nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testTLSSuite struct{}
+
+var _ = Suite(&testTLSSuite{})
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(c *C) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM encoded certificate and key signed by the CA.
+func (ca *testCA) issue(c *C, name string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	c.Assert(err, IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// testTLSServer accepts the connections that present a client certificate
+// signed by its CA, and writes a byte to them.
+type testTLSServer struct {
+	l    net.Listener
+	mu   sync.Mutex
+	conf *tls.Config
+}
+
+func newTestTLSServer(c *C) *testTLSServer {
+	s := &testTLSServer{}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.conf, nil
+		},
+	})
+	c.Assert(err, IsNil)
+	s.l = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte{1})
+			conn.Close()
+		}
+	}()
+	return s
+}
+
+func (s *testTLSServer) setCA(c *C, ca *testCA) {
+	certPEM, keyPEM := ca.issue(c, "tikv")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	c.Assert(err, IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func (s *testTLSServer) connect(conf *tls.Config, serverName string) error {
+	conf = conf.Clone()
+	conf.ServerName = serverName
+	conn, err := tls.Dial("tcp", s.l.Addr().String(), conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// The client certificate is verified by the server after the handshake in
+	// TLS 1.3, read from the connection to get the result.
+	if n, err := conn.Read(make([]byte, 1)); n == 0 {
+		return err
+	}
+	return nil
+}
+
+func writeCerts(c *C, sec Security, ca *testCA, modTime time.Time) {
+	certPEM, keyPEM := ca.issue(c, "client")
+	for path, data := range map[string][]byte{sec.SSLCA: ca.pem, sec.SSLCert: certPEM, sec.SSLKey: keyPEM} {
+		c.Assert(ioutil.WriteFile(path, data, 0600), IsNil)
+		c.Assert(os.Chtimes(path, modTime, modTime), IsNil)
+	}
+}
+
+func (s *testTLSSuite) TestReloadCertificates(c *C) {
+	dir, err := ioutil.TempDir("", "tls")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	sec := Security{
+		SSLCA:   filepath.Join(dir, "ca.pem"),
+		SSLCert: filepath.Join(dir, "client.pem"),
+		SSLKey:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	server := newTestTLSServer(c)
+	defer server.l.Close()
+	ca := newTestCA(c)
+	server.setCA(c, ca)
+	writeCerts(c, sec, ca, time.Now().Add(-time.Minute))
+
+	conf, err := sec.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+	// The host name is still verified.
+	c.Assert(server.connect(conf, "pd"), ErrorMatches, ".*certificate is valid for tikv, not pd.*")
+
+	// Rotate the CA and the certificates of both sides.
+	ca = newTestCA(c)
+	server.setCA(c, ca)
+	writeCerts(c, sec, ca, time.Now())
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+
+	// A broken rotation does not affect the loaded certificates.
+	c.Assert(ioutil.WriteFile(sec.SSLKey, []byte("broken"), 0600), IsNil)
+	c.Assert(os.Chtimes(sec.SSLKey, time.Now().Add(time.Minute), time.Now().Add(time.Minute)), IsNil)
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+
+	// The server is not trusted by a stale CA.
+	server.setCA(c, newTestCA(c))
+	c.Assert(server.connect(conf, "tikv"), ErrorMatches, ".*certificate signed by unknown authority.*")
+
+	conf, err = (&Security{}).ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(conf, IsNil)
+	_, err = (&Security{SSLCA: filepath.Join(dir, "missing.pem")}).ToTLSConfig()
+	c.Assert(err, ErrorMatches, "could not read ca certificate.*")
+}
+
+// staticProvider is a CredentialProvider that returns the credentials in
+// memory.
+type staticProvider struct {
+	pool *x509.CertPool
+	cert *tls.Certificate
+}
+
+func (p *staticProvider) RootCAs() (*x509.CertPool, error) { return p.pool, nil }
+
+func (p *staticProvider) ClientCertificate() (*tls.Certificate, error) { return p.cert, nil }
+
+func (s *testTLSSuite) TestPolicy(c *C) {
+	server := newTestTLSServer(c)
+	defer server.l.Close()
+	ca := newTestCA(c)
+	server.setCA(c, ca)
+	certPEM, keyPEM := ca.issue(c, "client")
+
+	sec := Security{SSLCAPEM: string(ca.pem), SSLCertPEM: string(certPEM), SSLKeyPEM: string(keyPEM)}
+	c.Assert(sec.Enabled(), IsTrue)
+	conf, err := sec.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+
+	// The server is accepted if its common name or any of its SANs is allowed.
+	for _, allowed := range []struct {
+		cns, sans []string
+		ok        bool
+	}{
+		{cns: []string{"tikv"}, ok: true},
+		{sans: []string{"pd", "tikv"}, ok: true},
+		{cns: []string{"pd"}, sans: []string{"tikv.example.com"}, ok: false},
+	} {
+		sec.AllowedCommonNames, sec.AllowedSANs = allowed.cns, allowed.sans
+		conf, err = sec.ToTLSConfig()
+		c.Assert(err, IsNil)
+		err = server.connect(conf, "tikv")
+		if allowed.ok {
+			c.Assert(err, IsNil)
+		} else {
+			c.Assert(err, ErrorMatches, ".*server identity is not allowed, names: \\[CN:tikv SAN:tikv\\]")
+		}
+	}
+	sec.AllowedCommonNames, sec.AllowedSANs = nil, nil
+
+	// Without a server name, the host can not be verified, the server is
+	// accepted only if its identity is restricted.
+	leaf, _ := pem.Decode(certPEM)
+	leafCert, err := x509.ParseCertificate(leaf.Bytes)
+	c.Assert(err, IsNil)
+	provider := &staticProvider{pool: x509.NewCertPool()}
+	provider.pool.AddCert(ca.cert)
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leafCert}}
+	err = newTLSVerifier(&Security{}, provider).verifyConnection(cs)
+	c.Assert(err, ErrorMatches, "no server name to verify the server certificate")
+	c.Assert(newTLSVerifier(&Security{AllowedCommonNames: []string{"client"}}, provider).verifyConnection(cs), IsNil)
+	c.Assert(newTLSVerifier(&Security{AllowedCommonNames: []string{"tikv"}}, provider).verifyConnection(cs), NotNil)
+	cs.ServerName = "client"
+	c.Assert(newTLSVerifier(&Security{}, provider).verifyConnection(cs), IsNil)
+
+	// The server does not support TLS versions above the minimum version.
+	server.mu.Lock()
+	server.conf.MaxVersion = tls.VersionTLS12
+	server.mu.Unlock()
+	sec.MinVersion = "1.3"
+	conf, err = sec.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(conf.MinVersion, Equals, uint16(tls.VersionTLS13))
+	c.Assert(server.connect(conf, "tikv"), ErrorMatches, ".*protocol version.*")
+	sec.MinVersion = "1.2"
+	sec.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	conf, err = sec.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+	sec.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+	_, err = sec.ToTLSConfig()
+	c.Assert(err, ErrorMatches, "unknown or insecure cipher suite \"TLS_RSA_WITH_RC4_128_SHA\"")
+
+	// The credentials from the provider are used instead of the PEMs.
+	server.setCA(c, ca)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	c.Assert(err, IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	provider = &staticProvider{pool: pool, cert: &cert}
+	sec = Security{CredentialProvider: provider}
+	conf, err = sec.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(server.connect(conf, "tikv"), IsNil)
+	// The server rejects the client without a certificate.
+	provider.cert = nil
+	c.Assert(server.connect(conf, "tikv"), ErrorMatches, ".*certificate required.*")
+}
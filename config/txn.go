@@ -18,57 +18,57 @@ import "time"
 // Txn contains the configurations for transactional kv.
 type Txn struct {
 	// EntrySizeLimit is limit of single entry size (len(key) + len(value)).
-	EntrySizeLimit int
+	EntrySizeLimit int `toml:"entry-size-limit" json:"entry-size-limit"`
 
 	// EntryCountLimit is a limit of the number of entries in the MemBuffer.
-	EntryCountLimit int
+	EntryCountLimit int `toml:"entry-count-limit" json:"entry-count-limit"`
 
 	// TotalSizeLimit is limit of the sum of all entry size.
-	TotalSizeLimit int
+	TotalSizeLimit int `toml:"total-size-limit" json:"total-size-limit"`
 
 	// MaxTimeUse is the max time a transaction can run.
-	MaxTimeUse int
+	MaxTimeUse int `toml:"max-time-use" json:"max-time-use"`
 
 	// DefaultMembufCap is the default transaction membuf capability.
-	DefaultMembufCap int
+	DefaultMembufCap int `toml:"default-membuf-cap" json:"default-membuf-cap"`
 
 	// TiKV recommends each RPC packet should be less than ~1MB. We keep each
 	// packet's Key+Value size below 16KB by default.
-	CommitBatchSize int
+	CommitBatchSize int `toml:"commit-batch-size" json:"commit-batch-size"`
 
 	// ScanBatchSize is the limit of an iterator's scan request.
-	ScanBatchSize int
+	ScanBatchSize int `toml:"scan-batch-size" json:"scan-batch-size"`
 
 	// BatchGetSize is the max number of keys in a BatchGet request.
-	BatchGetSize int
+	BatchGetSize int `toml:"batch-get-size" json:"batch-get-size"`
 
 	// By default, locks after 3000ms is considered unusual (the client created the
 	// lock might be dead). Other client may cleanup this kind of lock.
 	// For locks created recently, we will do backoff and retry.
-	DefaultLockTTL uint64
+	DefaultLockTTL uint64 `toml:"default-lock-ttl" json:"default-lock-ttl"`
 
 	// The maximum value of a txn's lock TTL.
-	MaxLockTTL uint64
+	MaxLockTTL uint64 `toml:"max-lock-ttl" json:"max-lock-ttl"`
 
 	// ttl = ttlFactor * sqrt(writeSizeInMiB)
-	TTLFactor int
+	TTLFactor int `toml:"ttl-factor" json:"ttl-factor"`
 
 	// ResolveCacheSize is max number of cached txn status.
-	ResolveCacheSize int
+	ResolveCacheSize int `toml:"resolve-cache-size" json:"resolve-cache-size"`
 
-	GcSavedSafePoint               string
-	GcSafePointCacheInterval       time.Duration
-	GcCPUTimeInaccuracyBound       time.Duration
-	GcSafePointUpdateInterval      time.Duration
-	GcSafePointQuickRepeatInterval time.Duration
+	GcSavedSafePoint               string        `toml:"gc-saved-safe-point" json:"gc-saved-safe-point"`
+	GcSafePointCacheInterval       time.Duration `toml:"gc-safe-point-cache-interval" json:"gc-safe-point-cache-interval"`
+	GcCPUTimeInaccuracyBound       time.Duration `toml:"gc-cpu-time-inaccuracy-bound" json:"gc-cpu-time-inaccuracy-bound"`
+	GcSafePointUpdateInterval      time.Duration `toml:"gc-safe-point-update-interval" json:"gc-safe-point-update-interval"`
+	GcSafePointQuickRepeatInterval time.Duration `toml:"gc-safe-point-quick-repeat-interval" json:"gc-safe-point-quick-repeat-interval"`
 
-	GCTimeout                 time.Duration
-	UnsafeDestroyRangeTimeout time.Duration
+	GCTimeout                 time.Duration `toml:"gc-timeout" json:"gc-timeout"`
+	UnsafeDestroyRangeTimeout time.Duration `toml:"unsafe-destroy-range-timeout" json:"unsafe-destroy-range-timeout"`
 
-	TsoSlowThreshold     time.Duration
-	OracleUpdateInterval time.Duration
+	TsoSlowThreshold     time.Duration `toml:"tso-slow-threshold" json:"tso-slow-threshold"`
+	OracleUpdateInterval time.Duration `toml:"oracle-update-interval" json:"oracle-update-interval"`
 
-	Latch Latch
+	Latch Latch `toml:"latch" json:"latch"`
 }
 
 // DefaultTxn returns the default txn config.
@@ -102,13 +102,13 @@ func DefaultTxn() Txn {
 // Latch is the configuration for local latch.
 type Latch struct {
 	// Enable it when there are lots of conflicts between transactions.
-	Enable         bool
-	Capacity       uint
-	ExpireDuration time.Duration
-	CheckInterval  time.Duration
-	CheckCounter   int
-	ListCount      int
-	LockChanSize   int
+	Enable         bool          `toml:"enable" json:"enable"`
+	Capacity       uint          `toml:"capacity" json:"capacity"`
+	ExpireDuration time.Duration `toml:"expire-duration" json:"expire-duration"`
+	CheckInterval  time.Duration `toml:"check-interval" json:"check-interval"`
+	CheckCounter   int           `toml:"check-counter" json:"check-counter"`
+	ListCount      int           `toml:"list-count" json:"list-count"`
+	LockChanSize   int           `toml:"lock-chan-size" json:"lock-chan-size"`
 }
 
 // DefaultLatch returns the default Latch config.
@@ -0,0 +1,84 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Update returns a copy of c with the fields that can be changed at runtime
+// taken from next. These are:
+//   - rpc.read-timeout-short, rpc.read-timeout-medium and rpc.read-timeout-long
+//   - raw
+//   - txn.commit-batch-size, txn.scan-batch-size and txn.batch-get-size
+//   - retry
+//
+// The other fields are used when the clients are created, so an error is
+// returned if next changes any of them. The result is validated.
+func (c *Config) Update(next Config) (Config, error) {
+	conf := *c
+	conf.RPC.ReadTimeoutShort = next.RPC.ReadTimeoutShort
+	conf.RPC.ReadTimeoutMedium = next.RPC.ReadTimeoutMedium
+	conf.RPC.ReadTimeoutLong = next.RPC.ReadTimeoutLong
+	conf.Raw = next.Raw
+	conf.Txn.CommitBatchSize = next.Txn.CommitBatchSize
+	conf.Txn.ScanBatchSize = next.Txn.ScanBatchSize
+	conf.Txn.BatchGetSize = next.Txn.BatchGetSize
+	conf.Retry = next.Retry.clone()
+
+	if changed := diffFields(reflect.ValueOf(conf), reflect.ValueOf(next), ""); len(changed) > 0 {
+		return *c, errors.Errorf("%s can not be updated at runtime", strings.Join(changed, ", "))
+	}
+	if err := conf.Validate(); err != nil {
+		return *c, err
+	}
+	return conf, nil
+}
+
+func (r Retry) clone() Retry {
+	res := Retry{}
+	if r.Policies != nil {
+		res.Policies = make(map[string]BackoffPolicy, len(r.Policies))
+		for k, v := range r.Policies {
+			res.Policies[k] = v
+		}
+	}
+	if r.Budgets != nil {
+		res.Budgets = make(map[string]time.Duration, len(r.Budgets))
+		for k, v := range r.Budgets {
+			res.Budgets[k] = v
+		}
+	}
+	return res
+}
+
+// diffFields returns the paths of the fields that are different in a and b.
+func diffFields(a, b reflect.Value, path string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{path}
+	}
+	var res []string
+	for i := 0; i < a.NumField(); i++ {
+		key := joinPath(path, a.Type().Field(i).Tag.Get("toml"))
+		res = append(res, diffFields(a.Field(i), b.Field(i), key)...)
+	}
+	return res
+}
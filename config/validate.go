@@ -0,0 +1,200 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/encoding"
+)
+
+// validator collects the invalid values of a config, with the paths of the
+// fields.
+type validator struct {
+	errs []string
+}
+
+func (v *validator) check(ok bool, path string, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) positive(n int64, path string) {
+	v.check(n > 0, path, "%d should be positive", n)
+}
+
+func (v *validator) positiveDuration(d time.Duration, path string) {
+	v.check(d > 0, path, "%v should be positive", d)
+}
+
+func (v *validator) nonNegativeDuration(d time.Duration, path string) {
+	v.check(d >= 0, path, "%v should not be negative", d)
+}
+
+// Validate checks the config, and returns an error that lists all the values
+// out of range with the paths of the fields.
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.RPC.validate(v, "rpc")
+	c.Raw.validate(v, "raw")
+	c.Txn.validate(v, "txn")
+	c.RegionCache.validate(v, "region-cache")
+	c.Retry.validate(v, "retry")
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return errors.Errorf("invalid config:\n%s", strings.Join(v.errs, "\n"))
+}
+
+func (r *RPC) validate(v *validator, path string) {
+	v.positive(int64(r.MaxConnectionCount), path+".max-connection-count")
+	v.positiveDuration(r.GrpcKeepAliveTime, path+".grpc-keep-alive-time")
+	v.positiveDuration(r.GrpcKeepAliveTimeout, path+".grpc-keep-alive-timeout")
+	v.positive(int64(r.GrpcMaxSendMsgSize), path+".grpc-max-send-msg-size")
+	v.positive(int64(r.GrpcMaxCallMsgSize), path+".grpc-max-call-msg-size")
+	v.positive(int64(r.GrpcInitialWindowSize), path+".grpc-initial-window-size")
+	v.positive(int64(r.GrpcInitialConnWindowSize), path+".grpc-initial-conn-window-size")
+	v.positiveDuration(r.DialTimeout, path+".dial-timeout")
+	v.positiveDuration(r.ReadTimeoutShort, path+".read-timeout-short")
+	v.positiveDuration(r.ReadTimeoutMedium, path+".read-timeout-medium")
+	v.positiveDuration(r.ReadTimeoutLong, path+".read-timeout-long")
+	r.Batch.validate(v, path+".batch")
+	r.Hedge.validate(v, path+".hedge")
+	r.RetryBudget.validate(v, path+".retry-budget")
+	r.Compression.validate(v, path+".compression")
+	r.Security.validate(v, path+".security")
+}
+
+func (b *Batch) validate(v *validator, path string) {
+	if b.MaxBatchSize > 0 {
+		v.check(b.MaxWaitSize <= b.MaxBatchSize, path+".max-wait-size", "%d should not be greater than max-batch-size %d", b.MaxWaitSize, b.MaxBatchSize)
+	}
+	v.nonNegativeDuration(b.MaxWaitTime, path+".max-wait-time")
+}
+
+func (h *Hedge) validate(v *validator, path string) {
+	v.check(h.Percentile > 0 && h.Percentile <= 1, path+".percentile", "%v should be in (0, 1]", h.Percentile)
+	v.nonNegativeDuration(h.MinDelay, path+".min-delay")
+	v.check(h.MaxDelay >= h.MinDelay, path+".max-delay", "%v should not be less than min-delay %v", h.MaxDelay, h.MinDelay)
+	v.check(h.BudgetRatio >= 0 && h.BudgetRatio <= 1, path+".budget-ratio", "%v should be in [0, 1]", h.BudgetRatio)
+}
+
+func (b *RetryBudget) validate(v *validator, path string) {
+	if !b.Enable {
+		return
+	}
+	v.positive(int64(b.ClientBurst), path+".client-burst")
+	v.check(b.ClientRate >= 0, path+".client-rate", "%v should not be negative", b.ClientRate)
+	v.positive(int64(b.StoreBurst), path+".store-burst")
+	v.check(b.StoreRate >= 0, path+".store-rate", "%v should not be negative", b.StoreRate)
+}
+
+func (c *Compression) validate(v *validator, path string) {
+	v.check(c.Compressor == "" || encoding.GetCompressor(c.Compressor) != nil, path+".compressor", "%q is not registered", c.Compressor)
+}
+
+func (s *Security) validate(v *validator, path string) {
+	hasCert, hasKey := s.SSLCert != "" || s.SSLCertPEM != "", s.SSLKey != "" || s.SSLKeyPEM != ""
+	v.check(hasCert == hasKey, path, "ssl-cert and ssl-key should be set together")
+	v.check(!hasCert || s.SSLCA != "" || s.SSLCAPEM != "" || s.CredentialProvider != nil, path+".ssl-ca", "should be set when ssl-cert is set")
+	if _, err := parseTLSVersion(s.MinVersion); err != nil {
+		v.check(false, path+".min-version", "%v", err)
+	}
+	if _, err := parseCipherSuites(s.CipherSuites); err != nil {
+		v.check(false, path+".cipher-suites", "%v", err)
+	}
+}
+
+func (r *Raw) validate(v *validator, path string) {
+	v.positive(int64(r.MaxScanLimit), path+".max-scan-limit")
+	v.positive(int64(r.MaxBatchPutSize), path+".max-batch-put-size")
+	v.positive(int64(r.BatchPairCount), path+".batch-pair-count")
+}
+
+func (t *Txn) validate(v *validator, path string) {
+	v.positive(int64(t.EntrySizeLimit), path+".entry-size-limit")
+	v.positive(int64(t.EntryCountLimit), path+".entry-count-limit")
+	v.check(t.TotalSizeLimit >= t.EntrySizeLimit, path+".total-size-limit", "%d should not be less than entry-size-limit %d", t.TotalSizeLimit, t.EntrySizeLimit)
+	v.positive(int64(t.MaxTimeUse), path+".max-time-use")
+	v.positive(int64(t.DefaultMembufCap), path+".default-membuf-cap")
+	v.positive(int64(t.CommitBatchSize), path+".commit-batch-size")
+	v.positive(int64(t.ScanBatchSize), path+".scan-batch-size")
+	v.positive(int64(t.BatchGetSize), path+".batch-get-size")
+	v.check(t.DefaultLockTTL > 0, path+".default-lock-ttl", "%d should be positive", t.DefaultLockTTL)
+	v.check(t.MaxLockTTL >= t.DefaultLockTTL, path+".max-lock-ttl", "%d should not be less than default-lock-ttl %d", t.MaxLockTTL, t.DefaultLockTTL)
+	v.positive(int64(t.TTLFactor), path+".ttl-factor")
+	v.positive(int64(t.ResolveCacheSize), path+".resolve-cache-size")
+	v.positiveDuration(t.GcSafePointCacheInterval, path+".gc-safe-point-cache-interval")
+	v.nonNegativeDuration(t.GcCPUTimeInaccuracyBound, path+".gc-cpu-time-inaccuracy-bound")
+	v.positiveDuration(t.GcSafePointUpdateInterval, path+".gc-safe-point-update-interval")
+	v.positiveDuration(t.GcSafePointQuickRepeatInterval, path+".gc-safe-point-quick-repeat-interval")
+	v.positiveDuration(t.GCTimeout, path+".gc-timeout")
+	v.positiveDuration(t.UnsafeDestroyRangeTimeout, path+".unsafe-destroy-range-timeout")
+	v.nonNegativeDuration(t.TsoSlowThreshold, path+".tso-slow-threshold")
+	v.positiveDuration(t.OracleUpdateInterval, path+".oracle-update-interval")
+	t.Latch.validate(v, path+".latch")
+}
+
+func (l *Latch) validate(v *validator, path string) {
+	if !l.Enable {
+		return
+	}
+	v.positive(int64(l.Capacity), path+".capacity")
+	v.positiveDuration(l.ExpireDuration, path+".expire-duration")
+	v.positiveDuration(l.CheckInterval, path+".check-interval")
+	v.positive(int64(l.CheckCounter), path+".check-counter")
+	v.positive(int64(l.ListCount), path+".list-count")
+	v.positive(int64(l.LockChanSize), path+".lock-chan-size")
+}
+
+func (r *RegionCache) validate(v *validator, path string) {
+	v.check(r.BTreeDegree >= 2, path+".btree-degree", "%d should not be less than 2", r.BTreeDegree)
+	v.positiveDuration(r.CacheTTL, path+".cache-ttl")
+	v.positive(int64(r.ScanRegionsLimit), path+".scan-regions-limit")
+	v.positive(int64(r.StoreFailureThreshold), path+".store-failure-threshold")
+	v.nonNegativeDuration(r.StoreDownCoolDown, path+".store-down-cool-down")
+	v.nonNegativeDuration(r.StoreProbeInterval, path+".store-probe-interval")
+}
+
+func (r *Retry) validate(v *validator, path string) {
+	// Check the maps in order so the errors are stable.
+	names := make([]string, 0, len(r.Policies))
+	for name := range r.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, policyPath := r.Policies[name], path+".policies."+name
+		v.nonNegativeDuration(p.Base, policyPath+".base")
+		v.check(p.Cap >= p.Base, policyPath+".cap", "%v should not be less than base %v", p.Cap, p.Base)
+		switch p.Jitter {
+		case JitterNone, JitterFull, JitterEqual, JitterDecorr:
+		default:
+			v.check(false, policyPath+".jitter", "%q should be one of %q, %q, %q and %q", p.Jitter, JitterNone, JitterFull, JitterEqual, JitterDecorr)
+		}
+	}
+	budgets := make([]string, 0, len(r.Budgets))
+	for op := range r.Budgets {
+		budgets = append(budgets, op)
+	}
+	sort.Strings(budgets)
+	for _, op := range budgets {
+		v.positiveDuration(r.Budgets[op], path+".budgets."+op)
+	}
+}
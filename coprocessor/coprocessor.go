@@ -0,0 +1,319 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package coprocessor sends coprocessor requests to TiKV. A request is split
+// into a task for each region it covers, and the raw responses of the tasks
+// are returned. The request data is interpreted by TiKV, this package does not
+// encode or decode it.
+package coprocessor
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	pb "github.com/pingcap/kvproto/pkg/coprocessor"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
+	"github.com/tikv/client-go/txnkv/store"
+)
+
+// Request is a coprocessor request.
+type Request struct {
+	// Tp is the type of the request, like DAG, Analyze or Checksum.
+	Tp int64
+	// StartTs is the timestamp to read data at.
+	StartTs uint64
+	// Data is the request body.
+	Data []byte
+	// Ranges are the key ranges to read. They should be sorted and not
+	// overlap.
+	Ranges []key.Range
+	// Concurrency is the max number of tasks that are sent at the same time.
+	Concurrency int
+	// KeepOrder makes the responses returned in the order of the ranges.
+	KeepOrder bool
+	// Streaming uses the streaming API, a task may return multiple responses.
+	Streaming bool
+}
+
+// Client sends coprocessor requests.
+type Client struct {
+	store *store.TiKVStore
+}
+
+// NewClient creates a Client.
+func NewClient(store *store.TiKVStore) *Client {
+	return &Client{store: store}
+}
+
+type copResult struct {
+	resp *pb.Response
+	err  error
+}
+
+// Send splits the request into tasks and starts to send them. The responses
+// are read from the returned Iterator, which should be closed after use.
+func (c *Client) Send(ctx context.Context, req *Request) (*Iterator, error) {
+	bo := retry.NewBackofferWithConfig(ctx, &c.store.GetConfig().Retry, retry.OpCopBuildTask)
+	tasks, err := buildTasks(bo, c.store.GetRegionCache(), req.Ranges)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(tasks) {
+		concurrency = len(tasks)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &Iterator{
+		client: c,
+		req:    req,
+		tasks:  tasks,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	taskCh := make(chan *copTask, len(tasks))
+	for _, task := range tasks {
+		if req.KeepOrder {
+			task.respCh = make(chan copResult, 2)
+		}
+		taskCh <- task
+	}
+	close(taskCh)
+	if !req.KeepOrder {
+		it.respCh = make(chan copResult, concurrency)
+	}
+
+	it.wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go it.work(taskCh)
+	}
+	if !req.KeepOrder {
+		go func() {
+			it.wg.Wait()
+			close(it.respCh)
+		}()
+	}
+	return it, nil
+}
+
+// Iterator returns the responses of a request.
+type Iterator struct {
+	client *Client
+	req    *Request
+	tasks  []*copTask
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// respCh receives the responses of all tasks when the request does not
+	// keep order.
+	respCh chan copResult
+	// curr is the task being read when the request keeps order.
+	curr int
+}
+
+// Next returns the next response. It returns nil when there are no more
+// responses. The iterator should not be used after an error is returned.
+func (it *Iterator) Next(ctx context.Context) (*pb.Response, error) {
+	for {
+		ch := it.respCh
+		if it.req.KeepOrder {
+			if it.curr >= len(it.tasks) {
+				return nil, nil
+			}
+			ch = it.tasks[it.curr].respCh
+		}
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				if !it.req.KeepOrder {
+					return nil, nil
+				}
+				it.curr++
+				continue
+			}
+			return r.resp, r.err
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+// Close stops sending the tasks and waits for the workers to exit.
+func (it *Iterator) Close() error {
+	it.cancel()
+	it.wg.Wait()
+	return nil
+}
+
+func (it *Iterator) work(taskCh <-chan *copTask) {
+	defer it.wg.Done()
+	sender := rpc.NewRegionRequestSender(it.client.store.GetRegionCache(), it.client.store.GetRPCClient())
+	for task := range taskCh {
+		ch := it.respCh
+		if it.req.KeepOrder {
+			ch = task.respCh
+		}
+		err := it.handleTask(sender, task, ch)
+		if it.req.KeepOrder {
+			close(task.respCh)
+		}
+		if err != nil {
+			// Other workers are stopped, the caller is going to stop at
+			// the error anyway.
+			it.cancel()
+			return
+		}
+	}
+}
+
+// handleTask sends the task, and the tasks re-split from it on region errors,
+// until all of them are done.
+func (it *Iterator) handleTask(sender *rpc.RegionRequestSender, task *copTask, ch chan<- copResult) error {
+	bo := retry.NewBackofferWithConfig(it.ctx, &it.client.store.GetConfig().Retry, retry.OpCopNext)
+	remain := []*copTask{task}
+	for len(remain) > 0 {
+		tasks, err := it.handleTaskOnce(bo, sender, remain[0], ch)
+		if err != nil {
+			log.Debugf("coprocessor: handle task failed, err: %v", err)
+			it.sendResult(ch, copResult{err: err})
+			return err
+		}
+		remain = append(tasks, remain[1:]...)
+	}
+	return nil
+}
+
+// handleTaskOnce sends the task, and returns the tasks to retry.
+func (it *Iterator) handleTaskOnce(bo *retry.Backoffer, sender *rpc.RegionRequestSender, task *copTask, ch chan<- copResult) ([]*copTask, error) {
+	req := &rpc.Request{
+		Type: rpc.CmdCop,
+		Cop: &pb.Request{
+			Tp:      it.req.Tp,
+			StartTs: it.req.StartTs,
+			Data:    it.req.Data,
+			Ranges:  toPBRanges(task.ranges),
+		},
+	}
+	if it.req.Streaming {
+		req.Type = rpc.CmdCopStream
+	}
+	timeout := it.client.store.GetConfig().RPC.ReadTimeoutMedium
+	resp, err := sender.SendReq(bo, req, task.region, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if it.req.Streaming {
+		if resp.CopStream == nil {
+			return nil, errors.WithStack(rpc.ErrBodyMissing)
+		}
+		return it.handleStream(bo, task, resp.CopStream, ch)
+	}
+	if resp.Cop == nil {
+		return nil, errors.WithStack(rpc.ErrBodyMissing)
+	}
+	return it.handleResponse(bo, task, resp.Cop, nil, ch)
+}
+
+func (it *Iterator) handleStream(bo *retry.Backoffer, task *copTask, stream *rpc.CopStreamResponse, ch chan<- copResult) ([]*copTask, error) {
+	defer stream.Close()
+	var lastRange *pb.KeyRange
+	resp := stream.Response
+	for resp != nil {
+		tasks, err := it.handleResponse(bo, task, resp, lastRange, ch)
+		if err != nil || tasks != nil {
+			return tasks, err
+		}
+		if resp.GetRange() != nil {
+			lastRange = resp.GetRange()
+		}
+		resp, err = stream.Recv()
+		if err != nil {
+			if errors.Cause(err) == io.EOF {
+				return nil, nil
+			}
+			// The stream is broken, retry the ranges that are not done.
+			if err = bo.Backoff(retry.BoTiKVRPC, err); err != nil {
+				return nil, err
+			}
+			return it.retryTasks(bo, task, lastRange)
+		}
+	}
+	return nil, nil
+}
+
+// handleResponse handles a response of the task, and returns the tasks to
+// retry. lastRange is the last range that is done by a streaming request.
+func (it *Iterator) handleResponse(bo *retry.Backoffer, task *copTask, resp *pb.Response, lastRange *pb.KeyRange, ch chan<- copResult) ([]*copTask, error) {
+	if regionErr := resp.GetRegionError(); regionErr != nil {
+		if err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String())); err != nil {
+			return nil, err
+		}
+		return it.retryTasks(bo, task, lastRange)
+	}
+	if lockInfo := resp.GetLocked(); lockInfo != nil {
+		lock := store.NewLock(lockInfo, it.client.store.GetConfig().Txn.DefaultLockTTL)
+		ok, err := it.client.store.GetLockResolver().ResolveLocks(bo, []*store.Lock{lock})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if err := bo.Backoff(retry.BoTxnLockFast, errors.New(lockInfo.String())); err != nil {
+				return nil, err
+			}
+		}
+		ranges := remainRanges(task.ranges, lastRange)
+		if len(ranges) == 0 {
+			return []*copTask{}, nil
+		}
+		return []*copTask{{region: task.region, ranges: ranges}}, nil
+	}
+	if otherErr := resp.GetOtherError(); otherErr != "" {
+		return nil, errors.Errorf("coprocessor: %s", otherErr)
+	}
+	if !it.sendResult(ch, copResult{resp: resp}) {
+		return nil, errors.WithStack(it.ctx.Err())
+	}
+	return nil, nil
+}
+
+// retryTasks splits the ranges of the task that are not done by the regions
+// again.
+func (it *Iterator) retryTasks(bo *retry.Backoffer, task *copTask, lastRange *pb.KeyRange) ([]*copTask, error) {
+	tasks, err := buildTasks(bo, it.client.store.GetRegionCache(), remainRanges(task.ranges, lastRange))
+	if err != nil {
+		return nil, err
+	}
+	// An empty non-nil slice tells the caller that the task is replaced.
+	if tasks == nil {
+		tasks = []*copTask{}
+	}
+	return tasks, nil
+}
+
+func (it *Iterator) sendResult(ch chan<- copResult, r copResult) bool {
+	select {
+	case ch <- r:
+		return true
+	case <-it.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coprocessor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/txnkv/oracle"
+	"github.com/tikv/client-go/txnkv/store"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testCoprocessorSuite struct {
+	cluster   *mocktikv.Cluster
+	mvccStore mocktikv.MVCCStore
+	store     *store.TiKVStore
+	client    *Client
+}
+
+var _ = Suite(&testCoprocessorSuite{})
+
+func (s *testCoprocessorSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(s.cluster, []byte("b"), []byte("c"), []byte("d"))
+	s.mvccStore = mocktikv.MustNewMVCCStore()
+	s.store = store.NewMockStore(s.cluster, s.mvccStore, config.Default())
+	s.client = NewClient(s.store)
+
+	// Keys a0-a9, b0-b9, ..., e0-e9.
+	var (
+		mutations []*kvrpcpb.Mutation
+		keys      [][]byte
+	)
+	for _, p := range []byte("abcde") {
+		for i := 0; i < 10; i++ {
+			k := []byte(fmt.Sprintf("%c%d", p, i))
+			mutations = append(mutations, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: k, Value: k})
+			keys = append(keys, k)
+		}
+	}
+	startTS := s.mustGetTS(c)
+	for _, err := range s.mvccStore.Prewrite(mutations, keys[0], startTS, 3000) {
+		c.Assert(err, IsNil)
+	}
+	c.Assert(s.mvccStore.Commit(keys, startTS, s.mustGetTS(c)), IsNil)
+}
+
+func (s *testCoprocessorSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+}
+
+func (s *testCoprocessorSuite) mustGetTS(c *C) uint64 {
+	ts, err := s.store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	return ts
+}
+
+func ranges(keys ...string) []key.Range {
+	var ranges []key.Range
+	for i := 0; i < len(keys); i += 2 {
+		ranges = append(ranges, key.Range{StartKey: key.Key(keys[i]), EndKey: key.Key(keys[i+1])})
+	}
+	return ranges
+}
+
+// mustSend sends the request and returns the key counts of the responses.
+func (s *testCoprocessorSuite) mustSend(c *C, req *Request) []uint64 {
+	req.StartTs = s.mustGetTS(c)
+	it, err := s.client.Send(context.Background(), req)
+	c.Assert(err, IsNil)
+	defer it.Close()
+	var counts []uint64
+	for {
+		resp, err := it.Next(context.Background())
+		c.Assert(err, IsNil)
+		if resp == nil {
+			return counts
+		}
+		count, err := mocktikv.DecodeCopCount(resp.Data)
+		c.Assert(err, IsNil)
+		counts = append(counts, count)
+	}
+}
+
+func sum(counts []uint64) uint64 {
+	var n uint64
+	for _, count := range counts {
+		n += count
+	}
+	return n
+}
+
+func (s *testCoprocessorSuite) TestBuildTasks(c *C) {
+	bo := retry.NewBackoffer(context.Background(), retry.CopBuildTaskMaxBackoff)
+	tasks, err := buildTasks(bo, s.store.GetRegionCache(), ranges("a0", "a5", "a7", "b3", "b5", "b5", "c5", ""))
+	c.Assert(err, IsNil)
+	c.Assert(tasks, HasLen, 4)
+	c.Assert(tasks[0].ranges, DeepEquals, ranges("a0", "a5", "a7", "b"))
+	c.Assert(tasks[1].ranges, DeepEquals, ranges("b", "b3"))
+	c.Assert(tasks[2].ranges, DeepEquals, ranges("c5", "d"))
+	c.Assert(tasks[3].ranges, DeepEquals, ranges("d", ""))
+}
+
+func (s *testCoprocessorSuite) TestSend(c *C) {
+	counts := s.mustSend(c, &Request{Ranges: ranges("a5", "c5", "d", ""), Concurrency: 2, KeepOrder: true})
+	c.Assert(counts, DeepEquals, []uint64{5, 10, 5, 20})
+
+	counts = s.mustSend(c, &Request{Ranges: ranges("a5", "c5", "d", ""), Concurrency: 3})
+	c.Assert(counts, HasLen, 4)
+	c.Assert(sum(counts), Equals, uint64(40))
+
+	// Every range gets a response in streaming.
+	counts = s.mustSend(c, &Request{Ranges: ranges("a0", "a5", "a7", "b3"), Concurrency: 2, KeepOrder: true, Streaming: true})
+	c.Assert(counts, DeepEquals, []uint64{5, 3, 3})
+}
+
+func (s *testCoprocessorSuite) TestSendWithSplit(c *C) {
+	// Load regions into cache, then split them in the cluster so the tasks
+	// are built on stale regions.
+	c.Assert(sum(s.mustSend(c, &Request{Ranges: ranges("", "")})), Equals, uint64(50))
+	for _, splitKey := range []string{"a5", "c5"} {
+		region, _ := s.cluster.GetRegionByKey(mocktikv.NewMvccKey([]byte(splitKey)))
+		newRegionID, peerID := s.cluster.AllocID(), s.cluster.AllocID()
+		s.cluster.Split(region.GetId(), newRegionID, []byte(splitKey), []uint64{peerID}, peerID)
+	}
+
+	counts := s.mustSend(c, &Request{Ranges: ranges("", ""), Concurrency: 2, KeepOrder: true})
+	c.Assert(counts, DeepEquals, []uint64{5, 5, 10, 5, 5, 20})
+	counts = s.mustSend(c, &Request{Ranges: ranges("a", "b5", "c", "d"), Concurrency: 2, KeepOrder: true, Streaming: true})
+	c.Assert(counts, DeepEquals, []uint64{5, 5, 5, 5, 5})
+}
+
+func (s *testCoprocessorSuite) TestResolveLock(c *C) {
+	// Leave an expired lock of an uncommitted txn.
+	startTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	errs := s.mvccStore.Prewrite([]*kvrpcpb.Mutation{
+		{Op: kvrpcpb.Op_Put, Key: []byte("c5a"), Value: []byte("locked")},
+	}, []byte("c5a"), startTS, 1)
+	for _, err := range errs {
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(s.mustSend(c, &Request{Ranges: ranges("c", "d")}), DeepEquals, []uint64{10})
+	c.Assert(s.mustSend(c, &Request{Ranges: ranges("c", "d"), Streaming: true}), DeepEquals, []uint64{10})
+}
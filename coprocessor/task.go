@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coprocessor
+
+import (
+	"bytes"
+
+	pb "github.com/pingcap/kvproto/pkg/coprocessor"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/retry"
+)
+
+// copTask is the part of the request ranges that belongs to a region.
+type copTask struct {
+	region locate.RegionVerID
+	ranges []key.Range
+
+	// respCh receives the responses of the task when the request keeps order.
+	respCh chan copResult
+}
+
+// buildTasks splits the sorted ranges by the regions they cover. Adjacent
+// ranges in the same region are put in the same task.
+func buildTasks(bo *retry.Backoffer, cache *locate.RegionCache, ranges []key.Range) ([]*copTask, error) {
+	var tasks []*copTask
+	for _, r := range ranges {
+		if r.IsEmpty() {
+			continue
+		}
+		locator := cache.NewRangeLocator(r.EndKey)
+		start := r.StartKey
+		for {
+			loc, err := locator.LocateKey(bo, start)
+			if err != nil {
+				return nil, err
+			}
+			part := key.Range{StartKey: start, EndKey: r.EndKey}.Intersect(key.Range{StartKey: loc.StartKey, EndKey: loc.EndKey})
+			if n := len(tasks); n > 0 && tasks[n-1].region == loc.Region {
+				tasks[n-1].ranges = append(tasks[n-1].ranges, part)
+			} else {
+				tasks = append(tasks, &copTask{region: loc.Region, ranges: []key.Range{part}})
+			}
+			if len(loc.EndKey) == 0 || (!r.Unbounded() && bytes.Compare(loc.EndKey, r.EndKey) >= 0) {
+				break
+			}
+			start = loc.EndKey
+		}
+	}
+	return tasks, nil
+}
+
+// remainRanges returns the part of ranges after the last range that has been
+// processed by a streaming request.
+func remainRanges(ranges []key.Range, last *pb.KeyRange) []key.Range {
+	if last == nil {
+		return ranges
+	}
+	if len(last.GetEnd()) == 0 {
+		return nil
+	}
+	var remain []key.Range
+	for _, r := range ranges {
+		r = r.Intersect(key.Range{StartKey: last.GetEnd()})
+		if !r.IsEmpty() {
+			remain = append(remain, r)
+		}
+	}
+	return remain
+}
+
+func toPBRanges(ranges []key.Range) []*pb.KeyRange {
+	pbRanges := make([]*pb.KeyRange, 0, len(ranges))
+	for _, r := range ranges {
+		pbRanges = append(pbRanges, &pb.KeyRange{Start: r.StartKey, End: r.EndKey})
+	}
+	return pbRanges
+}
@@ -3,6 +3,7 @@ module github.com/tikv/client-go
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/coreos/etcd v3.3.25+incompatible
 	github.com/cznic/mathutil v0.0.0-20181122101859-297441e03548
 	github.com/golang/protobuf v1.3.4
@@ -30,5 +31,5 @@ require (
 	golang.org/x/text v0.3.4 // indirect
 	golang.org/x/tools v0.0.0-20201116002733-ac45abd4c88c // indirect
 	google.golang.org/grpc v1.26.0
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,254 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package key
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Range is the key range [StartKey, EndKey). An empty EndKey means the range
+// is unbounded, i.e. it contains all keys that >= StartKey.
+type Range struct {
+	StartKey Key
+	EndKey   Key
+}
+
+// PrefixRange returns the range that contains all keys with the prefix. If
+// there is no key greater than all keys with the prefix (the prefix is empty or
+// consists of 0xff only), the returned range is unbounded.
+func PrefixRange(prefix Key) Range {
+	r := Range{StartKey: prefix.Clone()}
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			r.EndKey = append(prefix[:i:i].Clone(), prefix[i]+1)
+			break
+		}
+	}
+	return r
+}
+
+// compareEnd compares two end keys, where an empty key is greater than any
+// other key.
+func compareEnd(a, b Key) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+	return bytes.Compare(a, b)
+}
+
+// Unbounded returns whether the range has no end key.
+func (r Range) Unbounded() bool {
+	return len(r.EndKey) == 0
+}
+
+// IsEmpty returns whether the range contains no key.
+func (r Range) IsEmpty() bool {
+	return !r.Unbounded() && bytes.Compare(r.StartKey, r.EndKey) >= 0
+}
+
+// Contains returns whether the key is in the range.
+func (r Range) Contains(k Key) bool {
+	return bytes.Compare(r.StartKey, k) <= 0 && (r.Unbounded() || bytes.Compare(k, r.EndKey) < 0)
+}
+
+// ContainsRange returns whether all keys of another range are in the range.
+func (r Range) ContainsRange(another Range) bool {
+	if another.IsEmpty() {
+		return true
+	}
+	return bytes.Compare(r.StartKey, another.StartKey) <= 0 && compareEnd(another.EndKey, r.EndKey) <= 0
+}
+
+// Overlaps returns whether the two ranges have any key in common.
+func (r Range) Overlaps(another Range) bool {
+	return !r.Intersect(another).IsEmpty()
+}
+
+// Intersect returns the keys that are in both ranges. The result may be empty,
+// check it with IsEmpty.
+func (r Range) Intersect(another Range) Range {
+	res := r
+	if bytes.Compare(another.StartKey, res.StartKey) > 0 {
+		res.StartKey = another.StartKey
+	}
+	if compareEnd(another.EndKey, res.EndKey) < 0 {
+		res.EndKey = another.EndKey
+	}
+	if res.IsEmpty() {
+		return Range{StartKey: res.StartKey, EndKey: res.StartKey}
+	}
+	return res
+}
+
+// SplitAt splits the range by the keys. Keys out of the range or equal to
+// StartKey are ignored.
+func (r Range) SplitAt(keys ...Key) []Range {
+	if r.IsEmpty() {
+		return nil
+	}
+	sorted := make([]Key, 0, len(keys))
+	for _, k := range keys {
+		if r.Contains(k) && !bytes.Equal(k, r.StartKey) {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	ranges := make([]Range, 0, len(sorted)+1)
+	start := r.StartKey
+	for _, k := range sorted {
+		if bytes.Equal(k, start) {
+			continue
+		}
+		ranges = append(ranges, Range{StartKey: start, EndKey: k})
+		start = k
+	}
+	return append(ranges, Range{StartKey: start, EndKey: r.EndKey})
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("[%q, %q)", []byte(r.StartKey), []byte(r.EndKey))
+}
+
+// RangeSet is a set of keys which is kept as sorted, non-overlapping and
+// non-adjacent ranges. The zero value is an empty set. A RangeSet is never
+// modified after creation, all operations return a new one.
+type RangeSet struct {
+	ranges []Range
+}
+
+// NewRangeSet creates a RangeSet with the union of the ranges.
+func NewRangeSet(ranges ...Range) RangeSet {
+	sorted := make([]Range, 0, len(ranges))
+	for _, r := range ranges {
+		if !r.IsEmpty() {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].StartKey, sorted[j].StartKey) < 0 })
+
+	var s RangeSet
+	for _, r := range sorted {
+		n := len(s.ranges)
+		if n > 0 {
+			last := &s.ranges[n-1]
+			if last.Unbounded() {
+				break
+			}
+			if bytes.Compare(r.StartKey, last.EndKey) <= 0 {
+				if compareEnd(r.EndKey, last.EndKey) > 0 {
+					last.EndKey = r.EndKey
+				}
+				continue
+			}
+		}
+		s.ranges = append(s.ranges, r)
+	}
+	return s
+}
+
+// Ranges returns the sorted ranges of the set.
+func (s RangeSet) Ranges() []Range {
+	return append([]Range(nil), s.ranges...)
+}
+
+// IsEmpty returns whether the set contains no key.
+func (s RangeSet) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+// Contains returns whether the key is in the set.
+func (s RangeSet) Contains(k Key) bool {
+	// Find the last range whose StartKey <= k.
+	i := sort.Search(len(s.ranges), func(i int) bool { return bytes.Compare(s.ranges[i].StartKey, k) > 0 })
+	return i > 0 && s.ranges[i-1].Contains(k)
+}
+
+// Union returns the keys that are in either set.
+func (s RangeSet) Union(another RangeSet) RangeSet {
+	return NewRangeSet(append(s.Ranges(), another.ranges...)...)
+}
+
+// Intersect returns the keys that are in both sets.
+func (s RangeSet) Intersect(another RangeSet) RangeSet {
+	var res RangeSet
+	for i, j := 0, 0; i < len(s.ranges) && j < len(another.ranges); {
+		a, b := s.ranges[i], another.ranges[j]
+		if r := a.Intersect(b); !r.IsEmpty() {
+			res.ranges = append(res.ranges, r)
+		}
+		if compareEnd(a.EndKey, b.EndKey) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return res
+}
+
+// Subtract returns the keys that are in the set but not in another.
+func (s RangeSet) Subtract(another RangeSet) RangeSet {
+	var res RangeSet
+	j := 0
+	for _, r := range s.ranges {
+		cur := r
+		// Skip ranges of another that end before cur.
+		for j < len(another.ranges) && !another.ranges[j].Unbounded() && bytes.Compare(another.ranges[j].EndKey, cur.StartKey) <= 0 {
+			j++
+		}
+		for k := j; k < len(another.ranges) && !cur.IsEmpty(); k++ {
+			o := another.ranges[k]
+			if !cur.Unbounded() && bytes.Compare(o.StartKey, cur.EndKey) >= 0 {
+				break
+			}
+			if bytes.Compare(o.StartKey, cur.StartKey) > 0 {
+				res.ranges = append(res.ranges, Range{StartKey: cur.StartKey, EndKey: o.StartKey})
+			}
+			if o.Unbounded() {
+				cur.EndKey = cur.StartKey
+				break
+			}
+			cur.StartKey = o.EndKey
+		}
+		if !cur.IsEmpty() {
+			res.ranges = append(res.ranges, cur)
+		}
+	}
+	return res
+}
+
+// SplitAt splits the ranges of the set by the keys.
+func (s RangeSet) SplitAt(keys ...Key) []Range {
+	var ranges []Range
+	for _, r := range s.ranges {
+		ranges = append(ranges, r.SplitAt(keys...)...)
+	}
+	return ranges
+}
+
+func (s RangeSet) String() string {
+	strs := make([]string, 0, len(s.ranges))
+	for _, r := range s.ranges {
+		strs = append(strs, r.String())
+	}
+	return "{" + strings.Join(strs, ", ") + "}"
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package key
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testRangeSuite struct{}
+
+var _ = Suite(&testRangeSuite{})
+
+func r(start, end string) Range {
+	return Range{StartKey: Key(start), EndKey: Key(end)}
+}
+
+func (s *testRangeSuite) TestPrefixRange(c *C) {
+	c.Assert(PrefixRange(Key("ab")), DeepEquals, r("ab", "ac"))
+	c.Assert(PrefixRange(Key("a\xff")), DeepEquals, r("a\xff", "b"))
+	c.Assert(PrefixRange(Key("\xff\xff")).Unbounded(), IsTrue)
+	c.Assert(PrefixRange(nil).Unbounded(), IsTrue)
+	c.Assert(PrefixRange(Key("\xff")).Contains(Key("\xff\xff\xff")), IsTrue)
+}
+
+func (s *testRangeSuite) TestRange(c *C) {
+	c.Assert(r("b", "d").Contains(Key("b")), IsTrue)
+	c.Assert(r("b", "d").Contains(Key("d")), IsFalse)
+	c.Assert(r("b", "").Contains(Key("zzz")), IsTrue)
+	c.Assert(r("b", "b").IsEmpty(), IsTrue)
+	c.Assert(r("", "").IsEmpty(), IsFalse)
+
+	c.Assert(r("b", "").ContainsRange(r("c", "d")), IsTrue)
+	c.Assert(r("b", "e").ContainsRange(r("c", "")), IsFalse)
+	c.Assert(r("b", "e").ContainsRange(r("z", "a")), IsTrue)
+
+	c.Assert(r("b", "e").Intersect(r("c", "")), DeepEquals, r("c", "e"))
+	c.Assert(r("b", "").Intersect(r("", "")), DeepEquals, r("b", ""))
+	c.Assert(r("b", "c").Intersect(r("c", "")).IsEmpty(), IsTrue)
+	c.Assert(r("b", "c").Overlaps(r("a", "b")), IsFalse)
+	c.Assert(r("b", "c").Overlaps(r("a", "b\x00")), IsTrue)
+
+	c.Assert(r("b", "").SplitAt(Key("d"), Key("a"), Key("b"), Key("c"), Key("d")), DeepEquals,
+		[]Range{r("b", "c"), r("c", "d"), r("d", "")})
+	c.Assert(r("b", "d").SplitAt(Key("d")), DeepEquals, []Range{r("b", "d")})
+	c.Assert(r("b", "b").SplitAt(Key("b")), HasLen, 0)
+}
+
+func (s *testRangeSuite) TestRangeSet(c *C) {
+	set := NewRangeSet(r("e", "f"), r("a", "b"), r("b", "c"), r("x", "x"), r("d", "e\x00"))
+	c.Assert(set.Ranges(), DeepEquals, []Range{r("a", "c"), r("d", "f")})
+	c.Assert(set.Contains(Key("b")), IsTrue)
+	c.Assert(set.Contains(Key("c")), IsFalse)
+	c.Assert(set.Contains(Key("")), IsFalse)
+	c.Assert(NewRangeSet(r("c", ""), r("a", "b"), r("d", "e")).Ranges(), DeepEquals, []Range{r("a", "b"), r("c", "")})
+	c.Assert(RangeSet{}.IsEmpty(), IsTrue)
+
+	other := NewRangeSet(r("b", "d\x00"), r("e", ""))
+	c.Assert(set.Union(other).Ranges(), DeepEquals, []Range{r("a", "")})
+	c.Assert(set.Intersect(other).Ranges(), DeepEquals, []Range{r("b", "c"), r("d", "d\x00"), r("e", "f")})
+	c.Assert(set.Subtract(other).Ranges(), DeepEquals, []Range{r("a", "b"), r("d\x00", "e")})
+	c.Assert(other.Subtract(set).Ranges(), DeepEquals, []Range{r("c", "d"), r("f", "")})
+	c.Assert(NewRangeSet(r("", "")).Subtract(NewRangeSet(r("b", "c"))).Ranges(), DeepEquals, []Range{r("", "b"), r("c", "")})
+	c.Assert(set.Subtract(NewRangeSet(r("", ""))).IsEmpty(), IsTrue)
+
+	c.Assert(set.SplitAt(Key("b"), Key("e")), DeepEquals, []Range{r("a", "b"), r("b", "c"), r("d", "e"), r("e", "f")})
+}
@@ -47,6 +47,25 @@ func (c *CodecPDClient) GetRegionByID(ctx context.Context, regionID uint64) (*pd
 	return processRegionResult(region, err)
 }
 
+// ScanRegions encodes the keys before send requests to pd-server and decodes
+// the returned StartKey && EndKey from pd-server.
+func (c *CodecPDClient) ScanRegions(ctx context.Context, startKey, endKey []byte, limit int) ([]*pd.Region, error) {
+	startKey = codec.EncodeBytes(startKey)
+	if len(endKey) > 0 {
+		endKey = codec.EncodeBytes(endKey)
+	}
+	regions, err := c.Client.ScanRegions(ctx, startKey, endKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range regions {
+		if _, err := processRegionResult(region, nil); err != nil {
+			return nil, err
+		}
+	}
+	return regions, nil
+}
+
 func processRegionResult(region *pd.Region, err error) (*pd.Region, error) {
 	if err != nil {
 		return nil, err
@@ -0,0 +1,36 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	pd "github.com/tikv/pd/client"
+)
+
+// NewPDClient creates a PD client that connects to PD with the CA, cert and
+// key files in the security config. The PD client only loads the credentials
+// from files, so it returns an error if TLS is configured only by PEMs or a
+// CredentialProvider. The identity restrictions, TLS version and cipher
+// suites are not applied to the connections to PD.
+func NewPDClient(pdAddrs []string, security *config.Security) (pd.Client, error) {
+	if security.CredentialProvider != nil || len(security.SSLCAPEM) != 0 || len(security.SSLCertPEM) != 0 || len(security.SSLKeyPEM) != 0 {
+		return nil, errors.New("the PD client only supports the CA, cert and key files, PEMs and credential providers can not be used")
+	}
+	return pd.NewClient(pdAddrs, pd.SecurityOption{
+		CAPath:   security.SSLCA,
+		CertPath: security.SSLCert,
+		KeyPath:  security.SSLKey,
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	. "github.com/pingcap/check"
+	"github.com/tikv/client-go/config"
+	. "github.com/tikv/client-go/locate"
+)
+
+type testPDClientSuite struct{}
+
+var _ = Suite(&testPDClientSuite{})
+
+type emptyProvider struct{}
+
+func (emptyProvider) RootCAs() (*x509.CertPool, error)             { return x509.NewCertPool(), nil }
+func (emptyProvider) ClientCertificate() (*tls.Certificate, error) { return nil, nil }
+
+func (s *testPDClientSuite) TestUnsupportedSecurity(c *C) {
+	for _, sec := range []config.Security{
+		{SSLCAPEM: "ca"},
+		{SSLCA: "ca.pem", SSLCertPEM: "cert", SSLKeyPEM: "key"},
+		{CredentialProvider: emptyProvider{}},
+	} {
+		_, err := NewPDClient([]string{"127.0.0.1:2379"}, &sec)
+		c.Assert(err, ErrorMatches, "the PD client only supports the CA, cert and key files.*")
+	}
+}
@@ -27,6 +27,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/tikv/client-go/codec"
 	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
 	"github.com/tikv/client-go/metrics"
 	"github.com/tikv/client-go/retry"
 	pd "github.com/tikv/pd/client"
@@ -58,6 +59,11 @@ type RegionCache struct {
 		sync.RWMutex
 		stores map[uint64]*Store
 	}
+	health *storeHealthTracker
+
+	// retryBudget is shared by the requests sent with the RegionCache, which
+	// are the requests of a client.
+	retryBudget *retry.RetryBudget
 }
 
 // NewRegionCache creates a RegionCache.
@@ -65,6 +71,7 @@ func NewRegionCache(pdClient pd.Client, conf *config.RegionCache) *RegionCache {
 	c := &RegionCache{
 		conf:     conf,
 		pdClient: pdClient,
+		health:   newStoreHealthTracker(conf.StoreFailureThreshold, conf.StoreDownCoolDown),
 	}
 	c.mu.regions = make(map[RegionVerID]*CachedRegion)
 	c.mu.sorted = btree.New(conf.BTreeDegree)
@@ -72,12 +79,21 @@ func NewRegionCache(pdClient pd.Client, conf *config.RegionCache) *RegionCache {
 	return c
 }
 
+// Localities of the stores that requests are sent to.
+const (
+	LocalityLocal     = "local"
+	LocalityCrossZone = "cross_zone"
+)
+
 // RPCContext contains data that is needed to send RPC to a region.
 type RPCContext struct {
 	Region RegionVerID
 	Meta   *metapb.Region
 	Peer   *metapb.Peer
 	Addr   string
+	// Locality is LocalityLocal or LocalityCrossZone if the client has labels,
+	// otherwise it is empty.
+	Locality string
 }
 
 // GetStoreID returns StoreID.
@@ -90,7 +106,11 @@ func (c *RPCContext) GetStoreID() uint64 {
 
 // GetRPCContext returns RPCContext for a region. If it returns nil, the region
 // must be out of date and already dropped from cache.
-func (c *RegionCache) GetRPCContext(bo *retry.Backoffer, id RegionVerID) (*RPCContext, error) {
+//
+// For follower reads, the peer is picked by seed among the followers (or all
+// peers for ReplicaReadMixed), so callers can rotate the replicas by changing
+// the seed. The leader is used if there is no peer to pick from.
+func (c *RegionCache) GetRPCContext(bo *retry.Backoffer, id RegionVerID, replicaRead ReplicaReadType, seed uint32) (*RPCContext, error) {
 	c.mu.RLock()
 	region := c.getCachedRegion(id)
 	if region == nil {
@@ -104,23 +124,94 @@ func (c *RegionCache) GetRPCContext(bo *retry.Backoffer, id RegionVerID) (*RPCCo
 	meta, peer := region.meta, region.peer
 	c.mu.RUnlock()
 
-	addr, err := c.GetStoreAddr(bo, peer.GetStoreId())
+	var err error
+	switch replicaRead {
+	case ReplicaReadFollower:
+		if followers := followerPeers(meta, peer); len(followers) > 0 {
+			peer, err = c.selectPeer(bo, followers, seed)
+		}
+	case ReplicaReadMixed:
+		if peers := meta.GetPeers(); len(peers) > 0 {
+			peer, err = c.selectPeer(bo, peers, seed)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	if addr == "" {
+
+	store, err := c.GetStore(bo, peer.GetStoreId())
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
 		// Store not found, region must be out of date.
 		c.DropRegion(id)
 		return nil, nil
 	}
 	return &RPCContext{
-		Region: id,
-		Meta:   meta,
-		Peer:   peer,
-		Addr:   addr,
+		Region:   id,
+		Meta:     meta,
+		Peer:     peer,
+		Addr:     store.Addr,
+		Locality: c.storeLocality(store),
 	}, nil
 }
 
+// selectPeer picks a peer by seed. Peers on down stores are skipped, and peers
+// on the stores that match the labels of the client are preferred. The others
+// are only used if there is no such peer.
+func (c *RegionCache) selectPeer(bo *retry.Backoffer, peers []*metapb.Peer, seed uint32) (*metapb.Peer, error) {
+	alive := make([]*metapb.Peer, 0, len(peers))
+	for _, p := range peers {
+		if c.health.available(p.GetStoreId()) {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) > 0 {
+		peers = alive
+	}
+	if len(c.conf.Labels) > 0 {
+		local := make([]*metapb.Peer, 0, len(peers))
+		for _, p := range peers {
+			store, err := c.GetStore(bo, p.GetStoreId())
+			if err != nil {
+				return nil, err
+			}
+			if store != nil && store.MatchLabels(c.conf.Labels) {
+				local = append(local, p)
+			}
+		}
+		if len(local) > 0 {
+			peers = local
+		}
+	}
+	return peers[seed%uint32(len(peers))], nil
+}
+
+// storeLocality returns whether the store matches the labels of the client. It
+// returns an empty string if the client has no label.
+func (c *RegionCache) storeLocality(store *Store) string {
+	if len(c.conf.Labels) == 0 {
+		return ""
+	}
+	if store.MatchLabels(c.conf.Labels) {
+		return LocalityLocal
+	}
+	return LocalityCrossZone
+}
+
+// followerPeers returns the peers of the region except the leader. Learners
+// are included.
+func followerPeers(meta *metapb.Region, leader *metapb.Peer) []*metapb.Peer {
+	followers := make([]*metapb.Peer, 0, len(meta.GetPeers()))
+	for _, p := range meta.GetPeers() {
+		if p.GetStoreId() != leader.GetStoreId() {
+			followers = append(followers, p)
+		}
+	}
+	return followers
+}
+
 // KeyLocation is the region and range that a key is located.
 type KeyLocation struct {
 	Region   RegionVerID
@@ -136,18 +227,9 @@ func (l *KeyLocation) Contains(key []byte) bool {
 
 // LocateKey searches for the region and range that the key is located.
 func (c *RegionCache) LocateKey(bo *retry.Backoffer, key []byte) (*KeyLocation, error) {
-	c.mu.RLock()
-	r := c.searchCachedRegion(key)
-	if r != nil {
-		loc := &KeyLocation{
-			Region:   r.VerID(),
-			StartKey: r.StartKey(),
-			EndKey:   r.EndKey(),
-		}
-		c.mu.RUnlock()
+	if loc := c.locateKeyFromCache(key); loc != nil {
 		return loc, nil
 	}
-	c.mu.RUnlock()
 
 	r, err := c.loadRegion(bo, key)
 	if err != nil {
@@ -165,6 +247,112 @@ func (c *RegionCache) LocateKey(bo *retry.Backoffer, key []byte) (*KeyLocation,
 	}, nil
 }
 
+func (c *RegionCache) locateKeyFromCache(key []byte) *KeyLocation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := c.searchCachedRegion(key)
+	if r == nil {
+		return nil
+	}
+	return &KeyLocation{
+		Region:   r.VerID(),
+		StartKey: r.StartKey(),
+		EndKey:   r.EndKey(),
+	}
+}
+
+// prefetchMissThreshold is the number of consecutive cache misses after which
+// a RangeLocator loads the following regions in batch.
+const prefetchMissThreshold = 2
+
+// RangeLocator locates keys of a range in ascending order. When it sees
+// consecutive cache misses, which usually means the cache is cold, it loads
+// the following regions of the range in batch instead of one by one.
+type RangeLocator struct {
+	cache  *RegionCache
+	endKey []byte
+	misses int
+	// prefetch is set once the cache is found cold. From then on, every miss
+	// loads the next batch.
+	prefetch bool
+}
+
+// NewRangeLocator creates a RangeLocator for keys before endKey. An empty
+// endKey means unbounded.
+func (c *RegionCache) NewRangeLocator(endKey []byte) *RangeLocator {
+	return &RangeLocator{cache: c, endKey: endKey}
+}
+
+// LocateKey searches for the region and range that the key is located.
+func (l *RangeLocator) LocateKey(bo *retry.Backoffer, key []byte) (*KeyLocation, error) {
+	if loc := l.cache.locateKeyFromCache(key); loc != nil {
+		l.misses = 0
+		return loc, nil
+	}
+	l.misses++
+	if l.misses >= prefetchMissThreshold {
+		l.prefetch = true
+	}
+	if l.prefetch && (len(l.endKey) == 0 || bytes.Compare(key, l.endKey) < 0) {
+		if _, err := l.cache.loadRegionsBatch(bo, key, l.endKey); err != nil {
+			return nil, err
+		}
+	}
+	return l.cache.LocateKey(bo, key)
+}
+
+// LoadRegionsInRange loads the regions that overlap with [startKey, endKey)
+// from PD in batches, and puts them into the cache. An empty endKey means
+// unbounded.
+func (c *RegionCache) LoadRegionsInRange(bo *retry.Backoffer, startKey, endKey []byte) error {
+	for {
+		nextKey, err := c.loadRegionsBatch(bo, startKey, endKey)
+		if err != nil || nextKey == nil {
+			return err
+		}
+		startKey = nextKey
+	}
+}
+
+// Warmup loads all the regions into the cache if it is enabled in config. A
+// failure is only logged, because regions are loaded on demand anyway. The
+// retries follow the OpWarmupRegionCache policy of retryConf and ctx.
+func (c *RegionCache) Warmup(ctx context.Context, retryConf *config.Retry) {
+	if !c.conf.Warmup {
+		return
+	}
+	bo := retry.NewBackofferWithConfig(ctx, retryConf, retry.OpWarmupRegionCache)
+	if err := c.LoadRegionsInRange(bo, nil, nil); err != nil {
+		log.Warnf("regionCache: warmup failed, err: %v", err)
+	}
+}
+
+// loadRegionsBatch loads at most ScanRegionsLimit regions from startKey. It
+// returns the key to continue from, or nil if there is no more region in the
+// range.
+func (c *RegionCache) loadRegionsBatch(bo *retry.Backoffer, startKey, endKey []byte) ([]byte, error) {
+	limit := c.conf.ScanRegionsLimit
+	if limit <= 0 {
+		limit = config.DefaultRegionCache().ScanRegionsLimit
+	}
+	regions, err := c.scanRegions(bo, startKey, endKey, limit)
+	if err != nil || len(regions) == 0 {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for _, r := range regions {
+		c.insertRegionToCache(r)
+	}
+	c.mu.Unlock()
+
+	nextKey := regions[len(regions)-1].EndKey()
+	if len(regions) < limit || len(nextKey) == 0 || (len(endKey) > 0 && bytes.Compare(nextKey, endKey) >= 0) {
+		return nil, nil
+	}
+	return nextKey, nil
+}
+
 // LocateRegionByID searches for the region with ID.
 func (c *RegionCache) LocateRegionByID(bo *retry.Backoffer, regionID uint64) (*KeyLocation, error) {
 	c.mu.RLock()
@@ -202,10 +390,15 @@ func (c *RegionCache) GroupKeysByRegion(bo *retry.Backoffer, keys [][]byte) (map
 	groups := make(map[RegionVerID][][]byte)
 	var first RegionVerID
 	var lastLoc *KeyLocation
+	// Keys are usually sorted, so the regions are prefetched up to the last key.
+	var locator *RangeLocator
+	if len(keys) > 0 {
+		locator = c.NewRangeLocator(key.Key(keys[len(keys)-1]).Next())
+	}
 	for i, k := range keys {
 		if lastLoc == nil || !lastLoc.Contains(k) {
 			var err error
-			lastLoc, err = c.LocateKey(bo, k)
+			lastLoc, err = locator.LocateKey(bo, k)
 			if err != nil {
 				return nil, first, err
 			}
@@ -219,15 +412,31 @@ func (c *RegionCache) GroupKeysByRegion(bo *retry.Backoffer, keys [][]byte) (map
 	return groups, first, nil
 }
 
-// ListRegionIDsInKeyRange lists ids of regions in [start_key,end_key].
+// ListRegionIDsInKeyRange lists ids of regions in [start_key,end_key]. An empty
+// end_key means the range is unbounded.
 func (c *RegionCache) ListRegionIDsInKeyRange(bo *retry.Backoffer, startKey, endKey []byte) (regionIDs []uint64, err error) {
+	r := key.Range{StartKey: startKey}
+	if len(endKey) > 0 {
+		r.EndKey = key.Key(endKey).Next()
+	}
+	return c.ListRegionIDsInRange(bo, r)
+}
+
+// ListRegionIDsInRange lists ids of regions that overlap with the range
+// [StartKey, EndKey).
+func (c *RegionCache) ListRegionIDsInRange(bo *retry.Backoffer, r key.Range) (regionIDs []uint64, err error) {
+	if r.IsEmpty() {
+		return nil, nil
+	}
+	startKey := r.StartKey
+	locator := c.NewRangeLocator(r.EndKey)
 	for {
-		curRegion, err := c.LocateKey(bo, startKey)
+		curRegion, err := locator.LocateKey(bo, startKey)
 		if err != nil {
 			return nil, err
 		}
 		regionIDs = append(regionIDs, curRegion.Region.id)
-		if curRegion.Contains(endKey) {
+		if len(curRegion.EndKey) == 0 || !r.Contains(curRegion.EndKey) {
 			break
 		}
 		startKey = curRegion.EndKey
@@ -359,6 +568,41 @@ func (c *RegionCache) loadRegion(bo *retry.Backoffer, key []byte) (*Region, erro
 	}
 }
 
+// scanRegions loads at most limit regions in [startKey, endKey) from pd
+// client, and picks the first peer as leader if the leader is unknown.
+func (c *RegionCache) scanRegions(bo *retry.Backoffer, startKey, endKey []byte, limit int) ([]*Region, error) {
+	var backoffErr error
+	for {
+		if backoffErr != nil {
+			err := bo.Backoff(retry.BoPDRPC, backoffErr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		regions, err := c.pdClient.ScanRegions(bo.GetContext(), startKey, endKey, limit)
+		metrics.RegionCacheCounter.WithLabelValues("scan_regions", metrics.RetLabel(err)).Inc()
+		if err != nil {
+			backoffErr = errors.Errorf("scanRegions from PD failed, startKey: %q, endKey: %q, err: %v", startKey, endKey, err)
+			continue
+		}
+		rs := make([]*Region, 0, len(regions))
+		for _, region := range regions {
+			if region.Meta == nil || len(region.Meta.Peers) == 0 {
+				return nil, errors.New("receive Region with no peer")
+			}
+			r := &Region{
+				meta: region.Meta,
+				peer: region.Meta.Peers[0],
+			}
+			if region.Leader != nil {
+				r.SwitchPeer(region.Leader.GetStoreId())
+			}
+			rs = append(rs, r)
+		}
+		return rs, nil
+	}
+}
+
 // loadRegionByID loads region from pd client, and picks the first peer as leader.
 func (c *RegionCache) loadRegionByID(bo *retry.Backoffer, regionID uint64) (*Region, error) {
 	var backoffErr error
@@ -396,29 +640,62 @@ func (c *RegionCache) loadRegionByID(bo *retry.Backoffer, regionID uint64) (*Reg
 // GetStoreAddr returns a tikv server's address by its storeID. It checks cache
 // first, sends request to pd server when necessary.
 func (c *RegionCache) GetStoreAddr(bo *retry.Backoffer, id uint64) (string, error) {
+	store, err := c.GetStore(bo, id)
+	if err != nil || store == nil {
+		return "", err
+	}
+	return store.Addr, nil
+}
+
+// GetStore returns a tikv server by its storeID. It checks cache first, sends
+// request to pd server when necessary. It returns nil if the store is not
+// found.
+func (c *RegionCache) GetStore(bo *retry.Backoffer, id uint64) (*Store, error) {
 	c.storeMu.RLock()
 	if store, ok := c.storeMu.stores[id]; ok {
 		c.storeMu.RUnlock()
-		return store.Addr, nil
+		return store, nil
 	}
 	c.storeMu.RUnlock()
-	return c.ReloadStoreAddr(bo, id)
+	return c.reloadStore(bo, id)
 }
 
 // ReloadStoreAddr reloads store's address.
 func (c *RegionCache) ReloadStoreAddr(bo *retry.Backoffer, id uint64) (string, error) {
-	addr, err := c.loadStoreAddr(bo, id)
-	if err != nil || addr == "" {
+	store, err := c.reloadStore(bo, id)
+	if err != nil || store == nil {
 		return "", err
 	}
+	return store.Addr, nil
+}
+
+func (c *RegionCache) reloadStore(bo *retry.Backoffer, id uint64) (*Store, error) {
+	meta, err := c.loadStore(bo, id)
+	if err != nil || meta == nil || meta.GetAddress() == "" {
+		return nil, err
+	}
 
+	store := &Store{
+		ID:     id,
+		Addr:   meta.GetAddress(),
+		Labels: meta.GetLabels(),
+	}
 	c.storeMu.Lock()
 	defer c.storeMu.Unlock()
-	c.storeMu.stores[id] = &Store{
-		ID:   id,
-		Addr: addr,
-	}
-	return addr, nil
+	c.storeMu.stores[id] = store
+	return store, nil
+}
+
+// SetRetryBudget sets the retry budget of the requests sent with the
+// RegionCache.
+func (c *RegionCache) SetRetryBudget(budget *retry.RetryBudget) {
+	c.retryBudget = budget
+}
+
+// RetryBudget returns the retry budget of the requests sent with the
+// RegionCache. It is nil if there is no limit.
+func (c *RegionCache) RetryBudget() *retry.RetryBudget {
+	return c.retryBudget
 }
 
 // ClearStoreByID clears store from cache with storeID.
@@ -428,24 +705,21 @@ func (c *RegionCache) ClearStoreByID(id uint64) {
 	delete(c.storeMu.stores, id)
 }
 
-func (c *RegionCache) loadStoreAddr(bo *retry.Backoffer, id uint64) (string, error) {
+func (c *RegionCache) loadStore(bo *retry.Backoffer, id uint64) (*metapb.Store, error) {
 	for {
 		store, err := c.pdClient.GetStore(bo.GetContext(), id)
 		metrics.RegionCacheCounter.WithLabelValues("get_store", metrics.RetLabel(err)).Inc()
 		if err != nil {
 			if errors.Cause(err) == context.Canceled {
-				return "", err
+				return nil, retry.Classify(err, retry.ErrContextCanceled)
 			}
 			err = errors.Errorf("loadStore from PD failed, id: %d, err: %v", id, err)
 			if err = bo.Backoff(retry.BoPDRPC, err); err != nil {
-				return "", err
+				return nil, err
 			}
 			continue
 		}
-		if store == nil {
-			return "", nil
-		}
-		return store.GetAddress(), nil
+		return store, nil
 	}
 }
 
@@ -455,6 +729,7 @@ func (c *RegionCache) DropStoreOnSendRequestFail(ctx *RPCContext, err error) {
 	// Because too many concurrently requests trying to drop the store will be blocked on the lock.
 	failedRegionID := ctx.Region
 	failedStoreID := ctx.Peer.StoreId
+	c.health.onFailure(failedStoreID, ctx.Addr)
 	c.mu.Lock()
 	_, ok := c.mu.regions[failedRegionID]
 	if !ok {
@@ -604,8 +879,26 @@ func (r *Region) Contains(key []byte) bool {
 		(bytes.Compare(key, r.meta.GetEndKey()) < 0 || len(r.meta.GetEndKey()) == 0)
 }
 
-// Store contains a tikv server's address.
+// Store contains a tikv server's address and labels.
 type Store struct {
-	ID   uint64
-	Addr string
+	ID     uint64
+	Addr   string
+	Labels []*metapb.StoreLabel
+}
+
+// MatchLabels checks if the store has all the labels.
+func (s *Store) MatchLabels(labels map[string]string) bool {
+	for k, v := range labels {
+		var matched bool
+		for _, l := range s.Labels {
+			if l.GetKey() == k && l.GetValue() == v {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
 }
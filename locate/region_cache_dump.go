@@ -0,0 +1,128 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/btree"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// regionCacheDumpVersion is the version of the format written by Dump. It
+// should be increased when the format changes incompatibly.
+const regionCacheDumpVersion = 1
+
+type regionCacheDump struct {
+	Version int          `json:"version"`
+	Regions []regionDump `json:"regions"`
+	Stores  []storeDump  `json:"stores"`
+}
+
+// regionDump is a cached region. The region version is kept in the epoch of
+// Meta.
+type regionDump struct {
+	Meta *metapb.Region `json:"meta"`
+	// PeerStoreID is the store of the peer that requests are sent to.
+	PeerStoreID uint64 `json:"peer_store_id"`
+}
+
+type storeDump struct {
+	ID     uint64               `json:"id"`
+	Addr   string               `json:"addr"`
+	Labels []*metapb.StoreLabel `json:"labels,omitempty"`
+}
+
+// Dump writes the cached regions and stores to w, so a restarted client can
+// Load them instead of querying PD region by region.
+func (c *RegionCache) Dump(w io.Writer) error {
+	dump := regionCacheDump{Version: regionCacheDumpVersion}
+
+	c.mu.RLock()
+	c.mu.sorted.Ascend(func(item btree.Item) bool {
+		r := item.(*btreeItem).region
+		if c.getCachedRegion(r.VerID()) != nil {
+			dump.Regions = append(dump.Regions, regionDump{
+				Meta:        r.meta,
+				PeerStoreID: r.peer.GetStoreId(),
+			})
+		}
+		return true
+	})
+	c.mu.RUnlock()
+
+	c.storeMu.RLock()
+	for _, s := range c.storeMu.stores {
+		dump.Stores = append(dump.Stores, storeDump{
+			ID:     s.ID,
+			Addr:   s.Addr,
+			Labels: s.Labels,
+		})
+	}
+	c.storeMu.RUnlock()
+
+	return errors.WithStack(json.NewEncoder(w).Encode(&dump))
+}
+
+// Load reads regions and stores written by Dump into the cache. Entries that
+// are already cached are kept, as they are likely newer. The loaded regions
+// may be stale, they are corrected by the region errors of the first requests
+// sent to them, just like regions that become stale in the cache.
+func (c *RegionCache) Load(r io.Reader) error {
+	var dump regionCacheDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return errors.WithStack(err)
+	}
+	if dump.Version != regionCacheDumpVersion {
+		return errors.Errorf("unsupported region cache dump version %d", dump.Version)
+	}
+	for _, r := range dump.Regions {
+		if r.Meta == nil || len(r.Meta.GetPeers()) == 0 {
+			return errors.Errorf("invalid region in region cache dump: %v", r.Meta)
+		}
+	}
+
+	c.storeMu.Lock()
+	for _, s := range dump.Stores {
+		if _, ok := c.storeMu.stores[s.ID]; !ok {
+			c.storeMu.stores[s.ID] = &Store{
+				ID:     s.ID,
+				Addr:   s.Addr,
+				Labels: s.Labels,
+			}
+		}
+	}
+	c.storeMu.Unlock()
+
+	var loaded int
+	c.mu.Lock()
+	for _, r := range dump.Regions {
+		if c.searchCachedRegion(r.Meta.GetStartKey()) != nil {
+			continue
+		}
+		region := &Region{
+			meta: r.Meta,
+			peer: r.Meta.Peers[0],
+		}
+		region.SwitchPeer(r.PeerStoreID)
+		c.insertRegionToCache(region)
+		loaded++
+	}
+	c.mu.Unlock()
+	log.Infof("regionCache: loaded %d regions and %d stores from dump", loaded, len(dump.Stores))
+	return nil
+}
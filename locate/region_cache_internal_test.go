@@ -0,0 +1,56 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/retry"
+	pd "github.com/tikv/pd/client"
+)
+
+// storePDClient serves a store only.
+type storePDClient struct {
+	pd.Client
+	store *metapb.Store
+}
+
+func (c *storePDClient) GetStore(ctx context.Context, storeID uint64) (*metapb.Store, error) {
+	return c.store, nil
+}
+
+type testRegionCacheInternalSuite struct{}
+
+var _ = Suite(&testRegionCacheInternalSuite{})
+
+func (s *testRegionCacheInternalSuite) TestReplicaReadWithoutPeers(c *C) {
+	conf := config.DefaultRegionCache()
+	cache := NewRegionCache(&storePDClient{store: &metapb.Store{Id: 1, Address: "store1"}}, &conf)
+	bo := retry.NewBackoffer(context.Background(), 5000)
+
+	// A region whose peer list is empty falls back to the leader.
+	leader := &metapb.Peer{Id: 2, StoreId: 1}
+	region := &Region{meta: &metapb.Region{Id: 3, RegionEpoch: &metapb.RegionEpoch{}}, peer: leader}
+	cache.mu.Lock()
+	cache.insertRegionToCache(region)
+	cache.mu.Unlock()
+	for _, replicaRead := range []ReplicaReadType{ReplicaReadFollower, ReplicaReadMixed} {
+		ctx, err := cache.GetRPCContext(bo, region.VerID(), replicaRead, 1)
+		c.Assert(err, IsNil)
+		c.Assert(ctx.Peer, Equals, leader)
+	}
+}
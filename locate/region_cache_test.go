@@ -0,0 +1,181 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate_test
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	. "github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
+	pd "github.com/tikv/pd/client"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+// countPDClient counts the region requests sent to PD.
+type countPDClient struct {
+	pd.Client
+	getRegion   int32
+	scanRegions int32
+}
+
+func (c *countPDClient) GetRegion(ctx context.Context, key []byte) (*pd.Region, error) {
+	atomic.AddInt32(&c.getRegion, 1)
+	return c.Client.GetRegion(ctx, key)
+}
+
+func (c *countPDClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*pd.Region, error) {
+	atomic.AddInt32(&c.scanRegions, 1)
+	return c.Client.ScanRegions(ctx, key, endKey, limit)
+}
+
+type testRegionCacheSuite struct {
+	cluster  *mocktikv.Cluster
+	storeID  uint64
+	pdClient *countPDClient
+	cache    *RegionCache
+	conf     config.RegionCache
+	bo       *retry.Backoffer
+}
+
+var _ = Suite(&testRegionCacheSuite{})
+
+func (s *testRegionCacheSuite) SetUpTest(c *C) {
+	cluster := mocktikv.NewCluster()
+	// 10 regions: ["", "b"), ["b", "c"), ..., ["j", "").
+	var splitKeys [][]byte
+	for k := byte('b'); k <= 'j'; k++ {
+		splitKeys = append(splitKeys, []byte{k})
+	}
+	s.storeID, _, _ = mocktikv.BootstrapWithMultiRegions(cluster, splitKeys...)
+	s.cluster = cluster
+	s.pdClient = &countPDClient{Client: mocktikv.NewPDClient(cluster)}
+	s.conf = config.DefaultRegionCache()
+	s.conf.ScanRegionsLimit = 3
+	s.cache = NewRegionCache(&CodecPDClient{Client: s.pdClient}, &s.conf)
+	s.bo = retry.NewBackoffer(context.Background(), 5000)
+}
+
+func (s *testRegionCacheSuite) checkRequests(c *C, getRegion, scanRegions int32) {
+	c.Assert(atomic.LoadInt32(&s.pdClient.getRegion), Equals, getRegion)
+	c.Assert(atomic.LoadInt32(&s.pdClient.scanRegions), Equals, scanRegions)
+}
+
+func (s *testRegionCacheSuite) TestLoadRegionsInRange(c *C) {
+	c.Assert(s.cache.LoadRegionsInRange(s.bo, []byte("c"), []byte("h")), IsNil)
+	s.checkRequests(c, 0, 2)
+	ids, err := s.cache.ListRegionIDsInRange(s.bo, key.Range{StartKey: key.Key("c"), EndKey: key.Key("h")})
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 5)
+	s.checkRequests(c, 0, 2)
+
+	c.Assert(s.cache.LoadRegionsInRange(s.bo, nil, nil), IsNil)
+	s.checkRequests(c, 0, 6)
+	for k := byte('a'); k <= 'j'; k++ {
+		loc, err := s.cache.LocateKey(s.bo, []byte{k})
+		c.Assert(err, IsNil)
+		c.Assert(loc.Contains([]byte{k}), IsTrue)
+	}
+	s.checkRequests(c, 0, 6)
+}
+
+func (s *testRegionCacheSuite) TestPrefetchOnMiss(c *C) {
+	// The first miss loads one region, the following ones load in batch.
+	ids, err := s.cache.ListRegionIDsInRange(s.bo, key.Range{})
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 10)
+	s.checkRequests(c, 1, 3)
+
+	s.cache = NewRegionCache(&CodecPDClient{Client: s.pdClient}, &s.conf)
+	var keys [][]byte
+	for k := byte('a'); k <= 'j'; k++ {
+		keys = append(keys, []byte{k, '1'}, []byte{k, '2'})
+	}
+	groups, _, err := s.cache.GroupKeysByRegion(s.bo, keys)
+	c.Assert(err, IsNil)
+	c.Assert(groups, HasLen, 10)
+	s.checkRequests(c, 2, 6)
+
+	// Hits do not trigger prefetch.
+	_, err = s.cache.LocateKey(s.bo, []byte("a"))
+	c.Assert(err, IsNil)
+	s.checkRequests(c, 2, 6)
+}
+
+func (s *testRegionCacheSuite) TestWarmup(c *C) {
+	s.cache.Warmup(context.Background(), nil)
+	s.checkRequests(c, 0, 0)
+
+	s.conf.Warmup = true
+	s.cache.Warmup(context.Background(), nil)
+	s.checkRequests(c, 0, 4)
+	ids, err := s.cache.ListRegionIDsInRange(s.bo, key.Range{})
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 10)
+	s.checkRequests(c, 0, 4)
+}
+
+func (s *testRegionCacheSuite) TestDumpLoad(c *C) {
+	c.Assert(s.cache.LoadRegionsInRange(s.bo, nil, nil), IsNil)
+	addr, err := s.cache.GetStoreAddr(s.bo, s.storeID)
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(s.cache.Dump(&buf), IsNil)
+	s.checkRequests(c, 0, 4)
+
+	cache := NewRegionCache(&CodecPDClient{Client: s.pdClient}, &s.conf)
+	c.Assert(cache.Load(bytes.NewReader(buf.Bytes())), IsNil)
+	ids, err := cache.ListRegionIDsInRange(s.bo, key.Range{})
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 10)
+	loc, err := cache.LocateKey(s.bo, []byte("c"))
+	c.Assert(err, IsNil)
+	ctx, err := cache.GetRPCContext(s.bo, loc.Region, ReplicaReadLeader, 0)
+	c.Assert(err, IsNil)
+	c.Assert(ctx.Addr, Equals, addr)
+	s.checkRequests(c, 0, 4)
+
+	// The region is split after the dump, the stale region is corrected by
+	// the EpochNotMatch error.
+	peerID := s.cluster.AllocID()
+	s.cluster.Split(loc.Region.GetID(), s.cluster.AllocID(), []byte("c5"), []uint64{peerID}, peerID)
+	sender := rpc.NewRegionRequestSender(cache, mocktikv.NewRPCClient(s.cluster, mocktikv.MustNewMVCCStore()))
+	req := &rpc.Request{
+		Type: rpc.CmdGet,
+		Get:  &kvrpcpb.GetRequest{Key: []byte("c7"), Version: 1},
+	}
+	resp, err := sender.SendReq(s.bo, req, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	regionErr, err := resp.GetRegionError()
+	c.Assert(err, IsNil)
+	c.Assert(regionErr.GetEpochNotMatch(), NotNil)
+	loc, err = cache.LocateKey(s.bo, []byte("c7"))
+	c.Assert(err, IsNil)
+	c.Assert(loc.StartKey, BytesEquals, []byte("c5"))
+	s.checkRequests(c, 0, 4)
+
+	c.Assert(cache.Load(bytes.NewReader([]byte(`{"version":100}`))), NotNil)
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+// ReplicaReadType is the type of the replica to read data from.
+type ReplicaReadType byte
+
+const (
+	// ReplicaReadLeader stands for 'read from the leader'.
+	ReplicaReadLeader ReplicaReadType = iota
+	// ReplicaReadFollower stands for 'read from the followers'. Learners are
+	// followers here too.
+	ReplicaReadFollower
+	// ReplicaReadMixed stands for 'read from the leader and the followers in
+	// turn'.
+	ReplicaReadMixed
+)
+
+// IsFollowerRead checks whether the request may be served by a follower.
+func (r ReplicaReadType) IsFollowerRead() bool {
+	return r != ReplicaReadLeader
+}
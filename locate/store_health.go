@@ -0,0 +1,237 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/metrics"
+)
+
+// StoreState is the health state of a store.
+type StoreState int
+
+// StoreState values.
+const (
+	// StoreHealthy means the last request to the store succeeded.
+	StoreHealthy StoreState = iota
+	// StoreSuspect means the last requests to the store failed, but not as
+	// many as StoreFailureThreshold.
+	StoreSuspect
+	// StoreDown means the store failed too many times in a row. Requests are
+	// not sent to it until a probe or a trial request succeeds. One trial
+	// request is let through in each cool-down.
+	StoreDown
+)
+
+func (s StoreState) String() string {
+	switch s {
+	case StoreHealthy:
+		return "healthy"
+	case StoreSuspect:
+		return "suspect"
+	case StoreDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+// StoreProbeFunc checks if the store at addr is reachable.
+type StoreProbeFunc func(ctx context.Context, addr string) error
+
+type storeHealth struct {
+	state     StoreState
+	failures  int
+	downSince time.Time
+	trialAt   time.Time
+	addr      string
+}
+
+// trialReady checks if a trial request can be sent to the down store, that is
+// no request is sent to it in the last cool-down.
+func (h *storeHealth) trialReady(coolDown time.Duration) bool {
+	return time.Since(h.downSince) >= coolDown && time.Since(h.trialAt) >= coolDown
+}
+
+// storeHealthTracker tracks the health of stores by the results of requests
+// and probes. It works as a circuit breaker for each store.
+type storeHealthTracker struct {
+	threshold int
+	coolDown  time.Duration
+
+	mu     sync.RWMutex
+	stores map[uint64]*storeHealth
+}
+
+func newStoreHealthTracker(threshold int, coolDown time.Duration) *storeHealthTracker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &storeHealthTracker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		stores:    make(map[uint64]*storeHealth),
+	}
+}
+
+func (t *storeHealthTracker) onSuccess(storeID uint64) {
+	t.mu.RLock()
+	h, ok := t.stores[storeID]
+	healthy := !ok || h.state == StoreHealthy
+	t.mu.RUnlock()
+	if healthy {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h, ok := t.stores[storeID]; ok && h.state != StoreHealthy {
+		log.Infof("regionCache: store %d(%s) is healthy again", storeID, h.addr)
+		t.setState(storeID, h, StoreHealthy)
+		h.failures = 0
+	}
+}
+
+func (t *storeHealthTracker) onFailure(storeID uint64, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.stores[storeID]
+	if !ok {
+		h = &storeHealth{}
+		t.stores[storeID] = h
+	}
+	if addr != "" {
+		h.addr = addr
+	}
+	h.failures++
+	if h.failures < t.threshold {
+		t.setState(storeID, h, StoreSuspect)
+		return
+	}
+	if h.state != StoreDown {
+		log.Warnf("regionCache: mark store %d(%s) down after %d failures", storeID, h.addr, h.failures)
+	}
+	h.downSince = time.Now()
+	t.setState(storeID, h, StoreDown)
+}
+
+// available checks if requests can be sent to the store, without taking the
+// trial of a down store.
+func (t *storeHealthTracker) available(storeID uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	h, ok := t.stores[storeID]
+	return !ok || h.state != StoreDown || h.trialReady(t.coolDown)
+}
+
+// allow checks if a request can be sent to the store. A down store is
+// half-open after the cool-down: one trial request is allowed in each
+// cool-down, the store stays down until a request or probe succeeds, and the
+// failure of the trial restarts the cool-down.
+func (t *storeHealthTracker) allow(storeID uint64) bool {
+	t.mu.RLock()
+	h, ok := t.stores[storeID]
+	down := ok && h.state == StoreDown
+	t.mu.RUnlock()
+	if !down {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h.state != StoreDown {
+		return true
+	}
+	if !h.trialReady(t.coolDown) {
+		return false
+	}
+	h.trialAt = time.Now()
+	return true
+}
+
+func (t *storeHealthTracker) setState(storeID uint64, h *storeHealth, state StoreState) {
+	h.state = state
+	metrics.StoreHealthGauge.WithLabelValues(strconv.FormatUint(storeID, 10)).Set(float64(state))
+}
+
+func (t *storeHealthTracker) states() map[uint64]StoreState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	states := make(map[uint64]StoreState, len(t.stores))
+	for id, h := range t.stores {
+		states[id] = h.state
+	}
+	return states
+}
+
+// unhealthy returns the addresses of the stores that are not healthy.
+func (t *storeHealthTracker) unhealthy() map[uint64]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stores := make(map[uint64]string)
+	for id, h := range t.stores {
+		if h.state != StoreHealthy && h.addr != "" {
+			stores[id] = h.addr
+		}
+	}
+	return stores
+}
+
+// StoreStates returns the health states of the stores that have been
+// requested. Stores that are never requested are not included.
+func (c *RegionCache) StoreStates() map[uint64]StoreState {
+	return c.health.states()
+}
+
+// AllowStoreRequest checks if a request can be sent to the store. It returns
+// false if the store is down, except for one trial request in each cool-down.
+// The caller must send the request if it returns true.
+func (c *RegionCache) AllowStoreRequest(storeID uint64) bool {
+	return c.health.allow(storeID)
+}
+
+// OnSendSuccess marks the store of ctx healthy.
+func (c *RegionCache) OnSendSuccess(ctx *RPCContext) {
+	c.health.onSuccess(ctx.GetStoreID())
+}
+
+// RunStoreProber probes the stores that are not healthy periodically, until
+// ctx is done. A store is marked healthy when the probe succeeds, so it does
+// not have to wait for the cool-down.
+func (c *RegionCache) RunStoreProber(ctx context.Context, probe StoreProbeFunc) {
+	interval := c.conf.StoreProbeInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for id, addr := range c.health.unhealthy() {
+			if err := probe(ctx, addr); err != nil {
+				log.Debugf("regionCache: probe store %d(%s) failed, err: %v", id, addr, err)
+				continue
+			}
+			c.health.onSuccess(id)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	. "github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
+)
+
+// countRPCClient counts the requests sent to stores.
+type countRPCClient struct {
+	rpc.Client
+	count int32
+}
+
+func (c *countRPCClient) SendRequest(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration) (*rpc.Response, error) {
+	atomic.AddInt32(&c.count, 1)
+	return c.Client.SendRequest(ctx, addr, req, timeout)
+}
+
+type testStoreHealthSuite struct {
+	cluster *mocktikv.Cluster
+	storeID uint64
+	cache   *RegionCache
+	client  *countRPCClient
+}
+
+var _ = Suite(&testStoreHealthSuite{})
+
+func (s *testStoreHealthSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	s.storeID, _, _ = mocktikv.BootstrapWithSingleStore(s.cluster)
+	conf := config.DefaultRegionCache()
+	conf.StoreFailureThreshold = 2
+	conf.StoreDownCoolDown = 100 * time.Millisecond
+	conf.StoreProbeInterval = 10 * time.Millisecond
+	s.cache = NewRegionCache(mocktikv.NewPDClient(s.cluster), &conf)
+	s.client = &countRPCClient{Client: mocktikv.NewRPCClient(s.cluster, mocktikv.MustNewMVCCStore())}
+}
+
+// send sends a request and returns the error of the request or the region
+// error of the response.
+func (s *testStoreHealthSuite) send(c *C) error {
+	bo := retry.NewBackoffer(context.Background(), retry.RawkvMaxBackoff)
+	loc, err := s.cache.LocateKey(bo, []byte("a"))
+	c.Assert(err, IsNil)
+	req := &rpc.Request{
+		Type:   rpc.CmdRawGet,
+		RawGet: &kvrpcpb.RawGetRequest{Key: []byte("a")},
+	}
+	resp, err := rpc.NewRegionRequestSender(s.cache, s.client).SendReq(bo, req, loc.Region, time.Second)
+	if err != nil {
+		return err
+	}
+	regionErr, err := resp.GetRegionError()
+	c.Assert(err, IsNil)
+	if regionErr != nil {
+		return errors.New(regionErr.String())
+	}
+	return nil
+}
+
+func (s *testStoreHealthSuite) sentRequests() int32 {
+	return atomic.LoadInt32(&s.client.count)
+}
+
+func (s *testStoreHealthSuite) TestCircuitBreaker(c *C) {
+	c.Assert(s.send(c), IsNil)
+	c.Assert(s.cache.StoreStates()[s.storeID], Equals, StoreHealthy)
+
+	s.cluster.StopStore(s.storeID)
+	c.Assert(s.send(c), NotNil)
+	c.Assert(s.cache.StoreStates()[s.storeID], Equals, StoreSuspect)
+	c.Assert(s.send(c), NotNil)
+	c.Assert(s.cache.StoreStates()[s.storeID], Equals, StoreDown)
+	c.Assert(s.sentRequests(), Equals, int32(3))
+
+	// Requests fail fast while the store is down.
+	start := time.Now()
+	err := s.send(c)
+	c.Assert(errors.Is(err, retry.ErrStoreUnavailable), IsTrue, Commentf("err %v", err))
+	c.Assert(time.Since(start), Less, 50*time.Millisecond)
+	c.Assert(s.sentRequests(), Equals, int32(3))
+
+	// One trial request is sent after the cool-down, the others fail fast.
+	// The failure of the trial marks the store down for another cool-down.
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(s.cache.AllowStoreRequest(s.storeID), IsTrue)
+	c.Assert(s.cache.AllowStoreRequest(s.storeID), IsFalse)
+	err = s.send(c)
+	c.Assert(errors.Is(err, retry.ErrStoreUnavailable), IsTrue, Commentf("err %v", err))
+	c.Assert(s.sentRequests(), Equals, int32(3))
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(s.send(c), NotNil)
+	c.Assert(s.sentRequests(), Equals, int32(4))
+	c.Assert(s.cache.StoreStates()[s.storeID], Equals, StoreDown)
+	c.Assert(s.send(c), NotNil)
+	c.Assert(s.sentRequests(), Equals, int32(4))
+
+	// The prober finds that the store is back.
+	s.cluster.StartStore(s.storeID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.cache.RunStoreProber(ctx, rpc.NewStoreProbeFunc(s.client, time.Second))
+	for i := 0; i < 100 && s.cache.StoreStates()[s.storeID] != StoreHealthy; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(s.cache.StoreStates()[s.storeID], Equals, StoreHealthy)
+	c.Assert(s.send(c), IsNil)
+}
+
+func (s *testStoreHealthSuite) TestReplicaReadOnDownStores(c *C) {
+	cluster := mocktikv.NewCluster()
+	storeIDs, _, _, _ := mocktikv.BootstrapWithMultiStores(cluster, 3)
+	conf := config.DefaultRegionCache()
+	conf.StoreFailureThreshold = 1
+	cache := NewRegionCache(mocktikv.NewPDClient(cluster), &conf)
+	client := &countRPCClient{Client: mocktikv.NewRPCClient(cluster, mocktikv.MustNewMVCCStore())}
+	bo := retry.NewBackoffer(context.Background(), retry.RawkvMaxBackoff)
+	loc, err := cache.LocateKey(bo, []byte("a"))
+	c.Assert(err, IsNil)
+	followerRead := func() error {
+		req := &rpc.Request{
+			Type:            rpc.CmdRawGet,
+			RawGet:          &kvrpcpb.RawGetRequest{Key: []byte("a")},
+			ReplicaReadType: ReplicaReadMixed,
+		}
+		_, err := rpc.NewRegionRequestSender(cache, client).SendReq(bo, req, loc.Region, time.Second)
+		return err
+	}
+	markDown := func(storeID uint64) {
+		cache.DropStoreOnSendRequestFail(&RPCContext{Peer: &metapb.Peer{StoreId: storeID}}, errors.New("mock error"))
+	}
+
+	// The down stores are skipped.
+	markDown(storeIDs[0])
+	markDown(storeIDs[1])
+	for i := 0; i < 3; i++ {
+		c.Assert(followerRead(), IsNil)
+	}
+	c.Assert(atomic.LoadInt32(&client.count), Equals, int32(3))
+
+	// If all the stores are down, the request fails fast after trying all the
+	// peers.
+	markDown(storeIDs[2])
+	err = followerRead()
+	c.Assert(errors.Is(err, retry.ErrStoreUnavailable), IsTrue, Commentf("err %v", err))
+	c.Assert(atomic.LoadInt32(&client.count), Equals, int32(3))
+}
+
+func (s *testStoreHealthSuite) TestLeaderMovesFromDownStore(c *C) {
+	cluster := mocktikv.NewCluster()
+	storeIDs, peerIDs, regionID, _ := mocktikv.BootstrapWithMultiStores(cluster, 3)
+	conf := config.DefaultRegionCache()
+	conf.StoreFailureThreshold = 1
+	conf.StoreDownCoolDown = time.Minute
+	cache := NewRegionCache(mocktikv.NewPDClient(cluster), &conf)
+	client := mocktikv.NewRPCClient(cluster, mocktikv.MustNewMVCCStore())
+	leaderRead := func() error {
+		bo := retry.NewBackoffer(context.Background(), retry.RawkvMaxBackoff)
+		loc, err := cache.LocateKey(bo, []byte("a"))
+		c.Assert(err, IsNil)
+		req := &rpc.Request{
+			Type:   rpc.CmdRawGet,
+			RawGet: &kvrpcpb.RawGetRequest{Key: []byte("a")},
+		}
+		_, err = rpc.NewRegionRequestSender(cache, client).SendReq(bo, req, loc.Region, time.Second)
+		return err
+	}
+	c.Assert(leaderRead(), IsNil)
+
+	// The leader store is down, and a new leader is elected on another store.
+	cluster.StopStore(storeIDs[0])
+	cache.DropStoreOnSendRequestFail(&RPCContext{Peer: &metapb.Peer{StoreId: storeIDs[0]}}, errors.New("mock error"))
+	cluster.ChangeLeader(regionID, peerIDs[1])
+	err := leaderRead()
+	c.Assert(errors.Is(err, retry.ErrStoreUnavailable), IsTrue, Commentf("err %v", err))
+	// The next attempt finds the new leader before the cool-down ends.
+	c.Assert(leaderRead(), IsNil)
+	c.Assert(cache.StoreStates()[storeIDs[0]], Equals, StoreDown)
+}
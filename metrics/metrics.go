@@ -163,6 +163,51 @@ var (
 			Help:      "Counter of region cache.",
 		}, []string{"type", "result"})
 
+	// ReplicaLocalityCounter indicates whether the requests are sent to stores matching the client labels.
+	ReplicaLocalityCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "replica_locality_total",
+			Help:      "Counter of requests sent to stores that match the labels of the client or not.",
+		}, []string{"type"})
+
+	// StoreHealthGauge indicates the health state of each store.
+	StoreHealthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "store_health_state",
+			Help:      "Health state of stores, 0 is healthy, 1 is suspect and 2 is down.",
+		}, []string{"store"})
+
+	// HedgeCounter indicates the number of hedged reads and their results.
+	HedgeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "hedged_read_total",
+			Help:      "Counter of hedged reads.",
+		}, []string{"type"})
+
+	// RetryBudgetCounter indicates the number of retries that take from the retry budget.
+	RetryBudgetCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "retry_budget_total",
+			Help:      "Counter of retries that take from the retry budget.",
+		}, []string{"scope", "result"})
+
+	// CompressionBytesCounter indicates the request bytes before and after compression.
+	CompressionBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "compression_bytes_total",
+			Help:      "Counter of the bytes of compressed requests before and after compression.",
+		}, []string{"type", "stage"})
+
 	// PendingBatchRequests indicates the number of requests pending in the batch channel.
 	PendingBatchRequests = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -172,6 +217,7 @@ var (
 			Help:      "Pending batch requests",
 		})
 
+	// BatchWaitDuration indicates how long the batch system waits to collect more requests.
 	BatchWaitDuration = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "tikv",
@@ -182,6 +228,26 @@ var (
 			Help:    "batch wait duration",
 		})
 
+	// StorePendingBatchRequests indicates the number of requests pending in the batch channel of each store.
+	StorePendingBatchRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "store_pending_batch_requests",
+			Help:      "Pending batch requests of each store",
+		}, []string{"store"})
+
+	// StoreBatchWaitDuration indicates how long the batch system waits to collect more requests for each store.
+	StoreBatchWaitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tikv",
+			Subsystem: "client_go",
+			Name:      "store_batch_wait_duration",
+			// Min bucket is [0, 1ns).
+			Buckets: prometheus.ExponentialBuckets(1, 2, 30),
+			Help:    "batch wait duration of each store",
+		}, []string{"store"})
+
 	TSFutureWaitDuration = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "tikv",
@@ -228,8 +294,15 @@ func init() {
 	prometheus.MustRegister(LoadSafepointCounter)
 	prometheus.MustRegister(SecondaryLockCleanupFailureCounter)
 	prometheus.MustRegister(RegionCacheCounter)
+	prometheus.MustRegister(ReplicaLocalityCounter)
+	prometheus.MustRegister(StoreHealthGauge)
+	prometheus.MustRegister(HedgeCounter)
+	prometheus.MustRegister(RetryBudgetCounter)
+	prometheus.MustRegister(CompressionBytesCounter)
 	prometheus.MustRegister(PendingBatchRequests)
 	prometheus.MustRegister(BatchWaitDuration)
+	prometheus.MustRegister(StorePendingBatchRequests)
+	prometheus.MustRegister(StoreBatchWaitDuration)
 	prometheus.MustRegister(TSFutureWaitDuration)
 	prometheus.MustRegister(LocalLatchWaitTimeHistogram)
 }
@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"context"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
@@ -178,6 +179,21 @@ func (c *Cluster) AddStore(storeID uint64, addr string) {
 	c.stores[storeID] = newStore(storeID, addr)
 }
 
+// UpdateStoreLabels sets the labels of a Store.
+func (c *Cluster) UpdateStoreLabels(storeID uint64, labels map[string]string) {
+	c.Lock()
+	defer c.Unlock()
+
+	store := c.stores[storeID]
+	if store == nil {
+		return
+	}
+	store.meta.Labels = nil
+	for k, v := range labels {
+		store.meta.Labels = append(store.meta.Labels, &metapb.StoreLabel{Key: k, Value: v})
+	}
+}
+
 // RemoveStore removes a Store from the cluster.
 func (c *Cluster) RemoveStore(storeID uint64) {
 	c.Lock()
@@ -218,6 +234,35 @@ func (c *Cluster) GetRegionByKey(key []byte) (*metapb.Region, *metapb.Peer) {
 	return nil, nil
 }
 
+// ScanRegions returns at most limit Regions and their leaders that overlap
+// with [startKey, endKey), ordered by start key. An empty endKey means
+// unbounded, and limit <= 0 means no limit.
+func (c *Cluster) ScanRegions(startKey, endKey []byte, limit int) ([]*metapb.Region, []*metapb.Peer) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var regions []*Region
+	for _, r := range c.regions {
+		if (len(r.Meta.EndKey) == 0 || bytes.Compare(startKey, r.Meta.EndKey) < 0) &&
+			(len(endKey) == 0 || bytes.Compare(r.Meta.StartKey, endKey) < 0) {
+			regions = append(regions, r)
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return bytes.Compare(regions[i].Meta.StartKey, regions[j].Meta.StartKey) < 0
+	})
+	if limit > 0 && len(regions) > limit {
+		regions = regions[:limit]
+	}
+	metas := make([]*metapb.Region, 0, len(regions))
+	leaders := make([]*metapb.Peer, 0, len(regions))
+	for _, r := range regions {
+		metas = append(metas, proto.Clone(r.Meta).(*metapb.Region))
+		leaders = append(leaders, proto.Clone(r.leaderPeer()).(*metapb.Peer))
+	}
+	return metas, leaders
+}
+
 // GetPrevRegionByKey returns the previous Region and its leader whose range contains the key.
 func (c *Cluster) GetPrevRegionByKey(key []byte) (*metapb.Region, *metapb.Peer) {
 	c.RLock()
@@ -0,0 +1,124 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mocktikv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pingcap/kvproto/pkg/coprocessor"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// The coprocessor handler of mocktikv does not run any real coprocessor
+// request. It ignores the request type and data, and counts the keys in the
+// requested ranges of the region. The count is returned in Data as a big
+// endian uint64. A streaming request returns a response for each range, with
+// the count of the range.
+
+// DecodeCopCount decodes the key count in the data of a coprocessor response
+// returned by mocktikv.
+func DecodeCopCount(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, errors.Errorf("invalid coprocessor count data: %v", data)
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func encodeCopCount(n int) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(n))
+	return data
+}
+
+// countKeys counts the keys in the range within the region. It returns a
+// coprocessor response with the lock if a key is locked.
+func (h *rpcHandler) countKeys(r *coprocessor.KeyRange, startTS uint64) (int, *coprocessor.Response) {
+	startKey, endKey := r.GetStart(), r.GetEnd()
+	if bytes.Compare(startKey, h.rawStartKey) < 0 {
+		startKey = h.rawStartKey
+	}
+	if len(h.rawEndKey) > 0 && (len(endKey) == 0 || bytes.Compare(endKey, h.rawEndKey) > 0) {
+		endKey = h.rawEndKey
+	}
+	if len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0 {
+		return 0, nil
+	}
+	pairs := h.mvccStore.Scan(startKey, endKey, math.MaxInt32, startTS, h.isolationLevel)
+	for _, p := range pairs {
+		if p.Err != nil {
+			keyErr := convertToKeyError(p.Err)
+			if keyErr.GetLocked() == nil {
+				return 0, &coprocessor.Response{OtherError: keyErr.String()}
+			}
+			return 0, &coprocessor.Response{Locked: keyErr.GetLocked()}
+		}
+	}
+	return len(pairs), nil
+}
+
+func (h *rpcHandler) handleCopRequest(req *coprocessor.Request) *coprocessor.Response {
+	var count int
+	for _, r := range req.GetRanges() {
+		n, errResp := h.countKeys(r, req.GetStartTs())
+		if errResp != nil {
+			return errResp
+		}
+		count += n
+	}
+	return &coprocessor.Response{Data: encodeCopCount(count)}
+}
+
+func (h *rpcHandler) handleCopStreamRequest(req *coprocessor.Request) *mockCopStreamClient {
+	stream := &mockCopStreamClient{}
+	for _, r := range req.GetRanges() {
+		n, errResp := h.countKeys(r, req.GetStartTs())
+		if errResp != nil {
+			stream.responses = append(stream.responses, errResp)
+			break
+		}
+		stream.responses = append(stream.responses, &coprocessor.Response{
+			Data:  encodeCopCount(n),
+			Range: r,
+		})
+	}
+	return stream
+}
+
+type mockCopStreamClient struct {
+	grpc.ClientStream
+	responses []*coprocessor.Response
+}
+
+func (s *mockCopStreamClient) Recv() (*coprocessor.Response, error) {
+	if len(s.responses) == 0 {
+		return nil, io.EOF
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+type mockCopStreamErrClient struct {
+	grpc.ClientStream
+	*errorpb.Error
+}
+
+func (s *mockCopStreamErrClient) Recv() (*coprocessor.Response, error) {
+	return &coprocessor.Response{RegionError: s.Error}, nil
+}
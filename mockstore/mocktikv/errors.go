@@ -29,6 +29,15 @@ func (e *ErrLocked) Error() string {
 	return fmt.Sprintf("key is locked, key: %q, primary: %q, startTS: %v", e.Key, e.Primary, e.StartTS)
 }
 
+// ErrKeyAlreadyExist is returned when inserting a key that already exists.
+type ErrKeyAlreadyExist struct {
+	Key []byte
+}
+
+func (e *ErrKeyAlreadyExist) Error() string {
+	return fmt.Sprintf("key already exists, key: %q", e.Key)
+}
+
 // ErrRetryable suggests that client may restart the txn. e.g. write conflict.
 type ErrRetryable string
 
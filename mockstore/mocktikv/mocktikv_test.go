@@ -232,6 +232,24 @@ func (s *testMockTiKVSuite) TestDelete(c *C) {
 	s.mustGetNone(c, "x", 21)
 }
 
+func (s *testMockTiKVSuite) TestInsert(c *C) {
+	insert := func(key, value string) []*kvrpcpb.Mutation {
+		return []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Insert, Key: []byte(key), Value: []byte(value)}}
+	}
+	s.mustPrewriteOK(c, insert("x", "x5"), "x", 5)
+	s.mustCommitOK(c, [][]byte{[]byte("x")}, 5, 10)
+	s.mustGetOK(c, "x", 11, "x5")
+
+	errs := s.store.Prewrite(insert("x", "x15"), []byte("x"), 15, 0)
+	_, ok := errs[0].(*ErrKeyAlreadyExist)
+	c.Assert(ok, IsTrue)
+
+	// The deleted key can be inserted again, and the rollbacks are skipped.
+	s.mustDeleteOK(c, "x", 20, 25)
+	s.mustRollbackOK(c, [][]byte{[]byte("x")}, 30)
+	s.mustPrewriteOK(c, insert("x", "x35"), "x", 35)
+}
+
 func (s *testMockTiKVSuite) TestCleanupRollback(c *C) {
 	s.mustPutOK(c, "secondary", "s-0", 1, 2)
 	s.mustPrewriteOK(c, putMutations("primary", "p-5", "secondary", "s-5"), "primary", 5)
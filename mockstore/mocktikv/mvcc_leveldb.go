@@ -549,6 +549,17 @@ func prewriteMutation(db *leveldb.DB, batch *leveldb.Batch, mutation *kvrpcpb.Mu
 	if ok && dec1.value.commitTS >= startTS {
 		return ErrRetryable("write conflict")
 	}
+	if mutation.GetOp() == kvrpcpb.Op_Insert {
+		// Skip the rollbacks to find the latest committed value.
+		for ok && dec1.value.valueType == typeRollback {
+			if ok, err = dec1.Decode(iter); err != nil {
+				return err
+			}
+		}
+		if ok && dec1.value.valueType == typePut {
+			return &ErrKeyAlreadyExist{Key: mutation.Key}
+		}
+	}
 
 	lock := mvccLock{
 		startTS: startTS,
@@ -615,7 +626,7 @@ func commitKey(db *leveldb.DB, batch *leveldb.Batch, key []byte, startTS, commit
 func commitLock(batch *leveldb.Batch, lock mvccLock, key []byte, startTS, commitTS uint64) error {
 	if lock.op != kvrpcpb.Op_Lock {
 		var valueType mvccValueType
-		if lock.op == kvrpcpb.Op_Put {
+		if lock.op == kvrpcpb.Op_Put || lock.op == kvrpcpb.Op_Insert {
 			valueType = typePut
 		} else {
 			valueType = typeDelete
@@ -867,7 +878,11 @@ func (mvcc *MVCCLevelDB) BatchResolveLock(startKey, endKey []byte, txnInfos map[
 
 // DeleteRange implements the MVCCStore interface.
 func (mvcc *MVCCLevelDB) DeleteRange(startKey, endKey []byte) error {
-	return mvcc.doRawDeleteRange(codec.EncodeBytes(startKey), codec.EncodeBytes(endKey))
+	var limit []byte
+	if len(endKey) > 0 {
+		limit = codec.EncodeBytes(endKey)
+	}
+	return mvcc.doRawDeleteRange(codec.EncodeBytes(startKey), limit)
 }
 
 // Close calls leveldb's Close to free resources.
@@ -82,7 +82,9 @@ func (c *pdClient) GetLocalTSAsync(ctx context.Context, dcLocation string) pd.TS
 }
 
 func (c *pdClient) GetOperator(ctx context.Context, regionID uint64) (*pdpb.GetOperatorResponse, error) {
-	panic("unimplemented")
+	// Regions are scattered immediately in the mock cluster, so the operator
+	// has always finished.
+	return &pdpb.GetOperatorResponse{RegionId: regionID, Desc: []byte("scatter-region"), Status: pdpb.OperatorStatus_SUCCESS}, nil
 }
 
 type mockTSFuture struct {
@@ -114,7 +116,12 @@ func (c *pdClient) GetRegionByID(ctx context.Context, regionID uint64) (*pd.Regi
 }
 
 func (c *pdClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*pd.Region, error) {
-	panic("unimplemented")
+	metas, leaders := c.cluster.ScanRegions(key, endKey, limit)
+	regions := make([]*pd.Region, 0, len(metas))
+	for i := range metas {
+		regions = append(regions, &pd.Region{Meta: metas[i], Leader: leaders[i]})
+	}
+	return regions, nil
 }
 
 func (c *pdClient) GetStore(ctx context.Context, storeID uint64) (*metapb.Store, error) {
@@ -140,11 +147,14 @@ func (c *pdClient) UpdateServiceGCSafePoint(ctx context.Context, serviceID strin
 }
 
 func (c *pdClient) ScatterRegion(ctx context.Context, regionID uint64) error {
-	panic("unimplemented")
+	return c.ScatterRegionWithOption(ctx, regionID)
 }
 
 func (c *pdClient) ScatterRegionWithOption(ctx context.Context, regionID uint64, opts ...pd.ScatterRegionOption) error {
-	panic("unimplemented")
+	if region, _ := c.cluster.GetRegion(regionID); region == nil {
+		return errors.Errorf("region %d not found", regionID)
+	}
+	return nil
 }
 
 func (c *pdClient) Close() {
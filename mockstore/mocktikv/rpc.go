@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/kvproto/pkg/coprocessor"
 	"github.com/pingcap/kvproto/pkg/errorpb"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pingcap/kvproto/pkg/metapb"
@@ -52,6 +53,13 @@ func convertToKeyError(err error) *kvrpcpb.KeyError {
 			},
 		}
 	}
+	if exist, ok := errors.Cause(err).(*ErrKeyAlreadyExist); ok {
+		return &kvrpcpb.KeyError{
+			AlreadyExist: &kvrpcpb.AlreadyExist{
+				Key: exist.Key,
+			},
+		}
+	}
 	if retryable, ok := errors.Cause(err).(ErrRetryable); ok {
 		return &kvrpcpb.KeyError{
 			Retryable: retryable.Error(),
@@ -154,8 +162,8 @@ func (h *rpcHandler) checkRequestContext(ctx *kvrpcpb.Context) *errorpb.Error {
 			},
 		}
 	}
-	// The Peer on the Store is not leader.
-	if storePeer.GetId() != leaderPeer.GetId() {
+	// The Peer on the Store is not leader. Followers can serve replica reads.
+	if storePeer.GetId() != leaderPeer.GetId() && !ctx.GetReplicaRead() {
 		return &errorpb.Error{
 			Message: *proto.String("not leader"),
 			NotLeader: &errorpb.NotLeader{
@@ -225,7 +233,7 @@ func (h *rpcHandler) handleKvScan(req *kvrpcpb.ScanRequest) *kvrpcpb.ScanRespons
 	if !h.checkKeyInRegion(req.GetStartKey()) {
 		panic("KvScan: startKey not in region")
 	}
-	endKey := h.endKey
+	endKey := MvccKey(h.endKey).Raw()
 	if len(req.EndKey) > 0 && (len(endKey) == 0 || bytes.Compare(req.EndKey, endKey) < 0) {
 		endKey = req.EndKey
 	}
@@ -492,14 +500,30 @@ func (h *rpcHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawSc
 }
 
 func (h *rpcHandler) handleSplitRegion(req *kvrpcpb.SplitRegionRequest) *kvrpcpb.SplitRegionResponse {
-	key := NewMvccKey(req.GetSplitKey())
-	region, _ := h.cluster.GetRegionByKey(key)
-	if bytes.Equal(region.GetStartKey(), key) {
-		return &kvrpcpb.SplitRegionResponse{}
+	splitKeys := req.GetSplitKeys()
+	if len(splitKeys) == 0 {
+		splitKeys = [][]byte{req.GetSplitKey()}
 	}
-	newRegionID, newPeerIDs := h.cluster.AllocID(), h.cluster.AllocIDs(len(region.Peers))
-	h.cluster.SplitRaw(region.GetId(), newRegionID, key, newPeerIDs, newPeerIDs[0])
-	return &kvrpcpb.SplitRegionResponse{}
+	var regionIDs []uint64
+	for _, k := range splitKeys {
+		key := NewMvccKey(k)
+		region, _ := h.cluster.GetRegionByKey(key)
+		if bytes.Equal(region.GetStartKey(), key) {
+			continue
+		}
+		newRegionID, newPeerIDs := h.cluster.AllocID(), h.cluster.AllocIDs(len(region.Peers))
+		h.cluster.SplitRaw(region.GetId(), newRegionID, key, newPeerIDs, newPeerIDs[0])
+		if len(regionIDs) == 0 {
+			regionIDs = append(regionIDs, region.GetId())
+		}
+		regionIDs = append(regionIDs, newRegionID)
+	}
+	regions := make([]*metapb.Region, 0, len(regionIDs))
+	for _, id := range regionIDs {
+		region, _ := h.cluster.GetRegion(id)
+		regions = append(regions, region)
+	}
+	return &kvrpcpb.SplitRegionResponse{Regions: regions}
 }
 
 // RPCClient sends kv RPC calls to mock cluster. RPCClient mocks the behavior of
@@ -724,62 +748,41 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *rpc.Reque
 	case rpc.CmdUnsafeDestroyRange:
 		panic("unimplemented")
 	case rpc.CmdCop:
-		// TODO: support register cop handler.
-		panic("unimplemented")
-		// r := req.Cop
-		// if err := handler.checkRequestContext(reqCtx); err != nil {
-		// 	resp.Cop = &coprocessor.Response{RegionError: err}
-		// 	return resp, nil
-		// }
-		// handler.rawStartKey = MvccKey(handler.startKey).Raw()
-		// handler.rawEndKey = MvccKey(handler.endKey).Raw()
-		// var res *coprocessor.Response
-		// switch r.GetTp() {
-		// case kv.ReqTypeDAG:
-		// 	res = handler.handleCopDAGRequest(r)
-		// case kv.ReqTypeAnalyze:
-		// 	res = handler.handleCopAnalyzeRequest(r)
-		// case kv.ReqTypeChecksum:
-		// 	res = handler.handleCopChecksumRequest(r)
-		// default:
-		// 	panic(fmt.Sprintf("unknown coprocessor request type: %v", r.GetTp()))
-		// }
-		// resp.Cop = res
+		r := req.Cop
+		if err := handler.checkRequestContext(reqCtx); err != nil {
+			resp.Cop = &coprocessor.Response{RegionError: err}
+			return resp, nil
+		}
+		handler.rawStartKey = MvccKey(handler.startKey).Raw()
+		handler.rawEndKey = MvccKey(handler.endKey).Raw()
+		resp.Cop = handler.handleCopRequest(r)
 	case rpc.CmdCopStream:
-		// TODO: support register copStream handler.
-		panic("unimplemented")
-		// r := req.Cop
-		// if err := handler.checkRequestContext(reqCtx); err != nil {
-		// 	resp.CopStream = &rpc.CopStreamResponse{
-		// 		Tikv_CoprocessorStreamClient: &mockCopStreamErrClient{Error: err},
-		// 		Response: &coprocessor.Response{
-		// 			RegionError: err,
-		// 		},
-		// 	}
-		// 	return resp, nil
-		// }
-		// handler.rawStartKey = MvccKey(handler.startKey).Raw()
-		// handler.rawEndKey = MvccKey(handler.endKey).Raw()
-		// ctx1, cancel := context.WithCancel(ctx)
-		// copStream, err := handler.handleCopStream(ctx1, r)
-		// if err != nil {
-		// 	cancel()
-		// 	return nil, err
-		// }
-
-		// streamResp := &rpc.CopStreamResponse{
-		// 	Tikv_CoprocessorStreamClient: copStream,
-		// }
-		// streamResp.Lease.Cancel = cancel
-		// streamResp.Timeout = timeout
-		// c.streamTimeout <- &streamResp.Lease
+		r := req.Cop
+		if err := handler.checkRequestContext(reqCtx); err != nil {
+			resp.CopStream = &rpc.CopStreamResponse{
+				Tikv_CoprocessorStreamClient: &mockCopStreamErrClient{Error: err},
+				Response: &coprocessor.Response{
+					RegionError: err,
+				},
+			}
+			return resp, nil
+		}
+		handler.rawStartKey = MvccKey(handler.startKey).Raw()
+		handler.rawEndKey = MvccKey(handler.endKey).Raw()
+		streamResp := &rpc.CopStreamResponse{
+			Tikv_CoprocessorStreamClient: handler.handleCopStreamRequest(r),
+			Timeout:                      timeout,
+		}
+		// The mock stream never blocks, so there is nothing to cancel on
+		// timeout.
+		streamResp.Lease.Cancel = func() {}
 
-		// first, err := streamResp.Recv()
-		// if err != nil {
-		// 	return nil, err
-		// }
-		// streamResp.Response = first
-		// resp.CopStream = streamResp
+		first, err := streamResp.Recv()
+		if err != nil && errors.Cause(err) != io.EOF {
+			return nil, err
+		}
+		streamResp.Response = first
+		resp.CopStream = streamResp
 	case rpc.CmdMvccGetByKey:
 		r := req.MvccGetByKey
 		if err := handler.checkRequest(reqCtx, r.Size()); err != nil {
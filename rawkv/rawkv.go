@@ -16,11 +16,14 @@ package rawkv
 import (
 	"bytes"
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pkg/errors"
 	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
 	"github.com/tikv/client-go/locate"
 	"github.com/tikv/client-go/metrics"
 	"github.com/tikv/client-go/retry"
@@ -48,37 +51,78 @@ func DefaultScanOption() ScanOption {
 // only GET/PUT/DELETE commands are supported.
 type Client struct {
 	clusterID   uint64
-	conf        *config.Config
+	conf        atomic.Value // *config.Config
+	confMu      sync.Mutex   // serializes the updates of conf
 	regionCache *locate.RegionCache
 	pdClient    pd.Client
 	rpcClient   rpc.Client
+
+	replicaRead     locate.ReplicaReadType
+	replicaReadSeed uint32
+
+	cancelProber context.CancelFunc
+	hedge        *rpc.HedgePolicy
 }
 
-// NewClient creates a client with PD cluster addrs.
-func NewClient(ctx context.Context, pdAddrs []string, conf config.Config) (*Client, error) {
-	pdCli, err := pd.NewClient(pdAddrs, pd.SecurityOption{
-		CAPath:   conf.RPC.Security.SSLCA,
-		CertPath: conf.RPC.Security.SSLCert,
-		KeyPath:  conf.RPC.Security.SSLKey,
-	})
+// NewClient creates a client with PD cluster addrs. The interceptors wrap the
+// RPC client, the first one is the outermost.
+func NewClient(ctx context.Context, pdAddrs []string, conf config.Config, interceptors ...rpc.Interceptor) (*Client, error) {
+	pdCli, err := locate.NewPDClient(pdAddrs, &conf.RPC.Security)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		clusterID:   pdCli.GetClusterID(ctx),
-		conf:        &conf,
-		regionCache: locate.NewRegionCache(pdCli, &conf.RegionCache),
-		pdClient:    pdCli,
-		rpcClient:   rpc.NewRPCClient(&conf.RPC),
-	}, nil
+	regionCache := locate.NewRegionCache(pdCli, &conf.RegionCache)
+	regionCache.SetRetryBudget(retry.NewRetryBudget(&conf.RPC.RetryBudget))
+	regionCache.Warmup(ctx, &conf.Retry)
+	rpcClient := rpc.Chain(rpc.NewRPCClient(&conf.RPC), interceptors...)
+	proberCtx, cancel := context.WithCancel(context.Background())
+	go regionCache.RunStoreProber(proberCtx, rpc.NewStoreProbeFunc(rpcClient, conf.RPC.ReadTimeoutShort))
+	client := &Client{
+		clusterID:    pdCli.GetClusterID(ctx),
+		regionCache:  regionCache,
+		pdClient:     pdCli,
+		rpcClient:    rpcClient,
+		cancelProber: cancel,
+		hedge:        rpc.NewHedgePolicy(conf.RPC.Hedge),
+	}
+	client.conf.Store(&conf)
+	return client, nil
+}
+
+func (c *Client) getConfig() *config.Config {
+	return c.conf.Load().(*config.Config)
+}
+
+// UpdateConfig updates the configurations that can be changed at runtime,
+// like timeouts, batch sizes and the Raw limits, without rebuilding the
+// client. Changing other fields results in an error. The requests sent after
+// the update use the new values.
+func (c *Client) UpdateConfig(conf config.Config) error {
+	c.confMu.Lock()
+	defer c.confMu.Unlock()
+	updated, err := c.getConfig().Update(conf)
+	if err != nil {
+		return err
+	}
+	c.conf.Store(&updated)
+	return nil
 }
 
 // Close closes the client.
 func (c *Client) Close() error {
+	if c.cancelProber != nil {
+		c.cancelProber()
+	}
 	c.pdClient.Close()
 	return c.rpcClient.Close()
 }
 
+// SetReplicaRead sets the replica that Get, BatchGet, Scan and ReverseScan
+// read data from. It should be called before the client is used.
+func (c *Client) SetReplicaRead(replicaRead locate.ReplicaReadType) {
+	c.replicaRead = replicaRead
+}
+
 // ClusterID returns the TiKV cluster ID.
 func (c *Client) ClusterID() uint64 {
 	return c.clusterID
@@ -95,6 +139,7 @@ func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
 			Key: key,
 		},
 	}
+	c.setReplicaRead(req)
 	resp, _, err := c.sendReq(ctx, key, req)
 	if err != nil {
 		return nil, err
@@ -117,7 +162,7 @@ func (c *Client) BatchGet(ctx context.Context, keys [][]byte) ([][]byte, error)
 	start := time.Now()
 	defer func() { metrics.RawkvCmdHistogram.WithLabelValues("batch_get").Observe(time.Since(start).Seconds()) }()
 
-	bo := retry.NewBackoffer(ctx, retry.RawkvMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &c.getConfig().Retry, retry.OpRawkv)
 	resp, err := c.sendBatchReq(bo, keys, rpc.CmdRawBatchGet)
 	if err != nil {
 		return nil, err
@@ -185,7 +230,7 @@ func (c *Client) BatchPut(ctx context.Context, keys, values [][]byte) error {
 			return errors.New("empty value is not supported")
 		}
 	}
-	bo := retry.NewBackoffer(ctx, retry.RawkvMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &c.getConfig().Retry, retry.OpRawkv)
 	return c.sendBatchPut(bo, keys, values)
 }
 
@@ -219,7 +264,7 @@ func (c *Client) BatchDelete(ctx context.Context, keys [][]byte) error {
 	start := time.Now()
 	defer func() { metrics.RawkvCmdHistogram.WithLabelValues("batch_delete").Observe(time.Since(start).Seconds()) }()
 
-	bo := retry.NewBackoffer(ctx, retry.RawkvMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &c.getConfig().Retry, retry.OpRawkv)
 	resp, err := c.sendBatchReq(bo, keys, rpc.CmdRawBatchDelete)
 	if err != nil {
 		return err
@@ -236,15 +281,18 @@ func (c *Client) BatchDelete(ctx context.Context, keys [][]byte) error {
 
 // DeleteRange deletes all key-value pairs in a range from TiKV
 func (c *Client) DeleteRange(ctx context.Context, startKey []byte, endKey []byte) error {
+	return c.DeleteKeyRange(ctx, key.Range{StartKey: startKey, EndKey: endKey})
+}
+
+// DeleteKeyRange deletes all key-value pairs in the range from TiKV. If the
+// range is unbounded, all keys >= r.StartKey are deleted.
+func (c *Client) DeleteKeyRange(ctx context.Context, r key.Range) error {
 	start := time.Now()
-	var err error
 	defer func() { metrics.RawkvCmdHistogram.WithLabelValues("delete_range").Observe(time.Since(start).Seconds()) }()
 
 	// Process each affected region respectively
-	for !bytes.Equal(startKey, endKey) {
-		var resp *rpc.Response
-		var actualEndKey []byte
-		resp, actualEndKey, err = c.sendDeleteRangeReq(ctx, startKey, endKey)
+	for !r.IsEmpty() {
+		resp, actualEndKey, err := c.sendDeleteRangeReq(ctx, r)
 		if err != nil {
 			return err
 		}
@@ -255,7 +303,11 @@ func (c *Client) DeleteRange(ctx context.Context, startKey []byte, endKey []byte
 		if cmdResp.GetError() != "" {
 			return errors.New(cmdResp.GetError())
 		}
-		startKey = actualEndKey
+		if len(actualEndKey) == 0 {
+			// The last region has been processed.
+			break
+		}
+		r.StartKey = actualEndKey
 	}
 
 	return nil
@@ -277,7 +329,7 @@ func (c *Client) Scan(ctx context.Context, startKey, endKey []byte, limit int, o
 		option = options[0]
 	}
 
-	if limit > c.conf.Raw.MaxScanLimit {
+	if limit > c.getConfig().Raw.MaxScanLimit {
 		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
 	}
 
@@ -291,6 +343,7 @@ func (c *Client) Scan(ctx context.Context, startKey, endKey []byte, limit int, o
 				KeyOnly:  option.KeyOnly,
 			},
 		}
+		c.setReplicaRead(req)
 		resp, loc, err := c.sendReq(ctx, startKey, req)
 		if err != nil {
 			return nil, nil, err
@@ -329,7 +382,7 @@ func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit
 		option = options[0]
 	}
 
-	if limit > c.conf.Raw.MaxScanLimit {
+	if limit > c.getConfig().Raw.MaxScanLimit {
 		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
 	}
 
@@ -344,6 +397,7 @@ func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit
 				KeyOnly:  option.KeyOnly,
 			},
 		}
+		c.setReplicaRead(req)
 		resp, loc, err := c.sendReq(ctx, startKey, req)
 		if err != nil {
 			return nil, nil, err
@@ -364,15 +418,23 @@ func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit
 	return
 }
 
+// setReplicaRead sets the replica read type of a read request. Each request
+// gets a new seed, so follower reads are spread over the replicas in turn.
+func (c *Client) setReplicaRead(req *rpc.Request) {
+	req.ReplicaReadType = c.replicaRead
+	req.ReplicaReadSeed = atomic.AddUint32(&c.replicaReadSeed, 1)
+}
+
 func (c *Client) sendReq(ctx context.Context, key []byte, req *rpc.Request) (*rpc.Response, *locate.KeyLocation, error) {
-	bo := retry.NewBackoffer(ctx, retry.RawkvMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &c.getConfig().Retry, retry.OpRawkv)
 	sender := rpc.NewRegionRequestSender(c.regionCache, c.rpcClient)
+	sender.SetHedgePolicy(c.hedge)
 	for {
 		loc, err := c.regionCache.LocateKey(bo, key)
 		if err != nil {
 			return nil, nil, err
 		}
-		resp, err := sender.SendReq(bo, req, loc.Region, c.conf.RPC.ReadTimeoutShort)
+		resp, err := sender.SendReq(bo, req, loc.Region, c.getConfig().RPC.ReadTimeoutShort)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -399,7 +461,7 @@ func (c *Client) sendBatchReq(bo *retry.Backoffer, keys [][]byte, cmdType rpc.Cm
 
 	var batches []batch
 	for regionID, groupKeys := range groups {
-		batches = appendKeyBatches(batches, regionID, groupKeys, c.conf.Raw.BatchPairCount)
+		batches = appendKeyBatches(batches, regionID, groupKeys, c.getConfig().Raw.BatchPairCount)
 	}
 	bo, cancel := bo.Fork()
 	ches := make(chan singleBatchResp, len(batches))
@@ -448,6 +510,7 @@ func (c *Client) doBatchReq(bo *retry.Backoffer, batch batch, cmdType rpc.CmdTyp
 				Keys: batch.keys,
 			},
 		}
+		c.setReplicaRead(req)
 	case rpc.CmdRawBatchDelete:
 		req = &rpc.Request{
 			Type: cmdType,
@@ -458,7 +521,7 @@ func (c *Client) doBatchReq(bo *retry.Backoffer, batch batch, cmdType rpc.CmdTyp
 	}
 
 	sender := rpc.NewRegionRequestSender(c.regionCache, c.rpcClient)
-	resp, err := sender.SendReq(bo, req, batch.regionID, c.conf.RPC.ReadTimeoutShort)
+	resp, err := sender.SendReq(bo, req, batch.regionID, c.getConfig().RPC.ReadTimeoutShort)
 
 	batchResp := singleBatchResp{}
 	if err != nil {
@@ -504,29 +567,26 @@ func (c *Client) doBatchReq(bo *retry.Backoffer, batch batch, cmdType rpc.CmdTyp
 // If the given range spans over more than one regions, the actual endKey is the end of the first region.
 // We can't use sendReq directly, because we need to know the end of the region before we send the request
 // TODO: Is there any better way to avoid duplicating code with func `sendReq` ?
-func (c *Client) sendDeleteRangeReq(ctx context.Context, startKey []byte, endKey []byte) (*rpc.Response, []byte, error) {
-	bo := retry.NewBackoffer(ctx, retry.RawkvMaxBackoff)
+func (c *Client) sendDeleteRangeReq(ctx context.Context, r key.Range) (*rpc.Response, []byte, error) {
+	bo := retry.NewBackofferWithConfig(ctx, &c.getConfig().Retry, retry.OpRawkv)
 	sender := rpc.NewRegionRequestSender(c.regionCache, c.rpcClient)
 	for {
-		loc, err := c.regionCache.LocateKey(bo, startKey)
+		loc, err := c.regionCache.LocateKey(bo, r.StartKey)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		actualEndKey := endKey
-		if len(loc.EndKey) > 0 && bytes.Compare(loc.EndKey, endKey) < 0 {
-			actualEndKey = loc.EndKey
-		}
+		actualEndKey := r.Intersect(key.Range{StartKey: loc.StartKey, EndKey: loc.EndKey}).EndKey
 
 		req := &rpc.Request{
 			Type: rpc.CmdRawDeleteRange,
 			RawDeleteRange: &kvrpcpb.RawDeleteRangeRequest{
-				StartKey: startKey,
+				StartKey: r.StartKey,
 				EndKey:   actualEndKey,
 			},
 		}
 
-		resp, err := sender.SendReq(bo, req, loc.Region, c.conf.RPC.ReadTimeoutShort)
+		resp, err := sender.SendReq(bo, req, loc.Region, c.getConfig().RPC.ReadTimeoutShort)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -557,7 +617,7 @@ func (c *Client) sendBatchPut(bo *retry.Backoffer, keys, values [][]byte) error
 	var batches []batch
 	// split the keys by size and RegionVerID
 	for regionID, groupKeys := range groups {
-		batches = appendBatches(batches, regionID, groupKeys, keyToValue, c.conf.Raw.MaxBatchPutSize)
+		batches = appendBatches(batches, regionID, groupKeys, keyToValue, c.getConfig().Raw.MaxBatchPutSize)
 	}
 	bo, cancel := bo.Fork()
 	ch := make(chan error, len(batches))
@@ -636,7 +696,7 @@ func (c *Client) doBatchPut(bo *retry.Backoffer, batch batch) error {
 	}
 
 	sender := rpc.NewRegionRequestSender(c.regionCache, c.rpcClient)
-	resp, err := sender.SendReq(bo, req, batch.regionID, c.conf.RPC.ReadTimeoutShort)
+	resp, err := sender.SendReq(bo, req, batch.regionID, c.getConfig().RPC.ReadTimeoutShort)
 	if err != nil {
 		return err
 	}
@@ -14,16 +14,22 @@
 package rawkv
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
 	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/metrics"
 	"github.com/tikv/client-go/mockstore/mocktikv"
 	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
 )
 
 func TestT(t *testing.T) {
@@ -45,12 +51,12 @@ func (s *testRawKVSuite) SetUpTest(c *C) {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	conf := config.Default()
 	s.client = &Client{
-		conf:        &conf,
 		clusterID:   0,
 		regionCache: locate.NewRegionCache(pdClient, &conf.RegionCache),
 		pdClient:    pdClient,
 		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore),
 	}
+	s.client.conf.Store(&conf)
 	s.bo = retry.NewBackoffer(context.Background(), 5000)
 }
 
@@ -178,10 +184,18 @@ func (s *testRawKVSuite) mustReverseScanRange(c *C, startKey, endKey []byte, lim
 func (s *testRawKVSuite) mustDeleteRange(c *C, startKey, endKey []byte, expected map[string]string) {
 	err := s.client.DeleteRange(context.TODO(), startKey, endKey)
 	c.Assert(err, IsNil)
+	s.checkDeleted(c, key.Range{StartKey: startKey, EndKey: endKey}, expected)
+}
+
+func (s *testRawKVSuite) mustDeleteKeyRange(c *C, r key.Range, expected map[string]string) {
+	err := s.client.DeleteKeyRange(context.TODO(), r)
+	c.Assert(err, IsNil)
+	s.checkDeleted(c, r, expected)
+}
 
+func (s *testRawKVSuite) checkDeleted(c *C, r key.Range, expected map[string]string) {
 	for keyStr := range expected {
-		key := []byte(keyStr)
-		if bytes.Compare(startKey, key) <= 0 && bytes.Compare(key, endKey) < 0 {
+		if r.Contains(key.Key(keyStr)) {
 			delete(expected, keyStr)
 		}
 	}
@@ -226,7 +240,7 @@ func (s *testRawKVSuite) TestRawBatch(c *C) {
 	size := 0
 	var testKeys [][]byte
 	var testValues [][]byte
-	for i := 0; size/s.client.conf.Raw.MaxBatchPutSize < 4; i++ {
+	for i := 0; size/s.client.getConfig().Raw.MaxBatchPutSize < 4; i++ {
 		key := fmt.Sprint("key", i)
 		size += len(key)
 		testKeys = append(testKeys, []byte(key))
@@ -336,5 +350,199 @@ func (s *testRawKVSuite) TestDeleteRange(c *C) {
 	s.mustDeleteRange(c, []byte("c11"), []byte("c12"), testData)
 	s.mustDeleteRange(c, []byte("d0"), []byte("d0"), testData)
 	s.mustDeleteRange(c, []byte("c5"), []byte("d5"), testData)
+	s.mustDeleteKeyRange(c, key.PrefixRange(key.Key("a")), testData)
+	s.mustDeleteKeyRange(c, key.Range{StartKey: key.Key("d7")}, testData)
 	s.mustDeleteRange(c, []byte("a"), []byte("z"), testData)
 }
+
+func (s *testRawKVSuite) TestFollowerRead(c *C) {
+	region, leader := s.cluster.GetRegionByKey([]byte("a"))
+	followerStore := s.cluster.AllocID()
+	s.cluster.AddStore(followerStore, fmt.Sprintf("store%d", followerStore))
+	s.cluster.AddPeer(region.GetId(), followerStore, s.cluster.AllocID())
+
+	s.mustPut(c, []byte("a"), []byte("va"))
+	s.mustPut(c, []byte("b"), []byte("vb"))
+
+	// Reads do not need the leader.
+	s.cluster.StopStore(leader.GetStoreId())
+	s.client.SetReplicaRead(locate.ReplicaReadFollower)
+	s.mustGet(c, []byte("a"), []byte("va"))
+	s.mustBatchGet(c, [][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("va"), []byte("vb")})
+	s.mustScan(c, "", 10, "a", "va", "b", "vb")
+}
+
+// slowStoreClient delays the requests to a store.
+type slowStoreClient struct {
+	rpc.Client
+	addr  string
+	delay time.Duration
+}
+
+func (c *slowStoreClient) SendRequest(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration) (*rpc.Response, error) {
+	if addr == c.addr {
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+	return c.Client.SendRequest(ctx, addr, req, timeout)
+}
+
+func (s *testRawKVSuite) TestHedgedRead(c *C) {
+	region, leader := s.cluster.GetRegionByKey([]byte("a"))
+	followerStore := s.cluster.AllocID()
+	s.cluster.AddStore(followerStore, fmt.Sprintf("store%d", followerStore))
+	s.cluster.AddPeer(region.GetId(), followerStore, s.cluster.AllocID())
+	s.mustPut(c, []byte("a"), []byte("va"))
+
+	slowClient := &slowStoreClient{
+		Client: s.client.rpcClient,
+		addr:   s.cluster.GetStore(leader.GetStoreId()).GetAddress(),
+		delay:  time.Second,
+	}
+	s.client.rpcClient = slowClient
+	conf := config.DefaultHedge()
+	conf.Enable = true
+	conf.MinDelay, conf.MaxDelay = 10*time.Millisecond, 10*time.Millisecond
+	conf.BudgetRatio = 1
+	s.client.hedge = rpc.NewHedgePolicy(conf)
+
+	// The slow store has failed once.
+	s.client.regionCache.DropStoreOnSendRequestFail(&locate.RPCContext{Peer: leader}, errors.New("mock error"))
+	c.Assert(s.client.regionCache.StoreStates()[leader.GetStoreId()], Equals, locate.StoreSuspect)
+
+	won := metrics.HedgeCounter.WithLabelValues("won")
+	wonCount := testutil.ToFloat64(won)
+	start := time.Now()
+	s.mustGet(c, []byte("a"), []byte("va"))
+	c.Assert(time.Since(start), Less, 500*time.Millisecond)
+	c.Assert(testutil.ToFloat64(won), Equals, wonCount+1)
+	// The success of the hedged read does not mark the slow store healthy.
+	c.Assert(s.client.regionCache.StoreStates()[leader.GetStoreId()], Equals, locate.StoreSuspect)
+
+	// Without budget, the read waits for the slow store.
+	conf.BudgetRatio = 0
+	s.client.hedge = rpc.NewHedgePolicy(conf)
+	slowClient.delay = 100 * time.Millisecond
+	start = time.Now()
+	s.mustGet(c, []byte("a"), []byte("va"))
+	c.Assert(time.Since(start) >= 100*time.Millisecond, IsTrue)
+	c.Assert(testutil.ToFloat64(won), Equals, wonCount+1)
+}
+
+func (s *testRawKVSuite) TestErrorClasses(c *C) {
+	_, leader := s.cluster.GetRegionByKey([]byte("a"))
+	s.cluster.StopStore(leader.GetStoreId())
+
+	ctx := retry.WithConfig(context.Background(), config.Retry{
+		Budgets: map[string]time.Duration{retry.OpRawkv: 100 * time.Millisecond},
+	})
+	_, err := s.client.Get(ctx, []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrRegionUnavailable), IsTrue, Commentf("err %v", err))
+	c.Assert(errors.Is(err, retry.ErrRetryable), IsTrue)
+	var exhausted *retry.BackoffExhaustedError
+	c.Assert(errors.As(err, &exhausted), IsTrue)
+	c.Assert(exhausted.Types[0], Equals, retry.BoTiKVRPC)
+	c.Assert(exhausted.Errors, HasLen, len(exhausted.Types))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.client.Get(ctx, []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrContextCanceled), IsTrue, Commentf("err %v", err))
+	c.Assert(errors.Is(err, context.Canceled), IsTrue)
+	c.Assert(errors.Is(err, retry.ErrRetryable), IsFalse)
+}
+
+func (s *testRawKVSuite) TestRetryBudget(c *C) {
+	s.mustPut(c, []byte("a"), []byte("va"))
+	_, leader := s.cluster.GetRegionByKey([]byte("a"))
+	s.cluster.StopStore(leader.GetStoreId())
+
+	// The store budget runs out, the request fails fast instead of retrying
+	// until the backoff budget is used up.
+	s.client.regionCache.SetRetryBudget(retry.NewRetryBudget(&config.RetryBudget{
+		Enable:      true,
+		ClientBurst: 1000,
+		StoreBurst:  2,
+	}))
+	exhausted := testutil.ToFloat64(metrics.RetryBudgetCounter.WithLabelValues("store", "exhausted"))
+	start := time.Now()
+	_, err := s.client.Get(context.Background(), []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrRetryBudgetExhausted), IsTrue, Commentf("err %v", err))
+	c.Assert(errors.Is(err, retry.ErrRegionUnavailable), IsTrue)
+	c.Assert(time.Since(start), Less, 5*time.Second)
+	c.Assert(testutil.ToFloat64(metrics.RetryBudgetCounter.WithLabelValues("store", "exhausted")), Equals, exhausted+1)
+
+	// The store is marked down, the requests fail fast without retrying.
+	_, err = s.client.Get(context.Background(), []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrStoreUnavailable), IsTrue, Commentf("err %v", err))
+	c.Assert(errors.Is(err, retry.ErrRegionUnavailable), IsTrue)
+
+	// The client budget is shared by all the backoffs of the client. A new
+	// region cache is used, so the store is not marked down yet.
+	regionCacheConf := config.DefaultRegionCache()
+	s.client.regionCache = locate.NewRegionCache(s.client.pdClient, &regionCacheConf)
+	s.client.regionCache.SetRetryBudget(retry.NewRetryBudget(&config.RetryBudget{
+		Enable:      true,
+		ClientBurst: 1,
+		StoreBurst:  1000,
+	}))
+	_, err = s.client.Get(context.Background(), []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrRetryBudgetExhausted), IsTrue, Commentf("err %v", err))
+	_, err = s.client.Get(context.Background(), []byte("a"))
+	c.Assert(errors.Is(err, retry.ErrRetryBudgetExhausted), IsTrue, Commentf("err %v", err))
+}
+
+func (s *testRawKVSuite) TestUpdateConfig(c *C) {
+	conf := *s.client.getConfig()
+	conf.Raw.MaxScanLimit = 2
+	c.Assert(s.client.UpdateConfig(conf), IsNil)
+	_, _, err := s.client.Scan(context.TODO(), []byte("a"), nil, 3)
+	c.Assert(errors.Cause(err), Equals, ErrMaxScanLimitExceeded)
+	_, _, err = s.client.Scan(context.TODO(), []byte("a"), nil, 2)
+	c.Assert(err, IsNil)
+
+	// The fields used to build the client can not be updated.
+	conf.RPC.DialTimeout = time.Second
+	c.Assert(s.client.UpdateConfig(conf), ErrorMatches, "rpc.dial-timeout can not be updated at runtime")
+	conf.RPC.DialTimeout = s.client.getConfig().RPC.DialTimeout
+
+	// The invalid updates are not applied.
+	conf.Raw.BatchPairCount = 0
+	c.Assert(s.client.UpdateConfig(conf), ErrorMatches, "invalid config:\nraw.batch-pair-count: 0 should be positive")
+	c.Assert(s.client.getConfig().Raw.BatchPairCount, Equals, config.DefaultRaw().BatchPairCount)
+	c.Assert(s.client.getConfig().Raw.MaxScanLimit, Equals, 2)
+}
+
+func (s *testRawKVSuite) TestRequestOptions(c *C) {
+	var contexts []kvrpcpb.Context
+	s.client.rpcClient = rpc.Chain(s.client.rpcClient, rpc.NewUnaryInterceptor(
+		func(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration, next rpc.SendRequestFunc) (*rpc.Response, error) {
+			contexts = append(contexts, req.Context)
+			return next(ctx, addr, req, timeout)
+		}))
+	ctx := rpc.WithRequestOptions(context.Background(), rpc.RequestOptions{
+		Priority:     kvrpcpb.CommandPri_Low,
+		NotFillCache: true,
+	})
+	c.Assert(s.client.Put(ctx, []byte("a"), []byte("a")), IsNil)
+	_, err := s.client.Get(ctx, []byte("a"))
+	c.Assert(err, IsNil)
+	_, err = s.client.BatchGet(ctx, [][]byte{[]byte("a"), []byte("b")})
+	c.Assert(err, IsNil)
+	c.Assert(contexts, HasLen, 3)
+	for _, reqCtx := range contexts {
+		c.Assert(reqCtx.Priority, Equals, kvrpcpb.CommandPri_Low)
+		c.Assert(reqCtx.NotFillCache, IsTrue)
+	}
+
+	// The requests without the options are not changed.
+	contexts = nil
+	_, err = s.client.Get(context.Background(), []byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(contexts, HasLen, 1)
+	c.Assert(contexts[0].Priority, Equals, kvrpcpb.CommandPri_Normal)
+	c.Assert(contexts[0].NotFillCache, IsFalse)
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/config"
 	"github.com/tikv/client-go/metrics"
 )
 
@@ -37,16 +38,35 @@ const (
 )
 
 // NewBackoffFn creates a backoff func which implements exponential backoff with
-// optional jitters.
+// optional jitters. The sleep is clipped to the deadline of the context.
 // See http://www.awsarchitectureblog.com/2015/03/backoff.html
 func NewBackoffFn(base, cap, jitter int) func(ctx context.Context) int {
+	next := newSleepFn(base, cap, jitter)
+	return func(ctx context.Context) int {
+		sleep := next()
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := int(time.Until(deadline) / time.Millisecond); left < sleep {
+				sleep = left
+			}
+			if sleep < 0 {
+				sleep = 0
+			}
+		}
+		sleepWithContext(ctx, sleep)
+		return sleep
+	}
+}
+
+// newSleepFn creates a func which returns the sleep time(in ms) of each
+// attempt of the exponential backoff.
+func newSleepFn(base, cap, jitter int) func() int {
 	if base < 2 {
 		// Top prevent panic in 'rand.Intn'.
 		base = 2
 	}
 	attempts := 0
 	lastSleep := base
-	return func(ctx context.Context) int {
+	return func() int {
 		var sleep int
 		switch jitter {
 		case NoJitter:
@@ -61,17 +81,21 @@ func NewBackoffFn(base, cap, jitter int) func(ctx context.Context) int {
 			sleep = int(math.Min(float64(cap), float64(base+rand.Intn(lastSleep*3-base))))
 		}
 		log.Debugf("backoff base %d, sleep %d", base, sleep)
-		select {
-		case <-time.After(time.Duration(sleep) * time.Millisecond):
-		case <-ctx.Done():
-		}
-
 		attempts++
 		lastSleep = sleep
 		return lastSleep
 	}
 }
 
+func sleepWithContext(ctx context.Context, sleep int) {
+	timer := time.NewTimer(time.Duration(sleep) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
 func expo(base, cap, n int) int {
 	return int(math.Min(float64(cap), float64(base)*math.Pow(2.0, float64(n))))
 }
@@ -90,25 +114,28 @@ const (
 	BoServerBusy
 )
 
-func (t BackoffType) createFn() func(context.Context) int {
+// chargesBudget reports whether the retries of the type are charged to the
+// client retry budget. Only the retries caused by unhealthy stores are
+// charged, waiting for locks or PD does not add load to the stores.
+func (t BackoffType) chargesBudget() bool {
 	switch t {
-	case BoTiKVRPC:
-		return NewBackoffFn(100, 2000, EqualJitter)
-	case BoTxnLock:
-		return NewBackoffFn(200, 3000, EqualJitter)
-	case BoTxnLockFast:
-		return NewBackoffFn(50, 3000, EqualJitter)
-	case BoPDRPC:
-		return NewBackoffFn(500, 3000, EqualJitter)
-	case BoRegionMiss:
-		// change base time to 2ms, because it may recover soon.
-		return NewBackoffFn(2, 500, NoJitter)
-	case BoUpdateLeader:
-		return NewBackoffFn(1, 10, NoJitter)
-	case BoServerBusy:
-		return NewBackoffFn(2000, 10000, EqualJitter)
+	case BoTiKVRPC, BoRegionMiss, BoServerBusy:
+		return true
 	}
-	return nil
+	return false
+}
+
+func newSleepFnFromPolicy(p config.BackoffPolicy) func() int {
+	jitter := EqualJitter
+	switch p.Jitter {
+	case config.JitterNone:
+		jitter = NoJitter
+	case config.JitterFull:
+		jitter = FullJitter
+	case config.JitterDecorr:
+		jitter = DecorrJitter
+	}
+	return newSleepFn(int(p.Base/time.Millisecond), int(p.Cap/time.Millisecond), jitter)
 }
 
 func (t BackoffType) String() string {
@@ -131,7 +158,8 @@ func (t BackoffType) String() string {
 	return ""
 }
 
-// Maximum total sleep time(in ms) for kv/cop commands.
+// Maximum total sleep time(in ms) for kv/cop commands. They are the default
+// budgets of the operations in config.Retry.
 const (
 	CopBuildTaskMaxBackoff         = 5000
 	TsoMaxBackoff                  = 15000
@@ -146,16 +174,54 @@ const (
 	DeleteRangeOneRegionMaxBackoff = 100000
 	RawkvMaxBackoff                = 20000
 	SplitRegionBackoff             = 20000
+	WaitScatterRegionFinishBackoff = 120000
+	WarmupRegionCacheMaxBackoff    = 20000
+	CommitMaxBackoff               = 41000
 )
 
-// CommitMaxBackoff is max sleep time of the 'commit' command
-var CommitMaxBackoff = 41000
+// Operations that have retry budgets in config.Retry.
+const (
+	OpCopBuildTask            = "copBuildTask"
+	OpTso                     = "tso"
+	OpScannerNext             = "scannerNext"
+	OpBatchGet                = "batchGet"
+	OpCopNext                 = "copNext"
+	OpGet                     = "get"
+	OpPrewrite                = "prewrite"
+	OpCleanup                 = "cleanup"
+	OpCommit                  = "commit"
+	OpGcOneRegion             = "gcOneRegion"
+	OpGcResolveLock           = "gcResolveLock"
+	OpDeleteRangeOneRegion    = "deleteRangeOneRegion"
+	OpRawkv                   = "rawkv"
+	OpSplitRegion             = "splitRegion"
+	OpWaitScatterRegionFinish = "waitScatterRegionFinish"
+	OpWarmupRegionCache       = "warmupRegionCache"
+)
+
+var defaultRetry = config.DefaultRetry()
+
+type retryConfigKey struct{}
+
+// WithConfig returns a context that overrides the retry config for the calls
+// made with it. The policies and budgets in conf take precedence over the ones
+// of the client, the others are not changed.
+func WithConfig(ctx context.Context, conf config.Retry) context.Context {
+	return context.WithValue(ctx, retryConfigKey{}, &conf)
+}
+
+func configFromContext(ctx context.Context) *config.Retry {
+	conf, _ := ctx.Value(retryConfigKey{}).(*config.Retry)
+	return conf
+}
 
 // Backoffer is a utility for retrying queries.
 type Backoffer struct {
-	ctx context.Context
+	ctx    context.Context
+	conf   *config.Retry
+	budget *RetryBudget
 
-	fn         map[BackoffType]func(context.Context) int
+	fn         map[BackoffType]func() int
 	maxSleep   int
 	totalSleep int
 	errors     []error
@@ -165,7 +231,8 @@ type Backoffer struct {
 // txnStartKey is a key for transaction start_ts info in context.Context.
 const txnStartKey = "_txn_start_key"
 
-// NewBackoffer creates a Backoffer with maximum sleep time(in ms).
+// NewBackoffer creates a Backoffer with maximum sleep time(in ms). It uses the
+// default backoff policies, unless they are overridden by ctx.
 func NewBackoffer(ctx context.Context, maxSleep int) *Backoffer {
 	return &Backoffer{
 		ctx:      ctx,
@@ -173,27 +240,57 @@ func NewBackoffer(ctx context.Context, maxSleep int) *Backoffer {
 	}
 }
 
+// NewBackofferWithConfig creates a Backoffer for the operation, with the
+// budget and backoff policies in conf. Overrides in ctx take precedence, and
+// the defaults are used for those that are not configured.
+func NewBackofferWithConfig(ctx context.Context, conf *config.Retry, op string) *Backoffer {
+	budget, ok := configFromContext(ctx).Budget(op)
+	if !ok {
+		if budget, ok = conf.Budget(op); !ok {
+			budget, _ = defaultRetry.Budget(op)
+		}
+	}
+	return &Backoffer{
+		ctx:      ctx,
+		conf:     conf,
+		maxSleep: int(budget / time.Millisecond),
+	}
+}
+
 // Backoff sleeps a while base on the BackoffType and records the error message.
-// It returns a retryable error if total sleep time exceeds maxSleep.
+// It returns a *BackoffExhaustedError if total sleep time exceeds maxSleep,
+// or err classified as ErrContextCanceled if the context is done.
 func (b *Backoffer) Backoff(typ BackoffType, err error) error {
 	select {
 	case <-b.ctx.Done():
-		return err
+		return Classify(err, ErrContextCanceled, b.ctx.Err())
 	default:
 	}
 
 	metrics.BackoffCounter.WithLabelValues(typ.String()).Inc()
 	// Lazy initialize.
 	if b.fn == nil {
-		b.fn = make(map[BackoffType]func(context.Context) int)
+		b.fn = make(map[BackoffType]func() int)
 	}
 	f, ok := b.fn[typ]
 	if !ok {
-		f = typ.createFn()
+		f = newSleepFnFromPolicy(b.policy(typ))
 		b.fn[typ] = f
 	}
 
-	b.totalSleep += f(b.ctx)
+	sleep := f()
+	if deadline, ok := b.ctx.Deadline(); ok && time.Until(deadline) <= time.Duration(sleep)*time.Millisecond {
+		// The retry could not be sent before the deadline, fail now instead
+		// of sleeping until the deadline.
+		log.Debugf("%v, backoff %dms exceeds the deadline, type: %s", err, sleep, typ.String())
+		return Classify(errors.WithMessagef(err, "backoff %dms exceeds the deadline", sleep), ErrContextCanceled, context.DeadlineExceeded)
+	}
+	if typ.chargesBudget() && !b.budget.AcquireClient() {
+		log.Debugf("%v, client retry budget exhausted, type: %s", err, typ.String())
+		return Classify(errors.WithMessage(err, "client retry budget exhausted"), ErrRetryBudgetExhausted, ErrRetryable)
+	}
+	sleepWithContext(b.ctx, sleep)
+	b.totalSleep += sleep
 	b.types = append(b.types, typ)
 
 	var startTs interface{}
@@ -212,12 +309,35 @@ func (b *Backoffer) Backoff(typ BackoffType, err error) error {
 			}
 		}
 		log.Warn(errMsg)
-		// Use the first backoff type to generate a MySQL error.
-		return errors.New(b.types[0].String())
+		return &BackoffExhaustedError{
+			Types:      append([]BackoffType(nil), b.types...),
+			Errors:     append([]error(nil), b.errors...),
+			TotalSleep: time.Duration(b.totalSleep) * time.Millisecond,
+			MaxSleep:   time.Duration(b.maxSleep) * time.Millisecond,
+			Cause:      err,
+		}
 	}
 	return nil
 }
 
+// SetRetryBudget sets the retry budget that the retries of the Backoffer take
+// from.
+func (b *Backoffer) SetRetryBudget(budget *RetryBudget) {
+	b.budget = budget
+}
+
+func (b *Backoffer) policy(typ BackoffType) config.BackoffPolicy {
+	for _, conf := range []*config.Retry{configFromContext(b.ctx), b.conf, &defaultRetry} {
+		if conf == nil {
+			continue
+		}
+		if p, ok := conf.Policies[typ.String()]; ok {
+			return p
+		}
+	}
+	return config.BackoffPolicy{}
+}
+
 func (b *Backoffer) String() string {
 	if b.totalSleep == 0 {
 		return ""
@@ -230,6 +350,8 @@ func (b *Backoffer) String() string {
 func (b *Backoffer) Clone() *Backoffer {
 	return &Backoffer{
 		ctx:        b.ctx,
+		conf:       b.conf,
+		budget:     b.budget,
 		maxSleep:   b.maxSleep,
 		totalSleep: b.totalSleep,
 		errors:     b.errors,
@@ -242,6 +364,8 @@ func (b *Backoffer) Fork() (*Backoffer, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(b.ctx)
 	return &Backoffer{
 		ctx:        ctx,
+		conf:       b.conf,
+		budget:     b.budget,
 		maxSleep:   b.maxSleep,
 		totalSleep: b.totalSleep,
 		errors:     b.errors[:len(b.errors):len(b.errors)],
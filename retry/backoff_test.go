@@ -0,0 +1,179 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testBackoffSuite struct{}
+
+var _ = Suite(&testBackoffSuite{})
+
+// backoffUntilFail backs off until the budget is exhausted, and returns the
+// number of successful backoffs.
+func backoffUntilFail(bo *Backoffer, typ BackoffType) int {
+	for n := 0; ; n++ {
+		if err := bo.Backoff(typ, errors.New("test")); err != nil {
+			return n
+		}
+	}
+}
+
+func (s *testBackoffSuite) TestConfig(c *C) {
+	conf := config.DefaultRetry()
+	conf.Policies[BoRegionMiss.String()] = config.BackoffPolicy{Base: 5 * time.Millisecond, Cap: 5 * time.Millisecond, Jitter: config.JitterNone}
+	conf.Budgets[OpGet] = 12 * time.Millisecond
+
+	bo := NewBackofferWithConfig(context.Background(), &conf, OpGet)
+	c.Assert(backoffUntilFail(bo, BoRegionMiss), Equals, 2)
+	c.Assert(bo.TotalSleep(), Equals, 15*time.Millisecond)
+
+	// The defaults are used for the operations that are not configured.
+	delete(conf.Budgets, OpGet)
+	bo = NewBackofferWithConfig(context.Background(), &conf, OpGet)
+	c.Assert(bo.maxSleep, Equals, GetMaxBackoff)
+	bo = NewBackofferWithConfig(context.Background(), nil, OpCommit)
+	c.Assert(bo.maxSleep, Equals, CommitMaxBackoff)
+}
+
+func (s *testBackoffSuite) TestContextOverride(c *C) {
+	conf := config.DefaultRetry()
+	conf.Policies[BoRegionMiss.String()] = config.BackoffPolicy{Base: 5 * time.Millisecond, Cap: 5 * time.Millisecond, Jitter: config.JitterNone}
+	conf.Budgets[OpGet] = 12 * time.Millisecond
+
+	ctx := WithConfig(context.Background(), config.Retry{
+		Budgets: map[string]time.Duration{OpGet: 4 * time.Millisecond},
+	})
+	bo := NewBackofferWithConfig(ctx, &conf, OpGet)
+	c.Assert(backoffUntilFail(bo, BoRegionMiss), Equals, 0)
+	c.Assert(bo.TotalSleep(), Equals, 5*time.Millisecond)
+
+	ctx = WithConfig(context.Background(), config.Retry{
+		Policies: map[string]config.BackoffPolicy{
+			BoRegionMiss.String(): {Base: 3 * time.Millisecond, Cap: 3 * time.Millisecond, Jitter: config.JitterNone},
+		},
+	})
+	bo = NewBackofferWithConfig(ctx, &conf, OpGet)
+	c.Assert(backoffUntilFail(bo, BoRegionMiss), Equals, 3)
+	c.Assert(bo.TotalSleep(), Equals, 12*time.Millisecond)
+
+	// The override also applies to the backoffers that are not created from
+	// config.
+	bo = NewBackoffer(ctx, 6)
+	c.Assert(backoffUntilFail(bo, BoRegionMiss), Equals, 1)
+	c.Assert(bo.TotalSleep(), Equals, 6*time.Millisecond)
+}
+
+func (s *testBackoffSuite) TestErrors(c *C) {
+	conf := config.DefaultRetry()
+	conf.Policies[BoTxnLockFast.String()] = config.BackoffPolicy{Base: 5 * time.Millisecond, Cap: 5 * time.Millisecond, Jitter: config.JitterNone}
+	conf.Budgets[OpGet] = 5 * time.Millisecond
+
+	cause := errors.New("locked")
+	err := NewBackofferWithConfig(context.Background(), &conf, OpGet).Backoff(BoTxnLockFast, cause)
+	c.Assert(errors.Is(err, ErrRetryable), IsTrue)
+	c.Assert(errors.Is(err, ErrLockConflict), IsTrue)
+	c.Assert(errors.Is(err, ErrRegionUnavailable), IsFalse)
+	c.Assert(errors.Is(err, cause), IsTrue)
+	var exhausted *BackoffExhaustedError
+	c.Assert(errors.As(err, &exhausted), IsTrue)
+	c.Assert(exhausted.Types, DeepEquals, []BackoffType{BoTxnLockFast})
+	c.Assert(exhausted.TotalSleep, Equals, 5*time.Millisecond)
+	c.Assert(exhausted.Cause, Equals, cause)
+
+	// Classify keeps the root cause.
+	err = Classify(errors.WithStack(cause), ErrUndetermined)
+	c.Assert(errors.Is(err, ErrUndetermined), IsTrue)
+	c.Assert(errors.Is(err, ErrRetryable), IsFalse)
+	c.Assert(errors.Cause(err), Equals, cause)
+	c.Assert(Classify(nil, ErrUndetermined), IsNil)
+}
+
+func (s *testBackoffSuite) TestTokenBucket(c *C) {
+	b := newTokenBucket(2, 10)
+	now := b.last
+	c.Assert(b.take(now), IsTrue)
+	c.Assert(b.take(now), IsTrue)
+	c.Assert(b.take(now), IsFalse)
+	// 10 tokens per second, one token is back after 100ms.
+	c.Assert(b.take(now.Add(50*time.Millisecond)), IsFalse)
+	c.Assert(b.take(now.Add(100*time.Millisecond)), IsTrue)
+	c.Assert(b.take(now.Add(100*time.Millisecond)), IsFalse)
+	// It does not refill over the burst.
+	c.Assert(b.take(now.Add(time.Hour)), IsTrue)
+	c.Assert(b.take(now.Add(time.Hour)), IsTrue)
+	c.Assert(b.take(now.Add(time.Hour)), IsFalse)
+
+	c.Assert(NewRetryBudget(&config.RetryBudget{}), IsNil)
+	var budget *RetryBudget
+	c.Assert(budget.AcquireClient(), IsTrue)
+	c.Assert(budget.AcquireStore(1), IsTrue)
+}
+
+func (s *testBackoffSuite) TestRetryBudget(c *C) {
+	conf := config.DefaultRetry()
+	for _, typ := range []BackoffType{BoTiKVRPC, BoTxnLock, BoPDRPC} {
+		conf.Policies[typ.String()] = config.BackoffPolicy{Base: time.Millisecond, Cap: time.Millisecond, Jitter: config.JitterNone}
+	}
+	bo := NewBackofferWithConfig(context.Background(), &conf, OpGet)
+	bo.SetRetryBudget(NewRetryBudget(&config.RetryBudget{Enable: true, ClientBurst: 1}))
+
+	// Waiting for locks or PD does not take from the budget.
+	for i := 0; i < 3; i++ {
+		c.Assert(bo.Backoff(BoTxnLock, errors.New("locked")), IsNil)
+		c.Assert(bo.Backoff(BoPDRPC, errors.New("pd")), IsNil)
+	}
+	c.Assert(bo.Backoff(BoTiKVRPC, errors.New("rpc")), IsNil)
+	err := bo.Backoff(BoTiKVRPC, errors.New("rpc"))
+	c.Assert(errors.Is(err, ErrRetryBudgetExhausted), IsTrue)
+	c.Assert(bo.Backoff(BoTxnLock, errors.New("locked")), IsNil)
+}
+
+func (s *testBackoffSuite) TestDeadline(c *C) {
+	conf := config.DefaultRetry()
+	conf.Policies[BoRegionMiss.String()] = config.BackoffPolicy{Base: 50 * time.Millisecond, Cap: 50 * time.Millisecond, Jitter: config.JitterNone}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	bo := NewBackofferWithConfig(ctx, &conf, OpGet)
+	c.Assert(bo.Backoff(BoRegionMiss, errors.New("test")), IsNil)
+	c.Assert(bo.Backoff(BoRegionMiss, errors.New("test")), IsNil)
+	// The third retry could not be sent before the deadline, it fails without
+	// sleeping.
+	start := time.Now()
+	err := bo.Backoff(BoRegionMiss, errors.New("test"))
+	c.Assert(time.Since(start), Less, 10*time.Millisecond)
+	c.Assert(errors.Is(err, context.DeadlineExceeded), IsTrue)
+	c.Assert(errors.Is(err, ErrContextCanceled), IsTrue)
+	c.Assert(bo.TotalSleep(), Equals, 100*time.Millisecond)
+
+	// The sleep of a backoff func is clipped to the deadline.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	sleep := NewBackoffFn(1000, 1000, NoJitter)(ctx)
+	c.Assert(sleep, LessEqual, 20)
+	c.Assert(time.Since(start), Less, 500*time.Millisecond)
+}
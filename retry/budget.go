@@ -0,0 +1,121 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/metrics"
+)
+
+// ErrRetryBudgetExhausted is the class of the errors returned when a retry is
+// over the retry budget.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// tokenBucket is a token bucket that refills rate tokens per second, up to
+// burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	burst  float64
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(burst int, rate float64) *tokenBucket {
+	return &tokenBucket{
+		burst:  float64(burst),
+		rate:   rate,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.last) {
+		b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryBudget is the retry budget of a client. Each retry of the client after
+// a store failure, i.e. BoTiKVRPC, BoRegionMiss or BoServerBusy, takes a token
+// from the client bucket, and each retry after failing to send a
+// request to a store also takes a token from the bucket of the store. A nil
+// RetryBudget does not limit the retries.
+type RetryBudget struct {
+	conf   *config.RetryBudget
+	client *tokenBucket
+
+	mu     sync.Mutex
+	stores map[uint64]*tokenBucket
+}
+
+// NewRetryBudget creates a RetryBudget. It returns nil if the budget is not
+// enabled.
+func NewRetryBudget(conf *config.RetryBudget) *RetryBudget {
+	if !conf.Enable {
+		return nil
+	}
+	return &RetryBudget{
+		conf:   conf,
+		client: newTokenBucket(conf.ClientBurst, conf.ClientRate),
+		stores: make(map[uint64]*tokenBucket),
+	}
+}
+
+// AcquireClient takes a retry from the client budget. It returns false if
+// the budget is exhausted.
+func (b *RetryBudget) AcquireClient() bool {
+	if b == nil {
+		return true
+	}
+	return observeBudget("client", b.client.take(time.Now()))
+}
+
+// AcquireStore takes a retry from the budget of the store. It returns false
+// if the budget is exhausted.
+func (b *RetryBudget) AcquireStore(storeID uint64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	bucket, ok := b.stores[storeID]
+	if !ok {
+		bucket = newTokenBucket(b.conf.StoreBurst, b.conf.StoreRate)
+		b.stores[storeID] = bucket
+	}
+	b.mu.Unlock()
+	return observeBudget("store", bucket.take(time.Now()))
+}
+
+func observeBudget(scope string, ok bool) bool {
+	result := "ok"
+	if !ok {
+		result = "exhausted"
+	}
+	metrics.RetryBudgetCounter.WithLabelValues(scope, result).Inc()
+	return ok
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Classes of the errors returned by rawkv, txnkv and rpc. An error is matched
+// against them with errors.Is, like errors.Is(err, retry.ErrRegionUnavailable).
+// An error may belong to multiple classes.
+var (
+	// ErrRetryable means that the operation failed on a transient error, it
+	// may succeed if it is retried later.
+	ErrRetryable = errors.New("retryable")
+	// ErrRegionUnavailable means that the region could not be served, e.g.
+	// it has no leader or its stores are unreachable.
+	ErrRegionUnavailable = errors.New("region unavailable")
+	// ErrStoreUnavailable means that the store is marked down after failing
+	// too many times, and the request is not sent to it.
+	ErrStoreUnavailable = errors.New("store unavailable")
+	// ErrUndetermined means that it is unknown whether a write has succeeded.
+	ErrUndetermined = errors.New("result undetermined")
+	// ErrLockConflict means that the operation conflicts with the locks or
+	// the writes of other transactions.
+	ErrLockConflict = errors.New("lock conflict")
+	// ErrContextCanceled means that the operation is stopped because its
+	// context is canceled or exceeds the deadline.
+	ErrContextCanceled = errors.New("context canceled")
+)
+
+// Classify returns an error that wraps err and belongs to the classes.
+// Classes are matched with errors.Is, and errors.Cause still returns the root
+// cause of err.
+func Classify(err error, classes ...error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{cause: err, classes: classes}
+}
+
+type classifiedError struct {
+	cause   error
+	classes []error
+}
+
+func (e *classifiedError) Error() string { return e.cause.Error() }
+
+func (e *classifiedError) Cause() error { return e.cause }
+
+func (e *classifiedError) Unwrap() error { return e.cause }
+
+func (e *classifiedError) Is(target error) bool {
+	for _, class := range e.classes {
+		if class == target {
+			return true
+		}
+	}
+	return false
+}
+
+// BackoffExhaustedError is returned by Backoffer when the total sleep time
+// exceeds its budget. It is ErrRetryable, and it is ErrRegionUnavailable or
+// ErrLockConflict if it backed off on the related types.
+type BackoffExhaustedError struct {
+	// Types are the backoff types in the order they happened.
+	Types []BackoffType
+	// Errors are all the errors recorded by the Backoffer.
+	Errors []error
+	// TotalSleep is the total time the Backoffer slept.
+	TotalSleep time.Duration
+	// MaxSleep is the budget of the Backoffer.
+	MaxSleep time.Duration
+	// Cause is the last error that the Backoffer backed off on.
+	Cause error
+}
+
+func (e *BackoffExhaustedError) Error() string {
+	// The first backoff type is put at the beginning, which is what the error
+	// used to be.
+	return fmt.Sprintf("%s: backoffer.maxSleep %dms is exceeded, types: %v, last error: %v",
+		e.Types[0], e.MaxSleep/time.Millisecond, e.Types, e.Cause)
+}
+
+// Unwrap returns the last error that the Backoffer backed off on.
+func (e *BackoffExhaustedError) Unwrap() error { return e.Cause }
+
+// Is reports whether the error belongs to the class.
+func (e *BackoffExhaustedError) Is(target error) bool {
+	switch target {
+	case ErrRetryable:
+		return true
+	case ErrRegionUnavailable:
+		return e.hasType(BoRegionMiss, BoUpdateLeader, BoTiKVRPC)
+	case ErrLockConflict:
+		return e.hasType(BoTxnLock, BoTxnLockFast)
+	}
+	return false
+}
+
+func (e *BackoffExhaustedError) hasType(types ...BackoffType) bool {
+	for _, t := range e.Types {
+		for _, tp := range types {
+			if t == tp {
+				return true
+			}
+		}
+	}
+	return false
+}
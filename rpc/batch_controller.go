@@ -0,0 +1,75 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/tikv/client-go/config"
+)
+
+// batchController decides how long batchSendLoop waits to collect more
+// requests for a store. Waiting makes bigger batches, which reduces the load of
+// TiKV, but adds latency. So it only waits when the store is busy, that is TiKV
+// reports a high transport layer load, or many requests are in flight.
+type batchController struct {
+	conf *config.Batch
+	// inflight is the number of requests sent to the store but not responded.
+	inflight int64
+	// transportLayerLoad is the latest load reported by TiKV.
+	transportLayerLoad uint64
+}
+
+func (c *batchController) onSend(n int) {
+	atomic.AddInt64(&c.inflight, int64(n))
+}
+
+func (c *batchController) onRecv(n int) {
+	atomic.AddInt64(&c.inflight, -int64(n))
+}
+
+func (c *batchController) setTransportLayerLoad(load uint64) {
+	atomic.StoreUint64(&c.transportLayerLoad, load)
+}
+
+// decide returns how long to wait and how many requests to wait for. It
+// returns 0 if the batch should be sent at once.
+func (c *batchController) decide() (time.Duration, int) {
+	conf := c.conf
+	if conf.MaxWaitTime <= 0 || conf.MaxBatchSize == 0 {
+		return 0, 0
+	}
+	load := atomic.LoadUint64(&c.transportLayerLoad)
+	if !conf.Adaptive {
+		if uint(load) >= conf.OverloadThreshold {
+			return conf.MaxWaitTime, int(conf.MaxWaitSize)
+		}
+		return 0, 0
+	}
+
+	pressure := float64(atomic.LoadInt64(&c.inflight)) / float64(conf.MaxBatchSize)
+	if conf.OverloadThreshold > 0 {
+		pressure = math.Max(pressure, float64(load)/float64(conf.OverloadThreshold))
+	}
+	if pressure < 1 {
+		return 0, 0
+	}
+	// Both the wait time and size grow with the pressure. The wait time
+	// reaches MaxWaitTime at twice the threshold.
+	wait := time.Duration(float64(conf.MaxWaitTime) * math.Min(pressure/2, 1))
+	size := int(math.Min(float64(conf.MaxWaitSize)*pressure, float64(conf.MaxBatchSize)))
+	return wait, size
+}
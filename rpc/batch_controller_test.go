@@ -0,0 +1,211 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/tikvpb"
+	"github.com/tikv/client-go/config"
+	"google.golang.org/grpc"
+)
+
+type testBatchControllerSuite struct{}
+
+// enabledBatch returns the default batch config with message batch turned on.
+func enabledBatch() config.Batch {
+	batch := config.DefaultBatch()
+	batch.MaxBatchSize = 128
+	return batch
+}
+
+var _ = Suite(&testBatchControllerSuite{})
+
+func (s *testBatchControllerSuite) TestDecide(c *C) {
+	conf := enabledBatch()
+	ctl := &batchController{conf: &conf}
+
+	// Message batch is off, send at once even if TiKV is overloaded.
+	off := config.DefaultBatch()
+	ctl.conf = &off
+	ctl.setTransportLayerLoad(uint64(off.OverloadThreshold) * 4)
+	wait, _ := ctl.decide()
+	c.Assert(wait, Equals, time.Duration(0))
+	ctl.setTransportLayerLoad(0)
+	ctl.conf = &conf
+
+	// Idle store, send at once.
+	wait, _ = ctl.decide()
+	c.Assert(wait, Equals, time.Duration(0))
+
+	// TiKV is overloaded.
+	ctl.setTransportLayerLoad(uint64(conf.OverloadThreshold))
+	wait, size := ctl.decide()
+	c.Assert(wait, Equals, conf.MaxWaitTime/2)
+	c.Assert(size, Equals, int(conf.MaxWaitSize))
+	ctl.setTransportLayerLoad(uint64(conf.OverloadThreshold) * 4)
+	wait, size = ctl.decide()
+	c.Assert(wait, Equals, conf.MaxWaitTime)
+	c.Assert(size, Equals, int(conf.MaxWaitSize)*4)
+
+	// Many requests are in flight.
+	ctl.setTransportLayerLoad(0)
+	ctl.onSend(int(conf.MaxBatchSize) * 3)
+	wait, size = ctl.decide()
+	c.Assert(wait, Equals, conf.MaxWaitTime)
+	c.Assert(size, Equals, int(conf.MaxWaitSize)*3)
+	ctl.onRecv(int(conf.MaxBatchSize) * 3)
+	wait, _ = ctl.decide()
+	c.Assert(wait, Equals, time.Duration(0))
+
+	// Not adaptive, only waits when TiKV is overloaded.
+	conf.Adaptive = false
+	ctl.onSend(int(conf.MaxBatchSize) * 3)
+	wait, _ = ctl.decide()
+	c.Assert(wait, Equals, time.Duration(0))
+	ctl.setTransportLayerLoad(uint64(conf.OverloadThreshold))
+	wait, size = ctl.decide()
+	c.Assert(wait, Equals, conf.MaxWaitTime)
+	c.Assert(size, Equals, int(conf.MaxWaitSize))
+}
+
+// batchStubServer is a TiKV server that only serves RawGet in BatchCommands.
+// It takes some time for each batch, like a real server does for each
+// message.
+type batchStubServer struct {
+	tikvpb.TikvServer
+	load      uint64
+	batchCost time.Duration
+	batches   int64
+}
+
+func (s *batchStubServer) BatchCommands(stream tikvpb.Tikv_BatchCommandsServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.batches, 1)
+		time.Sleep(s.batchCost)
+		resp := &tikvpb.BatchCommandsResponse{
+			RequestIds:         req.GetRequestIds(),
+			TransportLayerLoad: s.load,
+		}
+		for range req.GetRequests() {
+			resp.Responses = append(resp.Responses, &tikvpb.BatchCommandsResponse_Response{
+				Cmd: &tikvpb.BatchCommandsResponse_Response_RawGet{RawGet: &kvrpcpb.RawGetResponse{Value: []byte("v")}},
+			})
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func startBatchStubServer(c interface{ Fatal(...interface{}) }, stub *batchStubServer) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.Fatal(err)
+	}
+	server := grpc.NewServer()
+	tikvpb.RegisterTikvServer(server, stub)
+	go server.Serve(l)
+	return l.Addr().String(), server.Stop
+}
+
+func newBatchTestClient(batch config.Batch) (*rpcClient, *config.RPC) {
+	conf := config.DefaultRPC()
+	conf.MaxConnectionCount = 1
+	conf.Batch = batch
+	return NewRPCClient(&conf).(*rpcClient), &conf
+}
+
+func sendRawGet(client Client, addr string) error {
+	req := &Request{Type: CmdRawGet, RawGet: &kvrpcpb.RawGetRequest{Key: []byte("k")}}
+	_, err := client.SendRequest(context.Background(), addr, req, 5*time.Second)
+	return err
+}
+
+func (s *testBatchControllerSuite) TestBatchSend(c *C) {
+	stub := &batchStubServer{load: 1000, batchCost: time.Millisecond}
+	addr, stop := startBatchStubServer(c, stub)
+	defer stop()
+	client, _ := newBatchTestClient(enabledBatch())
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Assert(sendRawGet(client, addr), IsNil)
+		}()
+	}
+	wg.Wait()
+	array, err := client.getConnArray(addr)
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt64(&array.batchController.inflight), Equals, int64(0))
+	c.Assert(atomic.LoadUint64(&array.batchController.transportLayerLoad), Equals, stub.load)
+	c.Assert(atomic.LoadInt64(&stub.batches), Less, int64(64))
+}
+
+func benchmarkBatchSend(b *testing.B, batch config.Batch, load uint64) {
+	stub := &batchStubServer{load: load, batchCost: 50 * time.Microsecond}
+	addr, stop := startBatchStubServer(b, stub)
+	defer stop()
+	client, _ := newBatchTestClient(batch)
+	defer client.Close()
+	if err := sendRawGet(client, addr); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := sendRawGet(client, addr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/float64(atomic.LoadInt64(&stub.batches)), "reqs/batch")
+}
+
+func BenchmarkBatchSendNoWait(b *testing.B) {
+	batch := enabledBatch()
+	batch.MaxWaitTime = 0
+	benchmarkBatchSend(b, batch, 300)
+}
+
+func BenchmarkBatchSendFixedWait(b *testing.B) {
+	batch := enabledBatch()
+	batch.Adaptive = false
+	benchmarkBatchSend(b, batch, 300)
+}
+
+func BenchmarkBatchSendAdaptiveIdle(b *testing.B) {
+	benchmarkBatchSend(b, enabledBatch(), 0)
+}
+
+func BenchmarkBatchSendAdaptiveOverload(b *testing.B) {
+	benchmarkBatchSend(b, enabledBatch(), 300)
+}
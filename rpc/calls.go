@@ -25,6 +25,7 @@ import (
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/kvproto/pkg/tikvpb"
+	"github.com/tikv/client-go/locate"
 )
 
 // CmdType represents the concrete request type in Request or response type in Response.
@@ -147,6 +148,11 @@ type Request struct {
 	MvccGetByKey       *kvrpcpb.MvccGetByKeyRequest
 	MvccGetByStartTs   *kvrpcpb.MvccGetByStartTsRequest
 	SplitRegion        *kvrpcpb.SplitRegionRequest
+
+	// ReplicaReadType is the type of the replica to read data from.
+	ReplicaReadType locate.ReplicaReadType
+	// ReplicaReadSeed is used to pick the replica for follower reads.
+	ReplicaReadSeed uint32
 }
 
 // ToBatchCommandsRequest converts the request to an entry in BatchCommands request.
@@ -289,6 +295,7 @@ func SetContext(req *Request, region *metapb.Region, peer *metapb.Peer) error {
 	ctx.RegionId = region.Id
 	ctx.RegionEpoch = region.RegionEpoch
 	ctx.Peer = peer
+	ctx.ReplicaRead = req.ReplicaReadType.IsFollowerRead()
 
 	switch req.Type {
 	case CmdGet:
@@ -47,25 +47,26 @@ type Client interface {
 }
 
 type connArray struct {
-	conf  *config.RPC
-	index uint32
-	conns []*grpc.ClientConn
+	conf   *config.RPC
+	target string
+	index  uint32
+	conns  []*grpc.ClientConn
 	// Bind with a background goroutine to process coprocessor streaming timeout.
 	streamTimeout chan *Lease
 
 	// For batch commands.
 	batchCommandsCh      chan *batchCommandsEntry
 	batchCommandsClients []*batchCommandsClient
-	transportLayerLoad   uint64
+	batchController      *batchController
 }
 
 type batchCommandsClient struct {
-	conf               *config.Batch
-	conn               *grpc.ClientConn
-	client             tikvpb.Tikv_BatchCommandsClient
-	batched            sync.Map
-	idAlloc            uint64
-	transportLayerLoad *uint64
+	conf       *config.Batch
+	conn       *grpc.ClientConn
+	client     tikvpb.Tikv_BatchCommandsClient
+	batched    sync.Map
+	idAlloc    uint64
+	controller *batchController
 
 	// Indicates the batch client is closed explicitly or not.
 	closed int32
@@ -84,6 +85,7 @@ func (c *batchCommandsClient) failPendingRequests(err error) {
 		entry.err = err
 		close(entry.res)
 		c.batched.Delete(id)
+		c.controller.onRecv(1)
 		return true
 	})
 }
@@ -142,11 +144,12 @@ func (c *batchCommandsClient) batchRecvLoop() {
 			}
 			c.batched.Delete(requestID)
 		}
+		c.controller.onRecv(len(resp.GetRequestIds()))
 
 		transportLayerLoad := resp.GetTransportLayerLoad()
 		if transportLayerLoad > 0.0 && c.conf.MaxWaitTime > 0 {
 			// We need to consider TiKV load only if batch-wait strategy is enabled.
-			atomic.StoreUint64(c.transportLayerLoad, transportLayerLoad)
+			c.controller.setTransportLayerLoad(transportLayerLoad)
 		}
 	}
 }
@@ -154,12 +157,13 @@ func (c *batchCommandsClient) batchRecvLoop() {
 func newConnArray(addr string, conf *config.RPC) (*connArray, error) {
 	a := &connArray{
 		conf:                 conf,
+		target:               addr,
 		index:                0,
 		conns:                make([]*grpc.ClientConn, conf.MaxConnectionCount),
 		streamTimeout:        make(chan *Lease, 1024),
 		batchCommandsCh:      make(chan *batchCommandsEntry, conf.Batch.MaxBatchSize),
 		batchCommandsClients: make([]*batchCommandsClient, 0, conf.Batch.MaxBatchSize),
-		transportLayerLoad:   0,
+		batchController:      &batchController{conf: &conf.Batch},
 	}
 	if err := a.Init(addr); err != nil {
 		return nil, err
@@ -169,7 +173,7 @@ func newConnArray(addr string, conf *config.RPC) (*connArray, error) {
 
 func (a *connArray) Init(addr string) error {
 	opt := grpc.WithInsecure()
-	if len(a.conf.Security.SSLCA) != 0 {
+	if a.conf.Security.Enabled() {
 		tlsConfig, err := a.conf.Security.ToTLSConfig()
 		if err != nil {
 			return err
@@ -177,8 +181,8 @@ func (a *connArray) Init(addr string) error {
 		opt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
 	}
 
-	unaryInterceptor := grpc_prometheus.UnaryClientInterceptor
-	streamInterceptor := grpc_prometheus.StreamClientInterceptor
+	unaryInterceptor := grpc_middleware.ChainUnaryClient(grpc_prometheus.UnaryClientInterceptor, compressUnary)
+	streamInterceptor := grpc_middleware.ChainStreamClient(grpc_prometheus.StreamClientInterceptor, compressStream)
 	if a.conf.EnableOpenTracing {
 		unaryInterceptor = grpc_middleware.ChainUnaryClient(
 			unaryInterceptor,
@@ -201,6 +205,7 @@ func (a *connArray) Init(addr string) error {
 			grpc.WithInitialConnWindowSize(int32(a.conf.GrpcInitialConnWindowSize)),
 			grpc.WithUnaryInterceptor(unaryInterceptor),
 			grpc.WithStreamInterceptor(streamInterceptor),
+			grpc.WithStatsHandler(compressionStats{}),
 			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(a.conf.GrpcMaxCallMsgSize)),
 			grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(a.conf.GrpcMaxSendMsgSize)),
 			grpc.WithBackoffMaxDelay(time.Second*3),
@@ -227,13 +232,13 @@ func (a *connArray) Init(addr string) error {
 				return errors.WithStack(err)
 			}
 			batchClient := &batchCommandsClient{
-				conf:               &a.conf.Batch,
-				conn:               conn,
-				client:             streamClient,
-				batched:            sync.Map{},
-				idAlloc:            0,
-				transportLayerLoad: &a.transportLayerLoad,
-				closed:             0,
+				conf:       &a.conf.Batch,
+				conn:       conn,
+				client:     streamClient,
+				batched:    sync.Map{},
+				idAlloc:    0,
+				controller: a.batchController,
+				closed:     0,
 			}
 			a.batchCommandsClients = append(a.batchCommandsClients, batchClient)
 			go batchClient.batchRecvLoop()
@@ -316,8 +321,6 @@ func fetchMorePendingRequests(
 	entries *[]*batchCommandsEntry,
 	requests *[]*tikvpb.BatchCommandsRequest_Request,
 ) {
-	waitStart := time.Now()
-
 	// Try to collect `batchWaitSize` requests, or wait `maxWaitTime`.
 	after := time.NewTimer(maxWaitTime)
 	for len(*entries) < batchWaitSize {
@@ -328,8 +331,7 @@ func fetchMorePendingRequests(
 			}
 			*entries = append(*entries, entry)
 			*requests = append(*requests, entry.req)
-		case waitEnd := <-after.C:
-			metrics.BatchWaitDuration.Observe(float64(waitEnd.Sub(waitStart)))
+		case <-after.C:
 			return
 		}
 	}
@@ -345,7 +347,6 @@ func fetchMorePendingRequests(
 			*entries = append(*entries, entry)
 			*requests = append(*requests, entry.req)
 		default:
-			metrics.BatchWaitDuration.Observe(float64(time.Since(waitStart)))
 			return
 		}
 	}
@@ -361,6 +362,8 @@ func (a *connArray) batchSendLoop() {
 	}()
 
 	conf := &a.conf.Batch
+	pendingRequests := metrics.StorePendingBatchRequests.WithLabelValues(a.target)
+	batchWaitDuration := metrics.StoreBatchWaitDuration.WithLabelValues(a.target)
 
 	entries := make([]*batchCommandsEntry, 0, conf.MaxBatchSize)
 	requests := make([]*tikvpb.BatchCommandsRequest_Request, 0, conf.MaxBatchSize)
@@ -376,16 +379,20 @@ func (a *connArray) batchSendLoop() {
 		requestIDs = requestIDs[:0]
 
 		metrics.PendingBatchRequests.Set(float64(len(a.batchCommandsCh)))
+		pendingRequests.Set(float64(len(a.batchCommandsCh)))
 		fetchAllPendingRequests(a.batchCommandsCh, int(conf.MaxBatchSize), &entries, &requests)
 
-		if len(entries) < int(conf.MaxBatchSize) && conf.MaxWaitTime > 0 {
-			transportLayerLoad := atomic.LoadUint64(batchCommandsClient.transportLayerLoad)
-			// If the target TiKV is overload, wait a while to collect more requests.
-			if uint(transportLayerLoad) >= conf.OverloadThreshold {
+		if len(entries) < int(conf.MaxBatchSize) {
+			// If the target TiKV is busy, wait a while to collect more requests.
+			if waitTime, waitSize := a.batchController.decide(); waitTime > 0 && len(entries) < waitSize {
+				waitStart := time.Now()
 				fetchMorePendingRequests(
-					a.batchCommandsCh, int(conf.MaxBatchSize), int(conf.MaxWaitSize),
-					conf.MaxWaitTime, &entries, &requests,
+					a.batchCommandsCh, int(conf.MaxBatchSize), waitSize,
+					waitTime, &entries, &requests,
 				)
+				waitDuration := float64(time.Since(waitStart))
+				metrics.BatchWaitDuration.Observe(waitDuration)
+				batchWaitDuration.Observe(waitDuration)
 			}
 		}
 
@@ -408,6 +415,7 @@ func (a *connArray) batchSendLoop() {
 		// Use the lock to protect the stream client won't be replaced by RecvLoop,
 		// and new added request won't be removed by `failPendingRequests`.
 		batchCommandsClient.clientLock.Lock()
+		a.batchController.onSend(length)
 		for i, requestID := range request.RequestIds {
 			batchCommandsClient.batched.Store(requestID, entries[i])
 		}
@@ -431,13 +439,16 @@ type rpcClient struct {
 	isClosed bool
 	conns    map[string]*connArray
 	conf     *config.RPC
+	// compressed are the command types that are compressed.
+	compressed map[CmdType]bool
 }
 
 // NewRPCClient manages connections and rpc calls with tikv-servers.
 func NewRPCClient(conf *config.RPC) Client {
 	return &rpcClient{
-		conns: make(map[string]*connArray),
-		conf:  conf,
+		conns:      make(map[string]*connArray),
+		conf:       conf,
+		compressed: compressedCommands(&conf.Compression),
 	}
 }
 
@@ -536,7 +547,11 @@ func (c *rpcClient) SendRequest(ctx context.Context, addr string, req *Request,
 		return nil, err
 	}
 
-	if c.conf.Batch.MaxBatchSize > 0 {
+	if c.compressed[req.Type] {
+		// A request can not be compressed in batch commands, it is compressed
+		// by the interceptors of connArray.
+		ctx = withCompression(ctx, c.conf.Compression.Compressor, req.Type)
+	} else if c.conf.Batch.MaxBatchSize > 0 {
 		if batchReq := req.ToBatchCommandsRequest(); batchReq != nil {
 			return sendBatchRequest(ctx, addr, connArray, batchReq, timeout)
 		}
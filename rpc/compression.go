@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/metrics"
+	"google.golang.org/grpc"
+	// Register the gzip compressor.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+// maxCmdType is greater than all the CmdType values.
+const maxCmdType = CmdSplitRegion + 1
+
+// compressedCommands returns the command types that are compressed by the
+// config. The unknown command types are ignored with a warning.
+func compressedCommands(conf *config.Compression) map[CmdType]bool {
+	if conf.Compressor == "" {
+		return nil
+	}
+	names := make(map[string]CmdType)
+	for t := CmdType(0); t < maxCmdType; t++ {
+		if name := t.String(); name != "Unknown" {
+			names[name] = t
+		}
+	}
+	commands := make(map[CmdType]bool)
+	for _, name := range conf.Commands {
+		t, ok := names[name]
+		if !ok {
+			log.Warnf("unknown command type %q to compress, ignore it", name)
+			continue
+		}
+		commands[t] = true
+	}
+	return commands
+}
+
+type compressionKey struct{}
+
+// compression is put in the context of a compressed request.
+type compression struct {
+	compressor string
+	cmdType    string
+}
+
+func withCompression(ctx context.Context, compressor string, cmdType CmdType) context.Context {
+	return context.WithValue(ctx, compressionKey{}, &compression{compressor: compressor, cmdType: cmdType.String()})
+}
+
+func compressionFromContext(ctx context.Context) *compression {
+	c, _ := ctx.Value(compressionKey{}).(*compression)
+	return c
+}
+
+// compressUnary compresses the unary requests with the compressor in the
+// context.
+func compressUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if c := compressionFromContext(ctx); c != nil {
+		opts = append(opts, grpc.UseCompressor(c.compressor))
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// compressStream compresses the streaming requests with the compressor in
+// the context.
+func compressStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if c := compressionFromContext(ctx); c != nil {
+		opts = append(opts, grpc.UseCompressor(c.compressor))
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// compressionStats records the bytes of the compressed requests before and
+// after compression.
+type compressionStats struct{}
+
+func (compressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	p, ok := s.(*stats.OutPayload)
+	if !ok {
+		return
+	}
+	if c := compressionFromContext(ctx); c != nil {
+		metrics.CompressionBytesCounter.WithLabelValues(c.cmdType, "before").Add(float64(p.Length))
+		metrics.CompressionBytesCounter.WithLabelValues(c.cmdType, "after").Add(float64(p.WireLength))
+	}
+}
+
+func (compressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionStats) HandleConn(context.Context, stats.ConnStats) {}
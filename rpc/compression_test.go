@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/tikvpb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/metrics"
+	"google.golang.org/grpc"
+)
+
+type testCompressionSuite struct{}
+
+var _ = Suite(&testCompressionSuite{})
+
+// compressionStubServer serves RawGet in BatchCommands and unary RawBatchPut.
+type compressionStubServer struct {
+	batchStubServer
+	puts int64
+}
+
+func (s *compressionStubServer) RawBatchPut(ctx context.Context, req *kvrpcpb.RawBatchPutRequest) (*kvrpcpb.RawBatchPutResponse, error) {
+	atomic.AddInt64(&s.puts, 1)
+	return &kvrpcpb.RawBatchPutResponse{}, nil
+}
+
+func (s *testCompressionSuite) TestCompression(c *C) {
+	stub := &compressionStubServer{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	server := grpc.NewServer()
+	tikvpb.RegisterTikvServer(server, stub)
+	go server.Serve(l)
+	defer server.Stop()
+	addr := l.Addr().String()
+
+	conf := config.DefaultRPC()
+	conf.MaxConnectionCount = 1
+	conf.Batch.MaxBatchSize = 128
+	conf.Compression.Compressor = "gzip"
+	conf.Compression.Commands = []string{"RawBatchPut", "Unknown"}
+	client := NewRPCClient(&conf)
+	defer client.Close()
+
+	before := metrics.CompressionBytesCounter.WithLabelValues("RawBatchPut", "before")
+	after := metrics.CompressionBytesCounter.WithLabelValues("RawBatchPut", "after")
+	before0, after0 := testutil.ToFloat64(before), testutil.ToFloat64(after)
+
+	pair := &kvrpcpb.KvPair{Key: []byte("k"), Value: bytes.Repeat([]byte("v"), 64*1024)}
+	req := &Request{Type: CmdRawBatchPut, RawBatchPut: &kvrpcpb.RawBatchPutRequest{Pairs: []*kvrpcpb.KvPair{pair}}}
+	_, err = client.SendRequest(context.Background(), addr, req, 5*time.Second)
+	c.Assert(err, IsNil)
+	// The compressed request is not sent in batch commands.
+	c.Assert(atomic.LoadInt64(&stub.puts), Equals, int64(1))
+	c.Assert(atomic.LoadInt64(&stub.batches), Equals, int64(0))
+	sent, wire := testutil.ToFloat64(before)-before0, testutil.ToFloat64(after)-after0
+	c.Assert(sent, Greater, float64(64*1024))
+	c.Assert(wire*10, Less, sent)
+
+	// The other requests are not compressed.
+	c.Assert(sendRawGet(client, addr), IsNil)
+	c.Assert(atomic.LoadInt64(&stub.batches), Equals, int64(1))
+	c.Assert(testutil.ToFloat64(before)-before0, Equals, sent)
+	c.Assert(testutil.ToFloat64(metrics.CompressionBytesCounter.WithLabelValues("RawGet", "before")), Equals, float64(0))
+}
@@ -0,0 +1,261 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package failpoint provides an rpc.Client that injects faults into requests,
+// to test how applications behave under partial failures. It works with both
+// the real and the mock RPC clients.
+package failpoint
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/rpc"
+	gcodes "google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+)
+
+// Fault is the kind of fault to inject.
+type Fault int
+
+// Fault values.
+const (
+	// NotLeader returns a NotLeader region error without a new leader.
+	NotLeader Fault = iota + 1
+	// EpochNotMatch returns an EpochNotMatch region error.
+	EpochNotMatch
+	// ServerIsBusy returns a ServerIsBusy region error.
+	ServerIsBusy
+	// Timeout waits for Rule.Latency and returns a DeadlineExceeded error
+	// without sending the request.
+	Timeout
+	// DropResponse sends the request, then drops the response and returns a
+	// DeadlineExceeded error. The request may have been applied.
+	DropResponse
+	// Delay waits for Rule.Latency before sending the request.
+	Delay
+)
+
+func (f Fault) String() string {
+	switch f {
+	case NotLeader:
+		return "NotLeader"
+	case EpochNotMatch:
+		return "EpochNotMatch"
+	case ServerIsBusy:
+		return "ServerIsBusy"
+	case Timeout:
+		return "Timeout"
+	case DropResponse:
+		return "DropResponse"
+	case Delay:
+		return "Delay"
+	}
+	return "Unknown"
+}
+
+// Rule describes a fault and the requests it is injected into. The zero
+// values of the filters match all requests.
+type Rule struct {
+	Fault Fault
+	// Cmds are the command types to inject into.
+	Cmds []rpc.CmdType
+	// StoreID is the store to inject into.
+	StoreID uint64
+	// RegionID is the region to inject into.
+	RegionID uint64
+	// Probability is the chance to inject into a matching request. 0 means
+	// always.
+	Probability float64
+	// Count is the max number of injections. 0 means unlimited.
+	Count int
+	// Latency is used by Timeout and Delay.
+	Latency time.Duration
+}
+
+func (r *Rule) match(req *rpc.Request) bool {
+	if r.StoreID != 0 && req.Context.GetPeer().GetStoreId() != r.StoreID {
+		return false
+	}
+	if r.RegionID != 0 && req.Context.GetRegionId() != r.RegionID {
+		return false
+	}
+	if len(r.Cmds) == 0 {
+		return true
+	}
+	for _, cmd := range r.Cmds {
+		if cmd == req.Type {
+			return true
+		}
+	}
+	return false
+}
+
+type rule struct {
+	Rule
+	injected int
+}
+
+// Client is an rpc.Client that injects faults into the requests sent by the
+// wrapped client. Rules are checked in the order they are enabled, and the
+// first one that fires is injected.
+type Client struct {
+	rpc.Client
+
+	mu     sync.Mutex
+	nextID int
+	ids    []int
+	rules  map[int]*rule
+	rand   *rand.Rand
+}
+
+// NewClient wraps client to inject faults.
+func NewClient(client rpc.Client) *Client {
+	return &Client{
+		Client: client,
+		rules:  make(map[int]*rule),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Interceptor returns an rpc.Interceptor that wraps the client with a
+// Client, and sets *c to it, so the faults can be controlled after the store
+// or raw client is created.
+func Interceptor(c **Client) rpc.Interceptor {
+	return func(next rpc.Client) rpc.Client {
+		*c = NewClient(next)
+		return *c
+	}
+}
+
+// Seed sets the seed of the random source used by Rule.Probability.
+func (c *Client) Seed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rand = rand.New(rand.NewSource(seed))
+}
+
+// Enable adds a rule and returns its ID.
+func (c *Client) Enable(r Rule) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	c.ids = append(c.ids, c.nextID)
+	c.rules[c.nextID] = &rule{Rule: r}
+	return c.nextID
+}
+
+// Disable removes the rule.
+func (c *Client) Disable(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rules, id)
+	for i, x := range c.ids {
+		if x == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// Reset removes all the rules.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = nil
+	c.rules = make(map[int]*rule)
+}
+
+// Injected returns how many times the rule has been injected.
+func (c *Client) Injected(id int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.rules[id]; ok {
+		return r.injected
+	}
+	return 0
+}
+
+func (c *Client) pick(req *rpc.Request) (Rule, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range c.ids {
+		r := c.rules[id]
+		if r.Count > 0 && r.injected >= r.Count {
+			continue
+		}
+		if !r.match(req) {
+			continue
+		}
+		if r.Probability > 0 && c.rand.Float64() >= r.Probability {
+			continue
+		}
+		r.injected++
+		return r.Rule, true
+	}
+	return Rule{}, false
+}
+
+// SendRequest sends the request with the wrapped client, injecting the fault
+// of the first rule that fires.
+func (c *Client) SendRequest(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration) (*rpc.Response, error) {
+	r, ok := c.pick(req)
+	if !ok {
+		return c.Client.SendRequest(ctx, addr, req, timeout)
+	}
+	switch r.Fault {
+	case NotLeader:
+		return rpc.GenRegionErrorResp(req, &errorpb.Error{NotLeader: &errorpb.NotLeader{RegionId: req.RegionId}})
+	case EpochNotMatch:
+		return rpc.GenRegionErrorResp(req, &errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}})
+	case ServerIsBusy:
+		return rpc.GenRegionErrorResp(req, &errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}})
+	case Timeout:
+		if err := sleep(ctx, r.Latency); err != nil {
+			return nil, err
+		}
+		return nil, errTimeout()
+	case DropResponse:
+		if _, err := c.Client.SendRequest(ctx, addr, req, timeout); err != nil {
+			return nil, err
+		}
+		return nil, errTimeout()
+	case Delay:
+		if err := sleep(ctx, r.Latency); err != nil {
+			return nil, err
+		}
+	}
+	return c.Client.SendRequest(ctx, addr, req, timeout)
+}
+
+func errTimeout() error {
+	return errors.WithStack(gstatus.Error(gcodes.DeadlineExceeded, "injected timeout"))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
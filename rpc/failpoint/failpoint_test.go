@@ -0,0 +1,146 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package failpoint_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
+	. "github.com/tikv/client-go/rpc/failpoint"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testFailpointSuite struct {
+	cluster     *mocktikv.Cluster
+	storeID     uint64
+	regionID    uint64
+	regionCache *locate.RegionCache
+	client      *Client
+}
+
+var _ = Suite(&testFailpointSuite{})
+
+func (s *testFailpointSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	s.storeID, _, s.regionID = mocktikv.BootstrapWithSingleStore(s.cluster)
+	conf := config.Default()
+	s.regionCache = locate.NewRegionCache(mocktikv.NewPDClient(s.cluster), &conf.RegionCache)
+	rpc.Chain(mocktikv.NewRPCClient(s.cluster, mocktikv.MustNewMVCCStore()), Interceptor(&s.client))
+	s.client.Seed(1)
+}
+
+func (s *testFailpointSuite) TearDownTest(c *C) {
+	c.Assert(s.client.Close(), IsNil)
+}
+
+// send sends req and retries on region errors, like the clients do.
+func (s *testFailpointSuite) send(c *C, req *rpc.Request, maxSleep int) (*rpc.Response, error) {
+	bo := retry.NewBackoffer(context.Background(), maxSleep)
+	sender := rpc.NewRegionRequestSender(s.regionCache, s.client)
+	for {
+		loc, err := s.regionCache.LocateKey(bo, []byte("k"))
+		c.Assert(err, IsNil)
+		resp, err := sender.SendReq(bo, req, loc.Region, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		regionErr, err := resp.GetRegionError()
+		c.Assert(err, IsNil)
+		if regionErr == nil {
+			return resp, nil
+		}
+		if err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String())); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *testFailpointSuite) put(c *C, value string, maxSleep int) error {
+	_, err := s.send(c, &rpc.Request{
+		Type:   rpc.CmdRawPut,
+		RawPut: &kvrpcpb.RawPutRequest{Key: []byte("k"), Value: []byte(value)},
+	}, maxSleep)
+	return err
+}
+
+func (s *testFailpointSuite) mustGet(c *C, value string) {
+	resp, err := s.send(c, &rpc.Request{
+		Type:   rpc.CmdRawGet,
+		RawGet: &kvrpcpb.RawGetRequest{Key: []byte("k")},
+	}, 5000)
+	c.Assert(err, IsNil)
+	c.Assert(resp.RawGet, NotNil)
+	c.Assert(string(resp.RawGet.GetValue()), Equals, value)
+}
+
+func (s *testFailpointSuite) TestRegionError(c *C) {
+	c.Assert(s.put(c, "v", 5000), IsNil)
+	for _, fault := range []Fault{NotLeader, EpochNotMatch, ServerIsBusy} {
+		id := s.client.Enable(Rule{Fault: fault, Cmds: []rpc.CmdType{rpc.CmdRawGet}, RegionID: s.regionID, Count: 1})
+		s.mustGet(c, "v")
+		c.Assert(s.client.Injected(id), Equals, 1, Commentf("%v", fault))
+		s.client.Disable(id)
+	}
+
+	// The filters do not match.
+	id := s.client.Enable(Rule{Fault: NotLeader, StoreID: s.storeID + 1})
+	id2 := s.client.Enable(Rule{Fault: NotLeader, Cmds: []rpc.CmdType{rpc.CmdRawPut}})
+	s.mustGet(c, "v")
+	c.Assert(s.client.Injected(id), Equals, 0)
+	c.Assert(s.client.Injected(id2), Equals, 0)
+}
+
+func (s *testFailpointSuite) TestTimeout(c *C) {
+	id := s.client.Enable(Rule{Fault: DropResponse, Cmds: []rpc.CmdType{rpc.CmdRawPut}})
+	c.Assert(s.put(c, "v", 100), NotNil)
+	c.Assert(s.client.Injected(id), Greater, 0)
+	// The request is applied even though the response is dropped.
+	s.mustGet(c, "v")
+	s.client.Reset()
+
+	id = s.client.Enable(Rule{Fault: Timeout, Latency: 10 * time.Millisecond, Count: 1})
+	s.mustGet(c, "v")
+	c.Assert(s.client.Injected(id), Equals, 1)
+}
+
+func (s *testFailpointSuite) TestDelay(c *C) {
+	c.Assert(s.put(c, "v", 5000), IsNil)
+	id := s.client.Enable(Rule{Fault: Delay, Latency: 50 * time.Millisecond})
+	start := time.Now()
+	s.mustGet(c, "v")
+	c.Assert(time.Since(start) >= 50*time.Millisecond, IsTrue)
+	c.Assert(s.client.Injected(id), Equals, 1)
+}
+
+func (s *testFailpointSuite) TestProbability(c *C) {
+	c.Assert(s.put(c, "v", 5000), IsNil)
+	id := s.client.Enable(Rule{Fault: Delay, Probability: 0.5})
+	for i := 0; i < 100; i++ {
+		s.mustGet(c, "v")
+	}
+	c.Assert(s.client.Injected(id), Greater, 20)
+	c.Assert(s.client.Injected(id), Less, 80)
+}
@@ -0,0 +1,269 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/metrics"
+	"github.com/tikv/client-go/retry"
+)
+
+const (
+	// latencyEWMAAlpha is the weight of a new sample in the latency EWMA.
+	latencyEWMAAlpha = 0.1
+	// hedgeBudgetBurst is the max number of hedged reads that can be sent in
+	// a burst.
+	hedgeBudgetBurst = 10
+)
+
+// latencyEWMA is the exponentially weighted moving average and variance of
+// the latency of a store.
+type latencyEWMA struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+func (e *latencyEWMA) observe(d time.Duration) {
+	x := float64(d)
+	if e.samples == 0 {
+		e.mean = x
+	} else {
+		diff := x - e.mean
+		incr := latencyEWMAAlpha * diff
+		e.mean += incr
+		e.variance = (1 - latencyEWMAAlpha) * (e.variance + diff*incr)
+	}
+	e.samples++
+}
+
+// HedgePolicy decides when to send a hedged read, that is a second read to
+// another replica while the first one is slow. It should be shared by the
+// senders of a client, as it keeps the latency of stores and the budget of
+// hedged reads.
+type HedgePolicy struct {
+	conf config.Hedge
+	// z is the number of standard deviations above the mean latency for the
+	// configured percentile, assuming the latency is normally distributed.
+	z float64
+
+	mu      sync.Mutex
+	latency map[string]*latencyEWMA
+	budget  float64
+}
+
+// NewHedgePolicy creates a HedgePolicy. It returns nil if hedged reads are
+// disabled.
+func NewHedgePolicy(conf config.Hedge) *HedgePolicy {
+	if !conf.Enable {
+		return nil
+	}
+	percentile := conf.Percentile
+	if percentile <= 0 || percentile >= 1 {
+		percentile = config.DefaultHedge().Percentile
+	}
+	return &HedgePolicy{
+		conf:    conf,
+		z:       math.Sqrt2 * math.Erfinv(2*percentile-1),
+		latency: make(map[string]*latencyEWMA),
+	}
+}
+
+// ObserveLatency records the latency of a request to the store at addr.
+func (p *HedgePolicy) ObserveLatency(addr string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.latency[addr]
+	if !ok {
+		e = &latencyEWMA{}
+		p.latency[addr] = e
+	}
+	e.observe(d)
+}
+
+// Delay returns how long to wait for the store at addr before sending a
+// hedged read. It is the estimated percentile of the latency, within
+// [MinDelay, MaxDelay].
+func (p *HedgePolicy) Delay(addr string) time.Duration {
+	p.mu.Lock()
+	e, ok := p.latency[addr]
+	var delay time.Duration
+	if ok {
+		delay = time.Duration(e.mean + p.z*math.Sqrt(e.variance))
+	}
+	p.mu.Unlock()
+	if !ok || delay > p.conf.MaxDelay {
+		return p.conf.MaxDelay
+	}
+	if delay < p.conf.MinDelay {
+		return p.conf.MinDelay
+	}
+	return delay
+}
+
+// hedgeable checks if the request can be hedged.
+func (p *HedgePolicy) hedgeable(req *Request) bool {
+	return req.Type == CmdGet || req.Type == CmdRawGet
+}
+
+// deposit adds BudgetRatio to the budget. It is called for every request sent
+// by sendReqHedged.
+func (p *HedgePolicy) deposit() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget = math.Min(p.budget+p.conf.BudgetRatio, hedgeBudgetBurst)
+}
+
+// refund returns a hedged read that is not sent to the budget.
+func (p *HedgePolicy) refund() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget++
+}
+
+// acquire takes a hedged read from the budget.
+func (p *HedgePolicy) acquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.budget < 1 {
+		return false
+	}
+	p.budget--
+	return true
+}
+
+type hedgeResult struct {
+	resp *Response
+	err  error
+}
+
+func (r hedgeResult) valid() bool {
+	if r.err != nil {
+		return false
+	}
+	regionErr, err := r.resp.GetRegionError()
+	return err == nil && regionErr == nil
+}
+
+func (s *RegionRequestSender) sendAndObserve(ctx context.Context, addr string, req *Request, timeout time.Duration) hedgeResult {
+	start := time.Now()
+	resp, err := s.client.SendRequest(ctx, addr, req, timeout)
+	if err == nil {
+		s.hedge.ObserveLatency(addr, time.Since(start))
+	}
+	return hedgeResult{resp: resp, err: err}
+}
+
+// sendReqHedged sends req to the peer of rpcCtx. If it does not return within
+// the delay of the store, a follower read of the same request is sent to
+// another replica, and the first valid response is returned. If neither is
+// valid, the result of the first request is returned, so it is handled as if
+// there is no hedged read. The context of the replica that the response comes
+// from is returned too.
+func (s *RegionRequestSender) sendReqHedged(bo *retry.Backoffer, rpcCtx *locate.RPCContext, req *Request, timeout time.Duration) (*Response, *locate.RPCContext, error) {
+	s.hedge.deposit()
+	ctx, cancel := context.WithCancel(bo.GetContext())
+	// The request that loses the race is canceled.
+	defer cancel()
+
+	primary := make(chan hedgeResult, 1)
+	go func() {
+		primary <- s.sendAndObserve(ctx, rpcCtx.Addr, req, timeout)
+	}()
+	timer := time.NewTimer(s.hedge.Delay(rpcCtx.Addr))
+	defer timer.Stop()
+	select {
+	case r := <-primary:
+		return r.resp, rpcCtx, r.err
+	case <-timer.C:
+	}
+
+	hedgeCtx, hedgeReq := s.hedgeRequest(bo, rpcCtx, req)
+	if hedgeCtx == nil {
+		r := <-primary
+		return r.resp, rpcCtx, r.err
+	}
+	metrics.HedgeCounter.WithLabelValues("sent").Inc()
+	hedged := make(chan hedgeResult, 1)
+	go func() {
+		hedged <- s.sendAndObserve(ctx, hedgeCtx.Addr, hedgeReq, timeout)
+	}()
+
+	select {
+	case r := <-primary:
+		if r.valid() {
+			return r.resp, rpcCtx, r.err
+		}
+		if h := <-hedged; h.valid() {
+			metrics.HedgeCounter.WithLabelValues("won").Inc()
+			return h.resp, hedgeCtx, nil
+		}
+		return r.resp, rpcCtx, r.err
+	case h := <-hedged:
+		if h.valid() {
+			metrics.HedgeCounter.WithLabelValues("won").Inc()
+			return h.resp, hedgeCtx, nil
+		}
+		r := <-primary
+		return r.resp, rpcCtx, r.err
+	}
+}
+
+// hedgeRequest picks another replica for the hedged read and builds the
+// request. It returns nil if there is no other replica or no budget.
+func (s *RegionRequestSender) hedgeRequest(bo *retry.Backoffer, rpcCtx *locate.RPCContext, req *Request) (*locate.RPCContext, *Request) {
+	var hedgeCtx *locate.RPCContext
+	for seed := req.ReplicaReadSeed + 1; seed <= req.ReplicaReadSeed+2; seed++ {
+		ctx, err := s.regionCache.GetRPCContext(bo, rpcCtx.Region, locate.ReplicaReadFollower, seed)
+		if err != nil || ctx == nil {
+			return nil, nil
+		}
+		if ctx.GetStoreID() != rpcCtx.GetStoreID() {
+			hedgeCtx = ctx
+			break
+		}
+	}
+	if hedgeCtx == nil {
+		return nil, nil
+	}
+	if !s.hedge.acquire() {
+		metrics.HedgeCounter.WithLabelValues("no_budget").Inc()
+		return nil, nil
+	}
+	if !s.regionCache.AllowStoreRequest(hedgeCtx.GetStoreID()) {
+		s.hedge.refund()
+		return nil, nil
+	}
+
+	hedgeReq := *req
+	switch req.Type {
+	case CmdGet:
+		get := *req.Get
+		hedgeReq.Get = &get
+	case CmdRawGet:
+		rawGet := *req.RawGet
+		hedgeReq.RawGet = &rawGet
+	}
+	hedgeReq.ReplicaReadType = locate.ReplicaReadFollower
+	if err := SetContext(&hedgeReq, hedgeCtx.Meta, hedgeCtx.Peer); err != nil {
+		return nil, nil
+	}
+	return hedgeCtx, &hedgeReq
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+// Interceptor wraps a Client to add behavior around its calls, such as
+// setting headers, logging or metrics. It works with any Client, including
+// the mock one.
+type Interceptor func(next Client) Client
+
+// SendRequestFunc is the signature of Client.SendRequest.
+type SendRequestFunc func(ctx context.Context, addr string, req *Request, timeout time.Duration) (*Response, error)
+
+// UnaryInterceptor is called for every request instead of the next client. It
+// should call next to send the request, and can inspect or change the request
+// and the response.
+type UnaryInterceptor func(ctx context.Context, addr string, req *Request, timeout time.Duration, next SendRequestFunc) (*Response, error)
+
+// NewUnaryInterceptor creates an Interceptor from a UnaryInterceptor.
+func NewUnaryInterceptor(f UnaryInterceptor) Interceptor {
+	return func(next Client) Client {
+		return &unaryInterceptorClient{Client: next, f: f}
+	}
+}
+
+type unaryInterceptorClient struct {
+	Client
+	f UnaryInterceptor
+}
+
+func (c *unaryInterceptorClient) SendRequest(ctx context.Context, addr string, req *Request, timeout time.Duration) (*Response, error) {
+	return c.f(ctx, addr, req, timeout, c.Client.SendRequest)
+}
+
+// Chain wraps client with the interceptors. The first interceptor is the
+// outermost one, it sees a request first and its response last.
+func Chain(client Client, interceptors ...Interceptor) Client {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		client = interceptors[i](client)
+	}
+	return client
+}
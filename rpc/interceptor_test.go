@@ -0,0 +1,64 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	. "github.com/tikv/client-go/rpc"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testInterceptorSuite struct{}
+
+var _ = Suite(&testInterceptorSuite{})
+
+func (s *testInterceptorSuite) TestChain(c *C) {
+	cluster := mocktikv.NewCluster()
+	storeID, peerID, regionID := mocktikv.BootstrapWithSingleStore(cluster)
+	addr := cluster.GetStore(storeID).GetAddress()
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return NewUnaryInterceptor(func(ctx context.Context, addr string, req *Request, timeout time.Duration, next SendRequestFunc) (*Response, error) {
+			calls = append(calls, name+" "+req.Type.String())
+			resp, err := next(ctx, addr, req, timeout)
+			c.Assert(err, IsNil)
+			calls = append(calls, name+" done")
+			return resp, err
+		})
+	}
+	client := Chain(mocktikv.NewRPCClient(cluster, mocktikv.MustNewMVCCStore()), record("a"), record("b"))
+	defer client.Close()
+
+	req := &Request{
+		Type:   CmdRawGet,
+		RawGet: &kvrpcpb.RawGetRequest{Key: []byte("k")},
+	}
+	region, _ := cluster.GetRegion(regionID)
+	c.Assert(SetContext(req, region, &metapb.Peer{Id: peerID, StoreId: storeID}), IsNil)
+	resp, err := client.SendRequest(context.Background(), addr, req, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(resp.RawGet, NotNil)
+	c.Assert(calls, DeepEquals, []string{"a RawGet", "b RawGet", "b done", "a done"})
+}
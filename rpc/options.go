@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+)
+
+// RequestOptions are the options of the requests sent to TiKV. They are
+// attached to a context by WithRequestOptions, and applied to all the
+// requests sent with the context by rawkv and txnkv. The zero values mean
+// unset and keep the options of the requests, so the options can only
+// override the requests with the non-zero values.
+type RequestOptions struct {
+	// Priority is the priority of the requests. The background jobs can use
+	// kvrpcpb.CommandPri_Low to leave resources to the online requests.
+	// CommandPri_Normal is the zero value, it does not override the priority
+	// of a request, e.g. the one set by the transaction.
+	Priority kvrpcpb.CommandPri
+	// IsolationLevel is the isolation level of the reads. IsolationLevel_SI
+	// is the zero value, it does not override the isolation level of a
+	// request.
+	IsolationLevel kvrpcpb.IsolationLevel
+	// NotFillCache makes the reads not fill the block cache of TiKV, which is
+	// useful for large scans. false does not override a request.
+	NotFillCache bool
+	// SyncLog makes the writes sync the raft log before they return. false
+	// does not override a request.
+	SyncLog bool
+	// TaskID groups the requests of a task. TiKV schedules the requests with
+	// the same task ID fairly, and they may share the same priority and
+	// resource quota. 0 does not override a request.
+	TaskID uint64
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a context that carries the request options.
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// RequestOptionsFromContext returns the request options carried by the
+// context.
+func RequestOptionsFromContext(ctx context.Context) (RequestOptions, bool) {
+	opts, ok := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts, ok
+}
+
+// BackgroundWithRequestOptions returns a background context that carries the
+// request options of ctx. It is used by the jobs that outlive the request,
+// like committing the secondary keys of a transaction.
+func BackgroundWithRequestOptions(ctx context.Context) context.Context {
+	if opts, ok := RequestOptionsFromContext(ctx); ok {
+		return WithRequestOptions(context.Background(), opts)
+	}
+	return context.Background()
+}
+
+// apply sets the options that are not zero values to the request context.
+func (o *RequestOptions) apply(ctx *kvrpcpb.Context) {
+	if o.Priority != kvrpcpb.CommandPri_Normal {
+		ctx.Priority = o.Priority
+	}
+	if o.IsolationLevel != kvrpcpb.IsolationLevel_SI {
+		ctx.IsolationLevel = o.IsolationLevel
+	}
+	if o.NotFillCache {
+		ctx.NotFillCache = true
+	}
+	if o.SyncLog {
+		ctx.SyncLog = true
+	}
+	if o.TaskID != 0 {
+		ctx.TaskId = o.TaskID
+	}
+}
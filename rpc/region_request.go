@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/tikv/client-go/locate"
@@ -50,6 +51,7 @@ type RegionRequestSender struct {
 	client      Client
 	storeAddr   string
 	rpcError    error
+	hedge       *HedgePolicy
 }
 
 // NewRegionRequestSender creates a new sender.
@@ -60,6 +62,12 @@ func NewRegionRequestSender(regionCache *locate.RegionCache, client Client) *Reg
 	}
 }
 
+// SetHedgePolicy enables hedged reads of the sender. A nil policy disables
+// them.
+func (s *RegionRequestSender) SetHedgePolicy(policy *HedgePolicy) {
+	s.hedge = policy
+}
+
 // RPCError returns an error if an RPC error is encountered during request.
 func (s *RegionRequestSender) RPCError() error {
 	return s.rpcError
@@ -88,8 +96,16 @@ func (s *RegionRequestSender) SendReq(bo *retry.Backoffer, req *Request, regionI
 	//	 }
 	// }
 
+	if budget := s.regionCache.RetryBudget(); budget != nil {
+		bo.SetRetryBudget(budget)
+	}
+	if opts, ok := RequestOptionsFromContext(bo.GetContext()); ok {
+		opts.apply(&req.Context)
+	}
+	// downStores is the number of the down stores that are skipped.
+	var downStores int
 	for {
-		ctx, err := s.regionCache.GetRPCContext(bo, regionID)
+		ctx, err := s.regionCache.GetRPCContext(bo, regionID, req.ReplicaReadType, req.ReplicaReadSeed)
 		if err != nil {
 			return nil, err
 		}
@@ -103,8 +119,26 @@ func (s *RegionRequestSender) SendReq(bo *retry.Backoffer, req *Request, regionI
 			return GenRegionErrorResp(req, &errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}})
 		}
 
+		if !s.regionCache.AllowStoreRequest(ctx.GetStoreID()) {
+			// The store is down, fail fast instead of waiting for the timeout.
+			// Replica reads try the other peers first.
+			s.rpcError = errors.Errorf("store %d is down, ctx: %v", ctx.GetStoreID(), ctx)
+			downStores++
+			if req.ReplicaReadType.IsFollowerRead() && downStores < len(ctx.Meta.GetPeers()) {
+				req.ReplicaReadSeed++
+				continue
+			}
+			// The leader may have moved to a healthy store, drop the region so
+			// that the next attempt reloads it from PD.
+			s.regionCache.DropRegion(ctx.Region)
+			return nil, retry.Classify(s.rpcError, retry.ErrStoreUnavailable, retry.ErrRetryable, retry.ErrRegionUnavailable)
+		}
+
 		s.storeAddr = ctx.Addr
-		resp, retry, err := s.sendReqToRegion(bo, ctx, req, timeout)
+		if ctx.Locality != "" {
+			metrics.ReplicaLocalityCounter.WithLabelValues(ctx.Locality).Inc()
+		}
+		resp, retry, err := s.sendReqToRegion(bo, ctx, req, clipTimeout(bo.GetContext(), timeout))
 		if err != nil {
 			return nil, err
 		}
@@ -117,7 +151,7 @@ func (s *RegionRequestSender) SendReq(bo *retry.Backoffer, req *Request, regionI
 			return nil, err
 		}
 		if regionErr != nil {
-			retry, err := s.onRegionError(bo, ctx, regionErr)
+			retry, err := s.onRegionError(bo, ctx, req, regionErr)
 			if err != nil {
 				return nil, err
 			}
@@ -133,45 +167,83 @@ func (s *RegionRequestSender) sendReqToRegion(bo *retry.Backoffer, ctx *locate.R
 	if e := SetContext(req, ctx.Meta, ctx.Peer); e != nil {
 		return nil, false, err
 	}
-	resp, err = s.client.SendRequest(bo.GetContext(), ctx.Addr, req, timeout)
+	// respCtx is the context of the replica that the response comes from.
+	respCtx := ctx
+	if s.hedge != nil && s.hedge.hedgeable(req) {
+		resp, respCtx, err = s.sendReqHedged(bo, ctx, req, timeout)
+	} else {
+		resp, err = s.client.SendRequest(bo.GetContext(), ctx.Addr, req, timeout)
+	}
 	if err != nil {
 		s.rpcError = err
 		if e := s.onSendFail(bo, ctx, err); e != nil {
-			return nil, false, err
+			return nil, false, e
 		}
+		// Try another replica next time for follower reads.
+		req.ReplicaReadSeed++
 		return nil, true, nil
 	}
+	s.regionCache.OnSendSuccess(respCtx)
 	return
 }
 
 func (s *RegionRequestSender) onSendFail(bo *retry.Backoffer, ctx *locate.RPCContext, err error) error {
 	// If it failed because the context is cancelled by ourself, don't retry.
 	if errors.Cause(err) == context.Canceled {
-		return err
+		return retry.Classify(err, retry.ErrContextCanceled)
 	}
-	code := codes.Unknown
-	if s, ok := status.FromError(errors.Cause(err)); ok {
-		code = s.Code()
-	}
-	if code == codes.Canceled {
-		select {
-		case <-bo.GetContext().Done():
-			return err
-		default:
-			// If we don't cancel, but the error code is Canceled, it must be from grpc remote.
-			// This may happen when tikv is killed and exiting.
-			// Backoff and retry in this case.
-			log.Warn("receive a grpc cancel signal from remote:", err)
-		}
+	// If the context is done, e.g. the deadline of the caller is exceeded, it
+	// is not the fault of the store, don't drop it or retry.
+	if e := bo.GetContext().Err(); e != nil {
+		return retry.Classify(err, retry.ErrContextCanceled, e)
+	}
+	if s, ok := status.FromError(errors.Cause(err)); ok && s.Code() == codes.Canceled {
+		// If we don't cancel, but the error code is Canceled, it must be from grpc remote.
+		// This may happen when tikv is killed and exiting.
+		// Backoff and retry in this case.
+		log.Warn("receive a grpc cancel signal from remote:", err)
 	}
 
 	s.regionCache.DropStoreOnSendRequestFail(ctx, err)
 
+	// Fail fast if the store has been retried too much, so the retries of all
+	// the requests do not overload it further.
+	if !s.regionCache.RetryBudget().AcquireStore(ctx.GetStoreID()) {
+		err = errors.Wrapf(err, "store %d retry budget exhausted, ctx: %v", ctx.GetStoreID(), ctx)
+		return retry.Classify(err, retry.ErrRetryBudgetExhausted, retry.ErrRetryable, retry.ErrRegionUnavailable)
+	}
+
 	// Retry on send request failure when it's not canceled.
 	// When a store is not available, the leader of related region should be elected quickly.
 	// TODO: the number of retry time should be limited:since region may be unavailable
 	// when some unrecoverable disaster happened.
-	return bo.Backoff(retry.BoTiKVRPC, errors.Errorf("send tikv request error: %v, ctx: %v, try next peer later", err, ctx))
+	return bo.Backoff(retry.BoTiKVRPC, errors.Wrapf(err, "send tikv request error, ctx: %v, try next peer later", ctx))
+}
+
+// clipTimeout returns the smaller of timeout and the time left before the
+// deadline of ctx.
+func clipTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			return left
+		}
+	}
+	return timeout
+}
+
+// NewStoreProbeFunc creates a function that probes stores by sending a
+// request that does not belong to any region. Any response, including the
+// region error, means the store is reachable.
+func NewStoreProbeFunc(client Client, timeout time.Duration) locate.StoreProbeFunc {
+	return func(ctx context.Context, addr string) error {
+		req := &Request{
+			Type:   CmdRawGet,
+			RawGet: &kvrpcpb.RawGetRequest{},
+		}
+		req.RawGet.Context = &req.Context
+		_, err := client.SendRequest(ctx, addr, req, timeout)
+		return err
+	}
 }
 
 func regionErrorToLabel(e *errorpb.Error) string {
@@ -193,8 +265,20 @@ func regionErrorToLabel(e *errorpb.Error) string {
 	return "unknown"
 }
 
-func (s *RegionRequestSender) onRegionError(bo *retry.Backoffer, ctx *locate.RPCContext, regionErr *errorpb.Error) (retryable bool, err error) {
+func (s *RegionRequestSender) onRegionError(bo *retry.Backoffer, ctx *locate.RPCContext, req *Request, regionErr *errorpb.Error) (retryable bool, err error) {
 	metrics.RegionErrorCounter.WithLabelValues(regionErrorToLabel(regionErr)).Inc()
+	if notLeader := regionErr.GetNotLeader(); notLeader != nil && req.ReplicaReadType.IsFollowerRead() {
+		// The follower cannot serve the read, for example, it is not ready or
+		// does not support follower read. Fall back to the leader.
+		// TiKV versions that report `DataIsNotReady` should be handled here too,
+		// but it is not in the kvproto this client uses.
+		log.Debugf("tikv reports `NotLeader` for follower read: %s, ctx: %v, retry leader", notLeader, ctx)
+		if leader := notLeader.GetLeader(); leader != nil {
+			s.regionCache.UpdateLeader(ctx.Region, leader.GetStoreId())
+		}
+		req.ReplicaReadType = locate.ReplicaReadLeader
+		return true, nil
+	}
 	if notLeader := regionErr.GetNotLeader(); notLeader != nil {
 		// Retry if error is `NotLeader`.
 		log.Debugf("tikv reports `NotLeader`: %s, ctx: %v, retry later", notLeader, ctx)
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	. "github.com/tikv/client-go/rpc"
+)
+
+type testRegionRequestSuite struct{}
+
+var _ = Suite(&testRegionRequestSuite{})
+
+func (s *testRegionRequestSuite) TestTimeoutWithDeadline(c *C) {
+	cluster := mocktikv.NewCluster()
+	_, _, regionID := mocktikv.BootstrapWithSingleStore(cluster)
+	conf := config.DefaultRegionCache()
+	cache := locate.NewRegionCache(mocktikv.NewPDClient(cluster), &conf)
+
+	var timeouts []time.Duration
+	client := Chain(mocktikv.NewRPCClient(cluster, mocktikv.MustNewMVCCStore()), NewUnaryInterceptor(
+		func(ctx context.Context, addr string, req *Request, timeout time.Duration, next SendRequestFunc) (*Response, error) {
+			timeouts = append(timeouts, timeout)
+			return next(ctx, addr, req, timeout)
+		}))
+	defer client.Close()
+	sender := NewRegionRequestSender(cache, client)
+
+	send := func(ctx context.Context) {
+		bo := retry.NewBackoffer(ctx, 1000)
+		loc, err := cache.LocateKey(bo, []byte("k"))
+		c.Assert(err, IsNil)
+		c.Assert(loc.Region.GetID(), Equals, regionID)
+		req := &Request{
+			Type:   CmdRawGet,
+			RawGet: &kvrpcpb.RawGetRequest{Key: []byte("k")},
+		}
+		_, err = sender.SendReq(bo, req, loc.Region, time.Minute)
+		c.Assert(err, IsNil)
+	}
+
+	send(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	send(ctx)
+	c.Assert(timeouts, HasLen, 2)
+	c.Assert(timeouts[0], Equals, time.Minute)
+	c.Assert(timeouts[1], LessEqual, time.Second)
+	c.Assert(timeouts[1], Greater, time.Duration(0))
+}
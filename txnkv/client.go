@@ -17,7 +17,9 @@ import (
 	"context"
 
 	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/coprocessor"
 	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
 	"github.com/tikv/client-go/txnkv/store"
 )
 
@@ -26,9 +28,10 @@ type Client struct {
 	tikvStore *store.TiKVStore
 }
 
-// NewClient creates a client with PD addresses.
-func NewClient(ctx context.Context, pdAddrs []string, config config.Config) (*Client, error) {
-	tikvStore, err := store.NewStore(ctx, pdAddrs, config)
+// NewClient creates a client with PD addresses. The interceptors wrap the RPC
+// client, the first one is the outermost.
+func NewClient(ctx context.Context, pdAddrs []string, config config.Config, interceptors ...rpc.Interceptor) (*Client, error) {
+	tikvStore, err := store.NewStore(ctx, pdAddrs, config, interceptors...)
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +45,13 @@ func (c *Client) Close() error {
 	return c.tikvStore.Close()
 }
 
+// UpdateConfig updates the configurations that can be changed at runtime,
+// like timeouts and batch sizes, without rebuilding the client. Changing other
+// fields results in an error.
+func (c *Client) UpdateConfig(conf config.Config) error {
+	return c.tikvStore.UpdateConfig(conf)
+}
+
 // Begin creates a transaction for read/write.
 func (c *Client) Begin(ctx context.Context) (*Transaction, error) {
 	ts, err := c.GetTS(ctx)
@@ -53,10 +63,33 @@ func (c *Client) Begin(ctx context.Context) (*Transaction, error) {
 
 // BeginWithTS creates a transaction which is normally readonly.
 func (c *Client) BeginWithTS(ctx context.Context, ts uint64) *Transaction {
-	return newTransaction(c.tikvStore, ts)
+	// It never fails without options.
+	txn, _ := newTransaction(c.tikvStore, ts)
+	return txn
+}
+
+// BeginWithOptions creates a transaction for read/write with the options. It
+// returns an error if the options are invalid.
+func (c *Client) BeginWithOptions(ctx context.Context, opts ...TxnOption) (*Transaction, error) {
+	ts, err := c.GetTS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.BeginWithTSAndOptions(ctx, ts, opts...)
+}
+
+// BeginWithTSAndOptions creates a transaction with the timestamp and the
+// options. It returns an error if the options are invalid.
+func (c *Client) BeginWithTSAndOptions(ctx context.Context, ts uint64, opts ...TxnOption) (*Transaction, error) {
+	return newTransaction(c.tikvStore, ts, opts...)
 }
 
 // GetTS returns a latest timestamp.
 func (c *Client) GetTS(ctx context.Context) (uint64, error) {
-	return c.tikvStore.GetTimestampWithRetry(retry.NewBackoffer(ctx, retry.TsoMaxBackoff))
+	return c.tikvStore.GetTimestampWithRetry(retry.NewBackofferWithConfig(ctx, &c.tikvStore.GetConfig().Retry, retry.OpTso))
+}
+
+// GetCoprocessorClient returns a client to send coprocessor requests.
+func (c *Client) GetCoprocessorClient() *coprocessor.Client {
+	return coprocessor.NewClient(c.tikvStore)
 }
@@ -17,6 +17,7 @@ import (
 	"context"
 
 	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/locate"
 )
 
 // Priority value for transaction priority.
@@ -101,7 +102,8 @@ type Iterator interface {
 	Close()
 }
 
-// Transaction options
+// Transaction options. They are set by the deprecated Transaction.SetOption,
+// use the typed txnkv.TxnOption instead.
 const (
 	// PresumeKeyNotExists indicates that when dealing with a Get operation but failing to read data from cache,
 	// we presume that the key does not exist in Store. The actual existence will be checked before the
@@ -112,8 +114,12 @@ const (
 	// When PresumeKeyNotExists is set and condition is not match, should throw the error.
 	PresumeKeyNotExistsError
 	// BinlogInfo contains the binlog data and client.
+	//
+	// Deprecated: it has no effect in this client.
 	BinlogInfo
 	// SchemaChecker is used for checking schema-validity.
+	//
+	// Deprecated: it has no effect in this client.
 	SchemaChecker
 	// IsolationLevel sets isolation level for current transaction. The default level is SI.
 	IsolationLevel
@@ -125,4 +131,20 @@ const (
 	SyncLog
 	// KeyOnly retrieve only keys, it can be used in scan now.
 	KeyOnly
+	// ReplicaRead sets the replica to read data from, the value is a ReplicaReadType.
+	ReplicaRead
+)
+
+// ReplicaReadType is the type of the replica to read data from.
+type ReplicaReadType = locate.ReplicaReadType
+
+const (
+	// ReplicaReadLeader stands for 'read from the leader'.
+	ReplicaReadLeader = locate.ReplicaReadLeader
+	// ReplicaReadFollower stands for 'read from the followers'. Learners are
+	// followers here too.
+	ReplicaReadFollower = locate.ReplicaReadFollower
+	// ReplicaReadMixed stands for 'read from the leader and the followers in
+	// turn'.
+	ReplicaReadMixed = locate.ReplicaReadMixed
 )
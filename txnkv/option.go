@@ -0,0 +1,188 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package txnkv
+
+import (
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/txnkv/kv"
+)
+
+// ErrReadOnlyTxn is the error that writing or locking keys in a read-only
+// transaction.
+var ErrReadOnlyTxn = errors.New("transaction is read-only")
+
+// TxnOption customizes a transaction. The options are passed to
+// BeginWithOptions or BeginWithTSAndOptions, and they are validated before the
+// transaction is created.
+type TxnOption func(*txnOptions)
+
+// txnOptions are the options of a transaction.
+type txnOptions struct {
+	isolationLevel      kvrpcpb.IsolationLevel
+	priority            kvrpcpb.CommandPri
+	replicaRead         kv.ReplicaReadType
+	readOnly            bool
+	notFillCache        bool
+	syncLog             bool
+	keyOnly             bool
+	presumeKeyNotExists bool
+	presumeKeyErr       error
+}
+
+// WithIsolationLevel sets the isolation level of the reads. The default level
+// is SI, and RC reads the latest committed values without waiting for locks.
+func WithIsolationLevel(level kvrpcpb.IsolationLevel) TxnOption {
+	return func(o *txnOptions) { o.isolationLevel = level }
+}
+
+// WithPriority sets the priority of the requests of the transaction.
+func WithPriority(priority kvrpcpb.CommandPri) TxnOption {
+	return func(o *txnOptions) { o.priority = priority }
+}
+
+// WithReplicaRead sets the replica to read data from.
+func WithReplicaRead(replicaRead kv.ReplicaReadType) TxnOption {
+	return func(o *txnOptions) { o.replicaRead = replicaRead }
+}
+
+// WithReadOnly makes the transaction read-only. Writing or locking keys in it
+// results in ErrReadOnlyTxn.
+func WithReadOnly() TxnOption {
+	return func(o *txnOptions) { o.readOnly = true }
+}
+
+// WithNotFillCache makes the reads not fill the block cache of TiKV, which is
+// useful for large scans.
+func WithNotFillCache() TxnOption {
+	return func(o *txnOptions) { o.notFillCache = true }
+}
+
+// WithSyncLog makes the commit sync the raft log before it returns.
+func WithSyncLog() TxnOption {
+	return func(o *txnOptions) { o.syncLog = true }
+}
+
+// WithKeyOnly makes the iterators retrieve only keys.
+func WithKeyOnly() TxnOption {
+	return func(o *txnOptions) { o.keyOnly = true }
+}
+
+// WithPresumeKeyNotExists makes Get presume that the keys not in the buffer
+// do not exist in TiKV, instead of reading them. The existence is checked when
+// the transaction commits, and err is returned if any of the keys exists. If
+// err is nil, kv.ErrKeyExists is returned. It is an optimization for frequent
+// checks in a transaction, e.g. batch inserts.
+func WithPresumeKeyNotExists(err error) TxnOption {
+	return func(o *txnOptions) {
+		o.presumeKeyNotExists = true
+		o.presumeKeyErr = err
+	}
+}
+
+func (o *txnOptions) validate() error {
+	if _, ok := kvrpcpb.IsolationLevel_name[int32(o.isolationLevel)]; !ok {
+		return errors.Errorf("invalid isolation level %d", o.isolationLevel)
+	}
+	if _, ok := kvrpcpb.CommandPri_name[int32(o.priority)]; !ok {
+		return errors.Errorf("invalid priority %d", o.priority)
+	}
+	if o.replicaRead > kv.ReplicaReadMixed {
+		return errors.Errorf("invalid replica read type %d", o.replicaRead)
+	}
+	if o.readOnly && o.syncLog {
+		return errors.New("sync log can not be set for a read-only transaction")
+	}
+	if o.readOnly && o.presumeKeyNotExists {
+		return errors.New("presume key not exists can not be set for a read-only transaction")
+	}
+	return nil
+}
+
+// isoLevels maps the isolation levels of kv to the ones of kvrpcpb.
+var isoLevels = map[kv.IsoLevel]kvrpcpb.IsolationLevel{
+	kv.SI: kvrpcpb.IsolationLevel_SI,
+	kv.RC: kvrpcpb.IsolationLevel_RC,
+}
+
+// kvOption converts an untyped option of SetOption to a TxnOption. A nil value
+// resets the option to the default.
+func kvOption(opt kv.Option, val interface{}) (TxnOption, error) {
+	var ok bool
+	switch opt {
+	case kv.PresumeKeyNotExists:
+		return func(o *txnOptions) { o.presumeKeyNotExists = true }, nil
+	case kv.PresumeKeyNotExistsError:
+		var err error
+		if err, ok = val.(error); val != nil && !ok {
+			break
+		}
+		return func(o *txnOptions) { o.presumeKeyErr = err }, nil
+	case kv.IsolationLevel:
+		var level kvrpcpb.IsolationLevel
+		switch v := val.(type) {
+		case nil:
+		case kv.IsoLevel:
+			if level, ok = isoLevels[v]; !ok {
+				return nil, errors.Errorf("invalid isolation level %d", v)
+			}
+		case kvrpcpb.IsolationLevel:
+			level = v
+		default:
+			return nil, errors.Errorf("invalid value %v of type %T for option %d", val, val, opt)
+		}
+		return WithIsolationLevel(level), nil
+	case kv.Priority:
+		var priority int
+		if priority, ok = val.(int); val != nil && !ok {
+			break
+		}
+		return WithPriority(kvrpcpb.CommandPri(priority)), nil
+	case kv.ReplicaRead:
+		var replicaRead kv.ReplicaReadType
+		if replicaRead, ok = val.(kv.ReplicaReadType); val != nil && !ok {
+			break
+		}
+		return WithReplicaRead(replicaRead), nil
+	case kv.NotFillCache, kv.SyncLog, kv.KeyOnly:
+		var b bool
+		if b, ok = val.(bool); val != nil && !ok {
+			break
+		}
+		return func(o *txnOptions) {
+			switch opt {
+			case kv.NotFillCache:
+				o.notFillCache = b
+			case kv.SyncLog:
+				o.syncLog = b
+			case kv.KeyOnly:
+				o.keyOnly = b
+			}
+		}, nil
+	default:
+		return nil, errors.Errorf("option %d has no effect", opt)
+	}
+	return nil, errors.Errorf("invalid value %v of type %T for option %d", val, val, opt)
+}
+
+// kvOptionDefault returns a TxnOption that resets the option to the default.
+func kvOptionDefault(opt kv.Option) TxnOption {
+	if opt == kv.PresumeKeyNotExists {
+		return func(o *txnOptions) { o.presumeKeyNotExists = false }
+	}
+	if f, err := kvOption(opt, nil); err == nil {
+		return f
+	}
+	return func(*txnOptions) {}
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracles
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/txnkv/oracle"
+)
+
+// hlcWindow is how far the physical time of timestamps can go before the
+// window has to be persisted again.
+const hlcWindow = 3 * time.Second
+
+// Clock is the source of physical time of HLCOracle.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only changes when it is told to. It is used in
+// tests.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock creates a FakeClock starting at t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set sets the time of the clock. It can go backwards.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+var _ oracle.Oracle = &HLCOracle{}
+
+// HLCOracle is an Oracle that generates timestamps by hybrid logical clock.
+// The physical part follows the clock, but never goes backwards when the clock
+// does. The logical part is increased when the physical part does not move.
+//
+// The oracle reserves a window of physical time and persists its end to a file
+// before giving out timestamps in it. After a restart, timestamps start after
+// the saved window, so they keep ascending even if the clock was set back.
+type HLCOracle struct {
+	mu        sync.Mutex
+	clock     Clock
+	path      string
+	lastTS    uint64
+	windowEnd int64 // physical time in ms, exclusive
+}
+
+// NewHLCOracle creates an HLCOracle that persists its window in the file at
+// path. If clock is nil, the system clock is used.
+func NewHLCOracle(path string, clock Clock) (*HLCOracle, error) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	o := &HLCOracle{
+		clock: clock,
+		path:  path,
+	}
+	windowEnd, err := o.loadWindow()
+	if err != nil {
+		return nil, err
+	}
+	if windowEnd > 0 {
+		// Timestamps before the saved window end may have been used.
+		o.windowEnd = windowEnd
+		o.lastTS = oracle.ComposeTS(windowEnd, 0) - 1
+	}
+	return o, nil
+}
+
+// GetTimestamp gets a new increasing timestamp.
+func (o *HLCOracle) GetTimestamp(context.Context) (uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ts := oracle.ComposeTS(oracle.GetPhysical(o.clock.Now()), 0)
+	if ts <= o.lastTS {
+		// An overflowed logical part carries over to the physical part.
+		ts = o.lastTS + 1
+	}
+	if physical := oracle.ExtractPhysical(ts); physical >= o.windowEnd {
+		windowEnd := physical + int64(hlcWindow/time.Millisecond)
+		if err := o.saveWindow(windowEnd); err != nil {
+			return 0, err
+		}
+		o.windowEnd = windowEnd
+	}
+	o.lastTS = ts
+	return ts, nil
+}
+
+// Observe updates the clock by a timestamp received from others, so that the
+// following timestamps are greater than it.
+func (o *HLCOracle) Observe(ts uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ts > o.lastTS {
+		o.lastTS = ts
+	}
+}
+
+// GetTimestampAsync gets a timestamp asynchronously.
+func (o *HLCOracle) GetTimestampAsync(ctx context.Context) oracle.Future {
+	return &hlcFuture{ctx: ctx, o: o}
+}
+
+// IsExpired returns whether lockTS+TTL is expired, both are ms. It uses the
+// clock of the oracle.
+func (o *HLCOracle) IsExpired(lockTS uint64, TTL uint64) bool {
+	return oracle.GetPhysical(o.clock.Now()) >= oracle.ExtractPhysical(lockTS)+int64(TTL)
+}
+
+// Close closes the oracle.
+func (o *HLCOracle) Close() {
+}
+
+func (o *HLCOracle) loadWindow() (int64, error) {
+	data, err := ioutil.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if len(data) != 8 {
+		return 0, errors.Errorf("invalid hlc window file %s", o.path)
+	}
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+// saveWindow writes the window end to a temp file, then renames it, so the
+// file is never partially written.
+func (o *HLCOracle) saveWindow(windowEnd int64) error {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(windowEnd))
+	f, err := ioutil.TempFile(filepath.Dir(o.path), filepath.Base(o.path)+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(data[:])
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+type hlcFuture struct {
+	ctx context.Context
+	o   *HLCOracle
+}
+
+func (f *hlcFuture) Wait() (uint64, error) {
+	return f.o.GetTimestamp(f.ctx)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracles
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tikv/client-go/txnkv/oracle"
+)
+
+func newTestHLCOracle(t *testing.T, dir string, clock Clock) *HLCOracle {
+	o, err := NewHLCOracle(filepath.Join(dir, "hlc"), clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func mustGetTS(t *testing.T, o oracle.Oracle) uint64 {
+	ts, err := o.GetTimestamp(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestHLCOracle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hlc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Unix(1500000000, 0)
+	clock := NewFakeClock(start)
+	o := newTestHLCOracle(t, dir, clock)
+
+	// The logical part increases while the clock stands still.
+	ts1 := mustGetTS(t, o)
+	ts2 := mustGetTS(t, o)
+	if ts1 != oracle.ComposeTS(oracle.GetPhysical(start), 0) || ts2 != ts1+1 {
+		t.Errorf("unexpected ts %d, %d", ts1, ts2)
+	}
+
+	// The physical part follows the clock.
+	clock.Advance(time.Second)
+	ts3 := mustGetTS(t, o)
+	if ts3 != oracle.ComposeTS(oracle.GetPhysical(start.Add(time.Second)), 0) {
+		t.Errorf("unexpected ts %d", ts3)
+	}
+
+	// The ts does not go back with the clock.
+	clock.Set(start)
+	if ts4 := mustGetTS(t, o); ts4 != ts3+1 {
+		t.Errorf("unexpected ts %d", ts4)
+	}
+
+	// Timestamps received from others are respected.
+	remote := oracle.ComposeTS(oracle.GetPhysical(start.Add(time.Minute)), 5)
+	o.Observe(remote)
+	if ts5 := mustGetTS(t, o); ts5 != remote+1 {
+		t.Errorf("unexpected ts %d", ts5)
+	}
+
+	// After restart, the ts is greater than the saved window even if the clock
+	// goes back.
+	last := mustGetTS(t, o)
+	o.Close()
+	o = newTestHLCOracle(t, dir, NewFakeClock(start.Add(-time.Hour)))
+	if ts := mustGetTS(t, o); ts <= last || oracle.ExtractPhysical(ts) < oracle.ExtractPhysical(last)+int64(hlcWindow/time.Millisecond) {
+		t.Errorf("ts %d should be after the window of %d", ts, last)
+	}
+}
+
+func TestHLCOracleAsync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hlc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := NewFakeClock(time.Now())
+	o := newTestHLCOracle(t, dir, clock)
+	defer o.Close()
+	futures := make([]oracle.Future, 100)
+	for i := range futures {
+		futures[i] = o.GetTimestampAsync(context.Background())
+	}
+	var last uint64
+	for _, f := range futures {
+		ts, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts <= last {
+			t.Errorf("ts %d is not greater than %d", ts, last)
+		}
+		last = ts
+	}
+
+	if o.IsExpired(last, 100) {
+		t.Error("should not expired")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if !o.IsExpired(last, 100) {
+		t.Error("should expired")
+	}
+}
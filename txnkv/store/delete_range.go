@@ -16,13 +16,92 @@ package store
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
+	"sync"
+	"time"
 
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/key"
 	"github.com/tikv/client-go/retry"
 	"github.com/tikv/client-go/rpc"
 )
 
+// DefaultEstimatedRegionSize is the region size used to account bytes for
+// DeleteRangeRateLimit when it is not set.
+const DefaultEstimatedRegionSize = 96 << 20
+
+// DeleteRangeRateLimit limits the speed of a DeleteRangeTask. A zero field
+// means no limit.
+type DeleteRangeRateLimit struct {
+	RegionsPerSecond float64
+	// BytesPerSecond limits the bytes deleted per second. TiKV does not report
+	// the size of deleted data, so each region is counted as
+	// EstimatedRegionSize bytes.
+	BytesPerSecond      float64
+	EstimatedRegionSize int64
+}
+
+// DeleteRangeProgress is reported to the progress callback of a
+// DeleteRangeTask each time a region is finished.
+type DeleteRangeProgress struct {
+	CompletedRegions int
+	// Checkpoint is the key before which all keys of the range have been
+	// deleted.
+	Checkpoint []byte
+	// Finished is true if all keys of the range have been deleted.
+	Finished bool
+}
+
+// DeleteRangeCheckpointStore persists checkpoints of DeleteRangeTasks, so that
+// a task can resume after the process restarts.
+type DeleteRangeCheckpointStore interface {
+	// LoadCheckpoint returns the saved checkpoint of the task, or nil if there
+	// is none. finished is true if the task has deleted the whole range.
+	LoadCheckpoint(taskID string) (checkpoint []byte, finished bool, err error)
+	// SaveCheckpoint saves the checkpoint of the task. finished is true when
+	// the task has deleted the whole range, the checkpoint is the end key of
+	// the range then, which is nil for an unbounded range.
+	SaveCheckpoint(taskID string, checkpoint []byte, finished bool) error
+}
+
+const (
+	deleteRangeCheckpointPrefix = "/tikv/delete_range/checkpoint/"
+	// deleteRangeFinished is saved as the checkpoint of a finished task. It
+	// is not a hex string, so it never conflicts with a key.
+	deleteRangeFinished = "finished"
+)
+
+type kvCheckpointStore struct {
+	kv SafePointKV
+}
+
+// NewDeleteRangeCheckpointStore creates a DeleteRangeCheckpointStore that
+// saves checkpoints in the SafePointKV.
+func NewDeleteRangeCheckpointStore(kv SafePointKV) DeleteRangeCheckpointStore {
+	return &kvCheckpointStore{kv: kv}
+}
+
+func (s *kvCheckpointStore) LoadCheckpoint(taskID string) ([]byte, bool, error) {
+	str, err := s.kv.Get(deleteRangeCheckpointPrefix + taskID)
+	if err != nil || str == "" {
+		return nil, false, err
+	}
+	if str == deleteRangeFinished {
+		return nil, true, nil
+	}
+	checkpoint, err := hex.DecodeString(str)
+	return checkpoint, false, errors.WithStack(err)
+}
+
+func (s *kvCheckpointStore) SaveCheckpoint(taskID string, checkpoint []byte, finished bool) error {
+	if finished {
+		return s.kv.Put(deleteRangeCheckpointPrefix+taskID, deleteRangeFinished)
+	}
+	return s.kv.Put(deleteRangeCheckpointPrefix+taskID, hex.EncodeToString(checkpoint))
+}
+
 // DeleteRangeTask is used to delete all keys in a range. After
 // performing DeleteRange, it keeps how many ranges it affects and
 // if the task was canceled or not.
@@ -33,6 +112,17 @@ type DeleteRangeTask struct {
 	ctx              context.Context
 	startKey         []byte
 	endKey           []byte
+
+	concurrency     int
+	rateLimit       DeleteRangeRateLimit
+	progressFn      func(DeleteRangeProgress)
+	checkpointStore DeleteRangeCheckpointStore
+	taskID          string
+
+	mu         sync.Mutex
+	finished   key.RangeSet
+	checkpoint []byte
+	done       bool
 }
 
 // NewDeleteRangeTask creates a DeleteRangeTask. Deleting will not be performed right away.
@@ -45,38 +135,142 @@ func NewDeleteRangeTask(ctx context.Context, store *TiKVStore, startKey []byte,
 		ctx:              ctx,
 		startKey:         startKey,
 		endKey:           endKey,
+		concurrency:      1,
 	}
 }
 
+// SetConcurrency sets how many regions are deleted at the same time.
+func (t *DeleteRangeTask) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	t.concurrency = concurrency
+}
+
+// SetRateLimit limits the speed of the task.
+func (t *DeleteRangeTask) SetRateLimit(limit DeleteRangeRateLimit) {
+	t.rateLimit = limit
+}
+
+// SetProgressCallback sets a function which is called each time a region is
+// finished. It is not called concurrently.
+func (t *DeleteRangeTask) SetProgressCallback(fn func(DeleteRangeProgress)) {
+	t.progressFn = fn
+}
+
+// SetCheckpointStore makes the task save its checkpoint with taskID as the
+// key. If a checkpoint of taskID exists when the task starts, keys before it
+// are not deleted again.
+func (t *DeleteRangeTask) SetCheckpointStore(store DeleteRangeCheckpointStore, taskID string) {
+	t.checkpointStore = store
+	t.taskID = taskID
+}
+
 // Execute performs the delete range operation.
 func (t *DeleteRangeTask) Execute() error {
-	conf := t.store.GetConfig()
+	r := key.Range{StartKey: t.startKey, EndKey: t.endKey}
+	if t.checkpointStore != nil {
+		checkpoint, finished, err := t.checkpointStore.LoadCheckpoint(t.taskID)
+		if err != nil {
+			return err
+		}
+		if finished || (len(checkpoint) > 0 && !r.Unbounded() && bytes.Equal(checkpoint, r.EndKey)) {
+			log.Infof("delete range task %s has finished", t.taskID)
+			return nil
+		}
+		if len(checkpoint) > 0 && r.Contains(checkpoint) {
+			log.Infof("delete range task %s resumes from %q", t.taskID, checkpoint)
+			r.StartKey = checkpoint
+		}
+	}
+	t.checkpoint = r.StartKey
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	limiter := newDeleteRangeLimiter(t.rateLimit)
+
+	// Split the range by regions, so that the regions can be deleted
+	// concurrently.
+	taskCh := make(chan key.Range, t.concurrency)
+	errCh := make(chan error, t.concurrency+1)
+	go func() {
+		defer close(taskCh)
+		errCh <- t.splitByRegion(ctx, r, taskCh)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < t.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for regionRange := range taskCh {
+				if err := t.deleteRange(ctx, regionRange, limiter); err != nil {
+					errCh <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
 
-	startKey, rangeEndKey := t.startKey, t.endKey
-	for {
+	var err error
+	for e := range errCh {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	if t.ctx.Err() != nil {
+		t.canceled = true
+		return nil
+	}
+	return err
+}
+
+// splitByRegion sends the parts of r in each region to ch.
+func (t *DeleteRangeTask) splitByRegion(ctx context.Context, r key.Range, ch chan<- key.Range) error {
+	bo := retry.NewBackofferWithConfig(ctx, &t.store.GetConfig().Retry, retry.OpDeleteRangeOneRegion)
+	for !r.IsEmpty() {
+		loc, err := t.store.GetRegionCache().LocateKey(bo, r.StartKey)
+		if err != nil {
+			return err
+		}
+		regionRange := r.Intersect(key.Range{StartKey: loc.StartKey, EndKey: loc.EndKey})
 		select {
-		case <-t.ctx.Done():
-			t.canceled = true
+		case ch <- regionRange:
+		case <-ctx.Done():
 			return nil
-		default:
 		}
-		bo := retry.NewBackoffer(t.ctx, retry.DeleteRangeOneRegionMaxBackoff)
-		loc, err := t.store.GetRegionCache().LocateKey(bo, startKey)
+		if regionRange.Unbounded() {
+			break
+		}
+		r.StartKey = regionRange.EndKey
+	}
+	return nil
+}
+
+// deleteRange deletes keys in r, which is expected to be in one region. If the
+// region has been split, it is deleted region by region.
+func (t *DeleteRangeTask) deleteRange(ctx context.Context, r key.Range, limiter *deleteRangeLimiter) error {
+	conf := t.store.GetConfig()
+	done := r
+	for !r.IsEmpty() {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+		bo := retry.NewBackofferWithConfig(ctx, &t.store.GetConfig().Retry, retry.OpDeleteRangeOneRegion)
+		loc, err := t.store.GetRegionCache().LocateKey(bo, r.StartKey)
 		if err != nil {
 			return err
 		}
 
 		// Delete to the end of the region, except if it's the last region overlapping the range
-		endKey := loc.EndKey
-		// If it is the last region
-		if loc.Contains(rangeEndKey) {
-			endKey = rangeEndKey
-		}
+		endKey := r.Intersect(key.Range{StartKey: loc.StartKey, EndKey: loc.EndKey}).EndKey
 
 		req := &rpc.Request{
 			Type: rpc.CmdDeleteRange,
 			DeleteRange: &kvrpcpb.DeleteRangeRequest{
-				StartKey: startKey,
+				StartKey: r.StartKey,
 				EndKey:   endKey,
 			},
 		}
@@ -103,13 +297,50 @@ func (t *DeleteRangeTask) Execute() error {
 		if err := deleteRangeResp.GetError(); err != "" {
 			return errors.Errorf("unexpected delete range err: %v", err)
 		}
-		t.completedRegions++
-		if bytes.Equal(endKey, rangeEndKey) {
+		if len(endKey) == 0 {
 			break
 		}
-		startKey = endKey
+		r.StartKey = endKey
+		if !r.IsEmpty() {
+			// The region has been split, count the finished part as a region.
+			if err := t.onRegionDone(key.Range{StartKey: done.StartKey, EndKey: endKey}); err != nil {
+				return err
+			}
+			done.StartKey = endKey
+		}
 	}
+	return t.onRegionDone(done)
+}
 
+// onRegionDone records the finished range, then saves the checkpoint and
+// reports the progress.
+func (t *DeleteRangeTask) onRegionDone(r key.Range) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.completedRegions++
+	t.finished = t.finished.Union(key.NewRangeSet(r))
+	// The checkpoint is the end of the finished ranges that start from the
+	// checkpoint, the ranges after a gap can not be skipped on resume. The
+	// task is done when they reach the end of the task range, which is the
+	// only way to record the progress of the last region of an unbounded
+	// range.
+	ranges := t.finished.Ranges()
+	if !t.done && ranges[0].Contains(t.checkpoint) {
+		t.checkpoint = ranges[0].EndKey
+		t.done = bytes.Equal(t.checkpoint, t.endKey)
+		if t.checkpointStore != nil {
+			if err := t.checkpointStore.SaveCheckpoint(t.taskID, t.checkpoint, t.done); err != nil {
+				return err
+			}
+		}
+	}
+	if t.progressFn != nil {
+		t.progressFn(DeleteRangeProgress{
+			CompletedRegions: t.completedRegions,
+			Checkpoint:       t.checkpoint,
+			Finished:         t.done,
+		})
+	}
 	return nil
 }
 
@@ -122,3 +353,53 @@ func (t *DeleteRangeTask) CompletedRegions() int {
 func (t *DeleteRangeTask) IsCanceled() bool {
 	return t.canceled
 }
+
+// deleteRangeLimiter spaces out the delete requests to satisfy a
+// DeleteRangeRateLimit.
+type deleteRangeLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newDeleteRangeLimiter(limit DeleteRangeRateLimit) *deleteRangeLimiter {
+	l := &deleteRangeLimiter{}
+	if limit.RegionsPerSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / limit.RegionsPerSecond)
+	}
+	if limit.BytesPerSecond > 0 {
+		regionSize := limit.EstimatedRegionSize
+		if regionSize <= 0 {
+			regionSize = DefaultEstimatedRegionSize
+		}
+		if interval := time.Duration(float64(regionSize) / limit.BytesPerSecond * float64(time.Second)); interval > l.interval {
+			l.interval = interval
+		}
+	}
+	return l
+}
+
+// wait blocks until the next request is allowed.
+func (l *deleteRangeLimiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
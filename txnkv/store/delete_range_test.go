@@ -0,0 +1,146 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/pingcap/check"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+)
+
+type testDeleteRangeSuite struct {
+	cluster   *mocktikv.Cluster
+	mvccStore mocktikv.MVCCStore
+	store     *TiKVStore
+}
+
+var _ = Suite(&testDeleteRangeSuite{})
+
+func (s *testDeleteRangeSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(s.cluster, []byte("b"), []byte("c"), []byte("d"), []byte("e"))
+	s.mvccStore = mocktikv.MustNewMVCCStore()
+	s.store = newTestStore(s.cluster, s.mvccStore, config.Default())
+
+	data := make(map[string]string)
+	for _, p := range []byte("abcdef") {
+		for i := 0; i < 5; i++ {
+			data[fmt.Sprintf("%c%d", p, i)] = "v"
+		}
+	}
+	mustCommit(c, s.store, s.mvccStore, data)
+}
+
+func (s *testDeleteRangeSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+}
+
+func (s *testDeleteRangeSuite) keys(c *C) []string {
+	ts, err := s.store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	var keys []string
+	err = s.store.GetSnapshot(ts).ParallelScan(context.Background(), nil, nil, 1, func(batch *ScanBatch) error {
+		for _, k := range batch.Keys {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return keys
+}
+
+func (s *testDeleteRangeSuite) TestDeleteRange(c *C) {
+	var progress []DeleteRangeProgress
+	task := NewDeleteRangeTask(context.Background(), s.store, []byte("b3"), []byte("e1"))
+	task.SetConcurrency(3)
+	task.SetRateLimit(DeleteRangeRateLimit{RegionsPerSecond: 1000})
+	task.SetProgressCallback(func(p DeleteRangeProgress) { progress = append(progress, p) })
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 4)
+	c.Assert(task.IsCanceled(), IsFalse)
+	c.Assert(progress, HasLen, 4)
+	c.Assert(progress[3].CompletedRegions, Equals, 4)
+	c.Assert(progress[3].Checkpoint, BytesEquals, []byte("e1"))
+	c.Assert(progress[3].Finished, IsTrue)
+	c.Assert(progress[2].Finished, IsFalse)
+
+	c.Assert(s.keys(c), DeepEquals, []string{
+		"a0", "a1", "a2", "a3", "a4", "b0", "b1", "b2",
+		"e1", "e2", "e3", "e4", "f0", "f1", "f2", "f3", "f4",
+	})
+
+	// Delete all keys with an unbounded range.
+	task = NewDeleteRangeTask(context.Background(), s.store, nil, nil)
+	task.SetConcurrency(2)
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 5)
+	c.Assert(s.keys(c), HasLen, 0)
+}
+
+func (s *testDeleteRangeSuite) TestResume(c *C) {
+	cpStore := NewDeleteRangeCheckpointStore(NewMockSafePointKV())
+	c.Assert(cpStore.SaveCheckpoint("task1", []byte("c"), false), IsNil)
+
+	task := NewDeleteRangeTask(context.Background(), s.store, []byte("a"), key.PrefixRange(key.Key("d")).EndKey)
+	task.SetCheckpointStore(cpStore, "task1")
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 2)
+	_, finished, err := cpStore.LoadCheckpoint("task1")
+	c.Assert(err, IsNil)
+	c.Assert(finished, IsTrue)
+	c.Assert(s.keys(c), HasLen, 20)
+
+	// The task has finished, nothing is deleted.
+	task = NewDeleteRangeTask(context.Background(), s.store, []byte("a"), []byte("e"))
+	task.SetCheckpointStore(cpStore, "task1")
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 0)
+	c.Assert(s.keys(c), HasLen, 20)
+}
+
+func (s *testDeleteRangeSuite) TestResumeUnbounded(c *C) {
+	cpStore := NewDeleteRangeCheckpointStore(NewMockSafePointKV())
+	c.Assert(cpStore.SaveCheckpoint("task1", []byte("d"), false), IsNil)
+
+	task := NewDeleteRangeTask(context.Background(), s.store, nil, nil)
+	task.SetCheckpointStore(cpStore, "task1")
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 2)
+	checkpoint, finished, err := cpStore.LoadCheckpoint("task1")
+	c.Assert(err, IsNil)
+	c.Assert(finished, IsTrue)
+	c.Assert(checkpoint, IsNil)
+	c.Assert(s.keys(c), HasLen, 15)
+
+	// The task has finished, the keys written after it are not deleted.
+	mustCommit(c, s.store, s.mvccStore, map[string]string{"g": "v"})
+	task = NewDeleteRangeTask(context.Background(), s.store, nil, nil)
+	task.SetCheckpointStore(cpStore, "task1")
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.CompletedRegions(), Equals, 0)
+	c.Assert(s.keys(c), HasLen, 16)
+}
+
+func (s *testDeleteRangeSuite) TestCancel(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task := NewDeleteRangeTask(ctx, s.store, nil, nil)
+	c.Assert(task.Execute(), IsNil)
+	c.Assert(task.IsCanceled(), IsTrue)
+	c.Assert(s.keys(c), HasLen, 30)
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/retry"
 )
 
 // TxnRetryableMark is used to direct user to restart a transaction.
@@ -27,9 +28,16 @@ import (
 // and ii) the error is not totally unexpected and hopefully will recover soon.
 const TxnRetryableMark = "[try again later]"
 
+// markTxnRetryable marks err as a retryable error of the transaction, in both
+// the message and the error classes.
+func markTxnRetryable(err error, classes ...error) error {
+	return retry.Classify(errors.WithMessage(err, TxnRetryableMark), append(classes, retry.ErrRetryable)...)
+}
+
 var (
-	// ErrResultUndetermined means that the commit status is unknown.
-	ErrResultUndetermined = errors.New("result undetermined")
+	// ErrResultUndetermined means that the commit status is unknown. It is
+	// the same error as retry.ErrUndetermined.
+	ErrResultUndetermined = retry.ErrUndetermined
 	// ErrNotImplemented returns when a function is not implemented yet.
 	ErrNotImplemented = errors.New("not implemented")
 	// ErrPDServerTimeout is the error that PD does not repond in time.
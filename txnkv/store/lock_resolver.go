@@ -32,7 +32,6 @@ import (
 // LockResolver resolves locks and also caches resolved txn status.
 type LockResolver struct {
 	store *TiKVStore
-	conf  *config.Config
 	mu    struct {
 		sync.RWMutex
 		// resolved caches resolved txns (FIFO, txn id -> txnStatus).
@@ -44,7 +43,6 @@ type LockResolver struct {
 func newLockResolver(store *TiKVStore) *LockResolver {
 	r := &LockResolver{
 		store: store,
-		conf:  store.GetConfig(),
 	}
 	r.mu.resolved = make(map[uint64]TxnStatus)
 	r.mu.recentResolved = list.New()
@@ -106,7 +104,7 @@ func (lr *LockResolver) saveResolved(txnID uint64, status TxnStatus) {
 	}
 	lr.mu.resolved[txnID] = status
 	lr.mu.recentResolved.PushBack(txnID)
-	if len(lr.mu.resolved) > lr.conf.Txn.ResolveCacheSize {
+	if len(lr.mu.resolved) > lr.store.GetConfig().Txn.ResolveCacheSize {
 		front := lr.mu.recentResolved.Front()
 		delete(lr.mu.resolved, front.Value.(uint64))
 		lr.mu.recentResolved.Remove(front)
@@ -173,7 +171,7 @@ func (lr *LockResolver) BatchResolveLocks(bo *retry.Backoffer, locks []*Lock, lo
 		},
 	}
 	startTime = time.Now()
-	resp, err := lr.store.SendReq(bo, req, loc, lr.conf.RPC.ReadTimeoutShort)
+	resp, err := lr.store.SendReq(bo, req, loc, lr.store.GetConfig().RPC.ReadTimeoutShort)
 	if err != nil {
 		return false, err
 	}
@@ -260,7 +258,7 @@ func (lr *LockResolver) ResolveLocks(bo *retry.Backoffer, locks []*Lock) (ok boo
 // To avoid unnecessarily aborting too many txns, it is wiser to wait a few
 // seconds before calling it after Prewrite.
 func (lr *LockResolver) GetTxnStatus(ctx context.Context, txnID uint64, primary []byte) (TxnStatus, error) {
-	bo := retry.NewBackoffer(ctx, retry.CleanupMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &lr.store.GetConfig().Retry, retry.OpCleanup)
 	return lr.getTxnStatus(bo, txnID, primary)
 }
 
@@ -284,7 +282,7 @@ func (lr *LockResolver) getTxnStatus(bo *retry.Backoffer, txnID uint64, primary
 		if err != nil {
 			return status, err
 		}
-		resp, err := lr.store.SendReq(bo, req, loc.Region, lr.conf.RPC.ReadTimeoutShort)
+		resp, err := lr.store.SendReq(bo, req, loc.Region, lr.store.GetConfig().RPC.ReadTimeoutShort)
 		if err != nil {
 			return status, err
 		}
@@ -338,7 +336,7 @@ func (lr *LockResolver) resolveLock(bo *retry.Backoffer, l *Lock, status TxnStat
 		if status.IsCommitted() {
 			req.ResolveLock.CommitVersion = status.CommitTS()
 		}
-		resp, err := lr.store.SendReq(bo, req, loc.Region, lr.conf.RPC.ReadTimeoutShort)
+		resp, err := lr.store.SendReq(bo, req, loc.Region, lr.store.GetConfig().RPC.ReadTimeoutShort)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,51 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"time"
+
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/txnkv/oracle"
+	"github.com/tikv/client-go/txnkv/oracle/oracles"
+)
+
+// NewMockStore creates a TiKVStore on top of a mocktikv cluster. It is used to
+// test the packages built on TiKVStore.
+func NewMockStore(cluster *mocktikv.Cluster, mvccStore mocktikv.MVCCStore, conf config.Config) *TiKVStore {
+	return NewMockStoreWithOracle(cluster, mvccStore, conf, oracles.NewLocalOracle())
+}
+
+// NewMockStoreWithOracle creates a TiKVStore on top of a mocktikv cluster,
+// which gets timestamps from the oracle, e.g. an HLCOracle for long-lived dev
+// environments. The oracle is closed when the store is closed.
+func NewMockStoreWithOracle(cluster *mocktikv.Cluster, mvccStore mocktikv.MVCCStore, conf config.Config, oracle oracle.Oracle) *TiKVStore {
+	pdClient := &locate.CodecPDClient{Client: mocktikv.NewPDClient(cluster)}
+	store := &TiKVStore{
+		oracle:      oracle,
+		client:      mocktikv.NewRPCClient(cluster, mvccStore),
+		pdClient:    pdClient,
+		regionCache: locate.NewRegionCache(pdClient, &conf.RegionCache),
+		spkv:        NewMockSafePointKV(),
+		spTime:      time.Now(),
+		closed:      make(chan struct{}),
+	}
+	store.conf.Store(&conf)
+	store.lockResolver = newLockResolver(store)
+	store.regionCache.SetRetryBudget(retry.NewRetryBudget(&conf.RPC.RetryBudget))
+	return store
+}
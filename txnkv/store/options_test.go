@@ -0,0 +1,111 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/rpc"
+)
+
+type testRequestOptionsSuite struct{}
+
+var _ = Suite(&testRequestOptionsSuite{})
+
+// contextRecorder records the contexts of the requests by command type.
+type contextRecorder struct {
+	mu       sync.Mutex
+	contexts map[rpc.CmdType][]pb.Context
+}
+
+func (r *contextRecorder) intercept(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration, next rpc.SendRequestFunc) (*rpc.Response, error) {
+	r.mu.Lock()
+	r.contexts[req.Type] = append(r.contexts[req.Type], req.Context)
+	r.mu.Unlock()
+	return next(ctx, addr, req, timeout)
+}
+
+func (r *contextRecorder) get(t rpc.CmdType) []pb.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.contexts[t]
+}
+
+func (s *testRequestOptionsSuite) TestRequestOptions(c *C) {
+	cluster := mocktikv.NewCluster()
+	_, _, regionID := mocktikv.BootstrapWithSingleStore(cluster)
+	// Split the keys into two regions, so the secondary key is committed in
+	// another request.
+	newRegionID, peerID := cluster.AllocID(), cluster.AllocID()
+	cluster.Split(regionID, newRegionID, []byte("b"), []uint64{peerID}, peerID)
+	store := newTestStore(cluster, mocktikv.MustNewMVCCStore(), config.Default())
+	defer store.Close()
+	recorder := &contextRecorder{contexts: make(map[rpc.CmdType][]pb.Context)}
+	store.client = rpc.Chain(store.client, rpc.NewUnaryInterceptor(recorder.intercept))
+
+	ctx := rpc.WithRequestOptions(context.Background(), rpc.RequestOptions{
+		Priority: pb.CommandPri_Low,
+		SyncLog:  true,
+		TaskID:   42,
+	})
+	startTS, err := store.GetOracle().GetTimestamp(ctx)
+	c.Assert(err, IsNil)
+	committer, err := NewTxnCommitter(store, startTS, time.Now(), map[string]*pb.Mutation{
+		"a": {Op: pb.Op_Put, Key: []byte("a"), Value: []byte("1")},
+		"b": {Op: pb.Op_Put, Key: []byte("b"), Value: []byte("2")},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(committer.Execute(ctx), IsNil)
+	// The secondary keys are committed in background with the same options.
+	for i := 0; i < 100 && len(recorder.get(rpc.CmdCommit)) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for t, n := range map[rpc.CmdType]int{rpc.CmdPrewrite: 2, rpc.CmdCommit: 2} {
+		contexts := recorder.get(t)
+		c.Assert(contexts, HasLen, n, Commentf("%s", t))
+		for _, reqCtx := range contexts {
+			c.Assert(reqCtx.Priority, Equals, pb.CommandPri_Low)
+			c.Assert(reqCtx.SyncLog, IsTrue)
+			c.Assert(reqCtx.TaskId, Equals, uint64(42))
+		}
+	}
+
+	// The options of the snapshot are kept unless they are set in the context.
+	ts, err := store.GetOracle().GetTimestamp(ctx)
+	c.Assert(err, IsNil)
+	snapshot := newTiKVSnapshot(store, ts)
+	snapshot.Priority = pb.CommandPri_High
+	ctx = rpc.WithRequestOptions(context.Background(), rpc.RequestOptions{NotFillCache: true, IsolationLevel: pb.IsolationLevel_RC})
+	v, err := snapshot.Get(ctx, key.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, BytesEquals, []byte("1"))
+	_, err = snapshot.BatchGet(ctx, []key.Key{key.Key("a"), key.Key("b")})
+	c.Assert(err, IsNil)
+	for t, n := range map[rpc.CmdType]int{rpc.CmdGet: 1, rpc.CmdBatchGet: 2} {
+		contexts := recorder.get(t)
+		c.Assert(contexts, HasLen, n, Commentf("%s", t))
+		for _, reqCtx := range contexts {
+			c.Assert(reqCtx.Priority, Equals, pb.CommandPri_High)
+			c.Assert(reqCtx.NotFillCache, IsTrue)
+			c.Assert(reqCtx.IsolationLevel, Equals, pb.IsolationLevel_RC)
+		}
+	}
+}
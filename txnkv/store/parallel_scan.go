@@ -0,0 +1,190 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/rpc"
+)
+
+// ScanBatch is a batch of key-value pairs returned by ParallelScan.
+type ScanBatch struct {
+	// RegionID is the region that the range [StartKey, EndKey) was assigned
+	// from when the scan started. The region may be split or merged during
+	// the scan, which does not affect the range.
+	RegionID uint64
+	StartKey key.Key
+	EndKey   key.Key
+
+	Keys   []key.Key
+	Values [][]byte
+
+	// RegionDone is true for the last batch of the range. It can be used to
+	// report progress, the batch itself may be empty.
+	RegionDone bool
+}
+
+// ScanBatchFunc is the callback of ParallelScan. It is called from multiple
+// goroutines concurrently, but the batches of the same range are delivered in
+// key order. Returning an error stops the whole scan.
+type ScanBatchFunc func(batch *ScanBatch) error
+
+// scanTask is the part of a ParallelScan range that belongs to a region.
+type scanTask struct {
+	regionID uint64
+	startKey key.Key
+	endKey   key.Key
+}
+
+// ParallelScan scans all key-value pairs in [startKey, endKey) with up to
+// `concurrency` regions being scanned at the same time. An empty endKey means
+// the range is unbounded. Unlike Iter, the pairs are not returned in order.
+func (s *TiKVSnapshot) ParallelScan(ctx context.Context, startKey, endKey key.Key, concurrency int, fn ScanBatchFunc) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	bo := retry.NewBackofferWithConfig(ctx, &s.conf.Retry, retry.OpCopBuildTask)
+	tasks, err := s.buildScanTasks(bo, startKey, endKey)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+	if concurrency > len(tasks) {
+		concurrency = len(tasks)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	taskCh := make(chan *scanTask, len(tasks))
+	for _, task := range tasks {
+		taskCh <- task
+	}
+	close(taskCh)
+
+	ch := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for task := range taskCh {
+				if e := s.scanTask(ctx, task, fn); e != nil {
+					// Report the error before canceling other workers, so that
+					// the first error is not shadowed by `context canceled`.
+					ch <- e
+					cancel()
+					return
+				}
+			}
+			ch <- nil
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		if e := <-ch; e != nil && err == nil {
+			log.Debugf("snapshot parallelScan failed: %v, tid: %d", e, s.ts)
+			err = e
+		}
+	}
+	return err
+}
+
+// buildScanTasks splits [startKey, endKey) by the regions it covers.
+func (s *TiKVSnapshot) buildScanTasks(bo *retry.Backoffer, startKey, endKey key.Key) ([]*scanTask, error) {
+	r := key.Range{StartKey: startKey, EndKey: endKey}
+	regionIDs, err := s.store.regionCache.ListRegionIDsInRange(bo, r)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*scanTask, 0, len(regionIDs))
+	for _, id := range regionIDs {
+		loc, err := s.store.regionCache.LocateRegionByID(bo, id)
+		if err != nil {
+			return nil, err
+		}
+		taskRange := r.Intersect(key.Range{StartKey: loc.StartKey, EndKey: loc.EndKey})
+		if taskRange.IsEmpty() {
+			continue
+		}
+		tasks = append(tasks, &scanTask{
+			regionID: id,
+			startKey: taskRange.StartKey,
+			endKey:   taskRange.EndKey,
+		})
+	}
+	return tasks, nil
+}
+
+// scanTask scans the range of a task batch by batch. The range is located again
+// for every batch, so region splits and merges during the scan are tolerated.
+func (s *TiKVSnapshot) scanTask(ctx context.Context, task *scanTask, fn ScanBatchFunc) error {
+	sender := rpc.NewRegionRequestSender(s.store.GetRegionCache(), s.store.GetRPCClient())
+	locator := s.store.GetRegionCache().NewRangeLocator(task.endKey)
+	batchSize := s.conf.Txn.ScanBatchSize
+	nextStartKey := task.startKey
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bo := retry.NewBackofferWithConfig(ctx, &s.conf.Retry, retry.OpScannerNext)
+		kvPairs, loc, err := s.scanRegion(bo, sender, locator, nextStartKey, task.endKey, batchSize)
+		if err != nil {
+			return err
+		}
+
+		batch := &ScanBatch{
+			RegionID: task.regionID,
+			StartKey: task.startKey,
+			EndKey:   task.endKey,
+			Keys:     make([]key.Key, 0, len(kvPairs)),
+			Values:   make([][]byte, 0, len(kvPairs)),
+		}
+		for _, pair := range kvPairs {
+			value := pair.GetValue()
+			// Resolve the lock the same way as Scanner does.
+			if pair.GetError() != nil {
+				value, err = s.get(bo, key.Key(pair.GetKey()))
+				if err != nil {
+					return err
+				}
+				if len(value) == 0 {
+					continue
+				}
+			}
+			batch.Keys = append(batch.Keys, pair.GetKey())
+			batch.Values = append(batch.Values, value)
+		}
+
+		if len(kvPairs) < batchSize {
+			// No more data in current region, continue with the next one.
+			nextStartKey = loc.EndKey
+			if len(loc.EndKey) == 0 || (len(task.endKey) > 0 && bytes.Compare(nextStartKey, task.endKey) >= 0) {
+				batch.RegionDone = true
+			}
+		} else {
+			nextStartKey = key.Key(kvPairs[len(kvPairs)-1].GetKey()).Next()
+		}
+
+		if err = fn(batch); err != nil {
+			return err
+		}
+		if batch.RegionDone {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	"github.com/tikv/client-go/txnkv/oracle"
+)
+
+type testParallelScanSuite struct {
+	cluster   *mocktikv.Cluster
+	mvccStore mocktikv.MVCCStore
+	store     *TiKVStore
+	data      map[string]string
+}
+
+var _ = Suite(&testParallelScanSuite{})
+
+func (s *testParallelScanSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(s.cluster, []byte("b"), []byte("c"), []byte("d"))
+	s.mvccStore = mocktikv.MustNewMVCCStore()
+	conf := config.Default()
+	conf.Txn.ScanBatchSize = 3
+	s.store = newTestStore(s.cluster, s.mvccStore, conf)
+
+	s.data = make(map[string]string)
+	for _, p := range []byte("abcde") {
+		for i := 0; i < 10; i++ {
+			s.data[fmt.Sprintf("%c%d", p, i)] = fmt.Sprintf("v%c%d", p, i)
+		}
+	}
+	mustCommit(c, s.store, s.mvccStore, s.data)
+}
+
+func (s *testParallelScanSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+}
+
+func (s *testParallelScanSuite) scan(c *C, startKey, endKey string, concurrency int) (map[string]string, map[uint64]int) {
+	ts, err := s.store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	var mu sync.Mutex
+	result := make(map[string]string)
+	regionDone := make(map[uint64]int)
+	var duplicated []string
+	err = s.store.GetSnapshot(ts).ParallelScan(context.Background(), key.Key(startKey), key.Key(endKey), concurrency, func(batch *ScanBatch) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, k := range batch.Keys {
+			if _, ok := result[string(k)]; ok {
+				duplicated = append(duplicated, string(k))
+			}
+			result[string(k)] = string(batch.Values[i])
+		}
+		if batch.RegionDone {
+			regionDone[batch.RegionID]++
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(duplicated, HasLen, 0)
+	return result, regionDone
+}
+
+func (s *testParallelScanSuite) expect(startKey, endKey string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range s.data {
+		if k >= startKey && (endKey == "" || k < endKey) {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (s *testParallelScanSuite) TestScan(c *C) {
+	for _, r := range [][2]string{{"", ""}, {"a5", "d2"}, {"b", "c"}, {"c3", ""}, {"e", "e\x00"}, {"f", ""}} {
+		for _, concurrency := range []int{1, 3, 10} {
+			result, regionDone := s.scan(c, r[0], r[1], concurrency)
+			c.Assert(result, DeepEquals, s.expect(r[0], r[1]), Commentf("range %q", r))
+			for _, cnt := range regionDone {
+				c.Assert(cnt, Equals, 1)
+			}
+		}
+	}
+	_, regionDone := s.scan(c, "", "", 2)
+	c.Assert(regionDone, HasLen, 4)
+}
+
+func (s *testParallelScanSuite) TestScanWithSplit(c *C) {
+	// Load regions into cache, then split them in the cluster so the scan
+	// tasks are built on stale regions.
+	bo := retry.NewBackoffer(context.Background(), 5000)
+	_, err := s.store.GetRegionCache().ListRegionIDsInKeyRange(bo, []byte(""), nil)
+	c.Assert(err, IsNil)
+	for _, splitKey := range []string{"a5", "b5", "e5"} {
+		region, _ := s.cluster.GetRegionByKey(mocktikv.NewMvccKey([]byte(splitKey)))
+		newRegionID, peerID := s.cluster.AllocID(), s.cluster.AllocID()
+		s.cluster.Split(region.GetId(), newRegionID, []byte(splitKey), []uint64{peerID}, peerID)
+	}
+
+	result, _ := s.scan(c, "", "", 4)
+	c.Assert(result, DeepEquals, s.expect("", ""))
+}
+
+func (s *testParallelScanSuite) TestScanResolveLock(c *C) {
+	// Leave an expired lock of an uncommitted txn.
+	startTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	errs := s.mvccStore.Prewrite([]*pb.Mutation{
+		{Op: pb.Op_Put, Key: []byte("c5a"), Value: []byte("locked")},
+		{Op: pb.Op_Put, Key: []byte("c5b"), Value: []byte("locked")},
+	}, []byte("c5a"), startTS, 1)
+	for _, err := range errs {
+		c.Assert(err, IsNil)
+	}
+
+	result, _ := s.scan(c, "c", "d", 2)
+	c.Assert(result, DeepEquals, s.expect("c", "d"))
+}
+
+func (s *testParallelScanSuite) TestScanError(c *C) {
+	ts, err := s.store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	errStop := errors.New("stop")
+	err = s.store.GetSnapshot(ts).ParallelScan(context.Background(), nil, nil, 2, func(batch *ScanBatch) error {
+		if len(batch.Keys) > 0 && batch.Keys[0][0] == 'c' {
+			return errStop
+		}
+		return nil
+	})
+	c.Assert(err, Equals, errStop)
+}
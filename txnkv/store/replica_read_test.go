@@ -0,0 +1,190 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/locate"
+	"github.com/tikv/client-go/metrics"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/rpc"
+	"github.com/tikv/client-go/txnkv/kv"
+)
+
+// replicaRecordClient records the store addresses that requests are sent to.
+// If rejectFollower is set, follower reads are rejected with NotLeader.
+type replicaRecordClient struct {
+	rpc.Client
+	leader         *metapb.Peer
+	leaderAddr     string
+	rejectFollower bool
+
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (c *replicaRecordClient) SendRequest(ctx context.Context, addr string, req *rpc.Request, timeout time.Duration) (*rpc.Response, error) {
+	c.mu.Lock()
+	c.addrs = append(c.addrs, addr)
+	c.mu.Unlock()
+	if c.rejectFollower && req.ReplicaRead && addr != c.leaderAddr {
+		return rpc.GenRegionErrorResp(req, &errorpb.Error{NotLeader: &errorpb.NotLeader{RegionId: req.RegionId, Leader: c.leader}})
+	}
+	return c.Client.SendRequest(ctx, addr, req, timeout)
+}
+
+func (c *replicaRecordClient) takeAddrs() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]int)
+	for _, addr := range c.addrs {
+		m[addr]++
+	}
+	c.addrs = nil
+	return m
+}
+
+type testReplicaReadSuite struct {
+	cluster  *mocktikv.Cluster
+	storeIDs []uint64
+	store    *TiKVStore
+	client   *replicaRecordClient
+}
+
+var _ = Suite(&testReplicaReadSuite{})
+
+func (s *testReplicaReadSuite) SetUpTest(c *C) {
+	cluster := mocktikv.NewCluster()
+	storeIDs, peerIDs, _, leaderPeer := mocktikv.BootstrapWithMultiStores(cluster, 3)
+	s.cluster, s.storeIDs = cluster, storeIDs
+	mvccStore := mocktikv.MustNewMVCCStore()
+	s.store = newTestStore(cluster, mvccStore, config.Default())
+	s.client = &replicaRecordClient{
+		Client:     s.store.client,
+		leader:     &metapb.Peer{Id: leaderPeer, StoreId: storeIDs[0]},
+		leaderAddr: cluster.GetStore(storeIDs[0]).GetAddress(),
+	}
+	c.Assert(peerIDs[0], Equals, leaderPeer)
+	s.store.client = s.client
+	mustCommit(c, s.store, mvccStore, map[string]string{"a": "1", "b": "2", "c": "3"})
+}
+
+func (s *testReplicaReadSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+}
+
+func (s *testReplicaReadSuite) newSnapshot(c *C, replicaRead kv.ReplicaReadType) *TiKVSnapshot {
+	ts, err := s.store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	snapshot := newTiKVSnapshot(s.store, ts)
+	snapshot.SetReplicaRead(replicaRead)
+	return snapshot
+}
+
+func (s *testReplicaReadSuite) mustRead(c *C, snapshot *TiKVSnapshot) {
+	for i := 0; i < 6; i++ {
+		v, err := snapshot.Get(context.Background(), key.Key("a"))
+		c.Assert(err, IsNil)
+		c.Assert(v, BytesEquals, []byte("1"))
+	}
+	m, err := snapshot.BatchGet(context.Background(), []key.Key{key.Key("b"), key.Key("c")})
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	it, err := snapshot.Iter(context.Background(), key.Key("a"), nil)
+	c.Assert(err, IsNil)
+	defer it.Close()
+	var n int
+	for ; it.Valid(); n++ {
+		c.Assert(it.Next(context.Background()), IsNil)
+	}
+	c.Assert(n, Equals, 3)
+}
+
+func (s *testReplicaReadSuite) TestFollowerRead(c *C) {
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadFollower))
+	addrs := s.client.takeAddrs()
+	c.Assert(addrs, HasLen, 2)
+	c.Assert(addrs[s.client.leaderAddr], Equals, 0)
+}
+
+func (s *testReplicaReadSuite) TestMixedRead(c *C) {
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadMixed))
+	c.Assert(s.client.takeAddrs(), HasLen, 3)
+
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadLeader))
+	addrs := s.client.takeAddrs()
+	c.Assert(addrs, HasLen, 1)
+	c.Assert(addrs[s.client.leaderAddr], Greater, 0)
+}
+
+func (s *testReplicaReadSuite) TestFallbackToLeader(c *C) {
+	s.client.rejectFollower = true
+	snapshot := s.newSnapshot(c, kv.ReplicaReadFollower)
+	v, err := snapshot.Get(context.Background(), key.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, BytesEquals, []byte("1"))
+
+	s.client.mu.Lock()
+	addrs := s.client.addrs
+	s.client.mu.Unlock()
+	c.Assert(addrs, HasLen, 2)
+	c.Assert(addrs[0], Not(Equals), s.client.leaderAddr)
+	c.Assert(addrs[1], Equals, s.client.leaderAddr)
+}
+
+func (s *testReplicaReadSuite) storeAddr(i int) string {
+	return s.cluster.GetStore(s.storeIDs[i]).GetAddress()
+}
+
+func (s *testReplicaReadSuite) TestLabelAwareRead(c *C) {
+	// The leader and a follower are in z1, the other follower is in z2.
+	for i, zone := range []string{"z1", "z1", "z2"} {
+		s.cluster.UpdateStoreLabels(s.storeIDs[i], map[string]string{"zone": zone})
+	}
+	s.store.GetConfig().RegionCache.Labels = map[string]string{"zone": "z2"}
+	local := metrics.ReplicaLocalityCounter.WithLabelValues(locate.LocalityLocal)
+	crossZone := metrics.ReplicaLocalityCounter.WithLabelValues(locate.LocalityCrossZone)
+	localCount, crossZoneCount := testutil.ToFloat64(local), testutil.ToFloat64(crossZone)
+
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadFollower))
+	c.Assert(s.client.takeAddrs(), DeepEquals, map[string]int{s.storeAddr(2): 8})
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadMixed))
+	c.Assert(s.client.takeAddrs(), DeepEquals, map[string]int{s.storeAddr(2): 8})
+	c.Assert(testutil.ToFloat64(local)-localCount, Equals, float64(16))
+
+	// Leader reads ignore the labels.
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadLeader))
+	c.Assert(s.client.takeAddrs(), DeepEquals, map[string]int{s.storeAddr(0): 8})
+	c.Assert(testutil.ToFloat64(crossZone)-crossZoneCount, Equals, float64(8))
+
+	s.store.GetConfig().RegionCache.Labels = map[string]string{"zone": "z1"}
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadFollower))
+	c.Assert(s.client.takeAddrs(), DeepEquals, map[string]int{s.storeAddr(1): 8})
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadMixed))
+	c.Assert(s.client.takeAddrs(), HasLen, 2)
+
+	// No replica matches, fall back to all the followers.
+	s.store.GetConfig().RegionCache.Labels = map[string]string{"zone": "z3"}
+	s.mustRead(c, s.newSnapshot(c, kv.ReplicaReadFollower))
+	c.Assert(s.client.takeAddrs(), HasLen, 2)
+}
@@ -22,6 +22,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/tikv/client-go/config"
 	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/locate"
 	"github.com/tikv/client-go/retry"
 	"github.com/tikv/client-go/rpc"
 	"github.com/tikv/client-go/txnkv/kv"
@@ -38,9 +39,10 @@ type Scanner struct {
 	nextStartKey []byte
 	endKey       []byte
 	eof          bool
+	locator      *locate.RangeLocator
 }
 
-func newScanner(ctx context.Context, snapshot *TiKVSnapshot, startKey []byte, endKey []byte, batchSize int) (*Scanner, error) {
+func newScanner(ctx context.Context, snapshot *TiKVSnapshot, r key.Range, batchSize int) (*Scanner, error) {
 	// It must be > 1. Otherwise scanner won't skipFirst.
 	if batchSize <= 1 {
 		batchSize = snapshot.conf.Txn.ScanBatchSize
@@ -50,8 +52,9 @@ func newScanner(ctx context.Context, snapshot *TiKVSnapshot, startKey []byte, en
 		conf:         snapshot.conf,
 		batchSize:    batchSize,
 		valid:        true,
-		nextStartKey: startKey,
-		endKey:       endKey,
+		nextStartKey: r.StartKey,
+		endKey:       r.EndKey,
+		locator:      snapshot.store.GetRegionCache().NewRangeLocator(r.EndKey),
 	}
 	err := scanner.Next(ctx)
 	if kv.IsErrNotFound(err) {
@@ -83,7 +86,7 @@ func (s *Scanner) Value() []byte {
 
 // Next return next element.
 func (s *Scanner) Next(ctx context.Context) error {
-	bo := retry.NewBackoffer(ctx, retry.ScannerNextMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &s.conf.Retry, retry.OpScannerNext)
 	if !s.valid {
 		return errors.New("scanner iterator is invalid")
 	}
@@ -152,13 +155,45 @@ func (s *Scanner) getData(bo *retry.Backoffer) error {
 	log.Debugf("txn getData nextStartKey[%q], txn %d", s.nextStartKey, s.startTS())
 	sender := rpc.NewRegionRequestSender(s.snapshot.store.GetRegionCache(), s.snapshot.store.GetRPCClient())
 
+	kvPairs, loc, err := s.snapshot.scanRegion(bo, sender, s.locator, s.nextStartKey, s.endKey, s.batchSize)
+	if err != nil {
+		return err
+	}
+
+	s.cache, s.idx = kvPairs, 0
+	if len(kvPairs) < s.batchSize {
+		// No more data in current Region. Next getData() starts
+		// from current Region's endKey.
+		s.nextStartKey = loc.EndKey
+		if len(loc.EndKey) == 0 || (len(s.endKey) > 0 && key.Key(s.nextStartKey).Cmp(key.Key(s.endKey)) >= 0) {
+			// Current Region is the last one.
+			s.eof = true
+		}
+		return nil
+	}
+	// next getData() starts from the last key in kvPairs (but skip
+	// it by appending a '\x00' to the key). Note that next getData()
+	// may get an empty response if the Region in fact does not have
+	// more data.
+	lastKey := kvPairs[len(kvPairs)-1].GetKey()
+	s.nextStartKey = key.Key(lastKey).Next()
+	return nil
+}
+
+// scanRegion sends one Scan request to the region that contains startKey, with
+// the range clipped to the region's end. It returns the scanned pairs together
+// with the region location, so the caller knows where to continue once the
+// region is drained. Pairs that hit a lock keep their KeyError, and their Key is
+// filled from the lock. The region is located by locator, which loads regions
+// in batch on a cold cache.
+func (s *TiKVSnapshot) scanRegion(bo *retry.Backoffer, sender *rpc.RegionRequestSender, locator *locate.RangeLocator, startKey, endKey []byte, limit int) ([]*pb.KvPair, *locate.KeyLocation, error) {
 	for {
-		loc, err := s.snapshot.store.regionCache.LocateKey(bo, s.nextStartKey)
+		loc, err := locator.LocateKey(bo, startKey)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		reqEndKey := s.endKey
+		reqEndKey := endKey
 		if len(reqEndKey) > 0 && len(loc.EndKey) > 0 && bytes.Compare(loc.EndKey, reqEndKey) < 0 {
 			reqEndKey = loc.EndKey
 		}
@@ -166,41 +201,44 @@ func (s *Scanner) getData(bo *retry.Backoffer) error {
 		req := &rpc.Request{
 			Type: rpc.CmdScan,
 			Scan: &pb.ScanRequest{
-				StartKey: s.nextStartKey,
+				StartKey: startKey,
 				EndKey:   reqEndKey,
-				Limit:    uint32(s.batchSize),
-				Version:  s.startTS(),
-				KeyOnly:  s.snapshot.KeyOnly,
+				Limit:    uint32(limit),
+				Version:  s.ts,
+				KeyOnly:  s.KeyOnly,
 			},
 			Context: pb.Context{
-				Priority:     s.snapshot.Priority,
-				NotFillCache: s.snapshot.NotFillCache,
+				Priority:       s.Priority,
+				IsolationLevel: s.IsolationLevel,
+				NotFillCache:   s.NotFillCache,
 			},
+			ReplicaReadType: s.ReplicaRead,
+			ReplicaReadSeed: s.nextReplicaReadSeed(),
 		}
 		resp, err := sender.SendReq(bo, req, loc.Region, s.conf.RPC.ReadTimeoutMedium)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		regionErr, err := resp.GetRegionError()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		if regionErr != nil {
 			log.Debugf("scanner getData failed: %s", regionErr)
 			err = bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 			continue
 		}
 		cmdScanResp := resp.Scan
 		if cmdScanResp == nil {
-			return errors.WithStack(rpc.ErrBodyMissing)
+			return nil, nil, errors.WithStack(rpc.ErrBodyMissing)
 		}
 
-		err = s.snapshot.store.CheckVisibility(s.startTS())
+		err = s.store.CheckVisibility(s.ts)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		kvPairs := cmdScanResp.Pairs
@@ -209,29 +247,11 @@ func (s *Scanner) getData(bo *retry.Backoffer) error {
 			if keyErr := pair.GetError(); keyErr != nil {
 				lock, err := extractLockFromKeyErr(keyErr, s.conf.Txn.DefaultLockTTL)
 				if err != nil {
-					return err
+					return nil, nil, err
 				}
 				pair.Key = lock.Key
 			}
 		}
-
-		s.cache, s.idx = kvPairs, 0
-		if len(kvPairs) < s.batchSize {
-			// No more data in current Region. Next getData() starts
-			// from current Region's endKey.
-			s.nextStartKey = loc.EndKey
-			if len(loc.EndKey) == 0 || (len(s.endKey) > 0 && key.Key(s.nextStartKey).Cmp(key.Key(s.endKey)) >= 0) {
-				// Current Region is the last one.
-				s.eof = true
-			}
-			return nil
-		}
-		// next getData() starts from the last key in kvPairs (but skip
-		// it by appending a '\x00' to the key). Note that next getData()
-		// may get an empty response if the Region in fact does not have
-		// more data.
-		lastKey := kvPairs[len(kvPairs)-1].GetKey()
-		s.nextStartKey = key.Key(lastKey).Next()
-		return nil
+		return kvPairs, loc, nil
 	}
 }
@@ -17,7 +17,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	pb "github.com/pingcap/kvproto/pkg/kvrpcpb"
@@ -37,20 +39,25 @@ type TiKVSnapshot struct {
 	ts    uint64
 	conf  *config.Config
 
-	Priority     pb.CommandPri
-	NotFillCache bool
-	SyncLog      bool
-	KeyOnly      bool
+	Priority       pb.CommandPri
+	IsolationLevel pb.IsolationLevel
+	NotFillCache   bool
+	SyncLog        bool
+	KeyOnly        bool
+	ReplicaRead    kv.ReplicaReadType
+
+	replicaReadSeed uint32
 }
 
 func newTiKVSnapshot(store *TiKVStore, ts uint64) *TiKVSnapshot {
 	metrics.SnapshotCounter.Inc()
 
 	return &TiKVSnapshot{
-		store:    store,
-		ts:       ts,
-		conf:     store.GetConfig(),
-		Priority: pb.CommandPri_Normal,
+		store:           store,
+		ts:              ts,
+		conf:            store.GetConfig(),
+		Priority:        pb.CommandPri_Normal,
+		replicaReadSeed: rand.Uint32(),
 	}
 }
 
@@ -64,7 +71,7 @@ func (s *TiKVSnapshot) BatchGet(ctx context.Context, keys []key.Key) (map[string
 
 	// We want [][]byte instead of []key.Key, use some magic to save memory.
 	bytesKeys := *(*[][]byte)(unsafe.Pointer(&keys))
-	bo := retry.NewBackoffer(ctx, retry.BatchGetMaxBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &s.conf.Retry, retry.OpBatchGet)
 
 	// Create a map to collect key-values from region servers.
 	var mu sync.Mutex
@@ -137,9 +144,12 @@ func (s *TiKVSnapshot) batchGetSingleRegion(bo *retry.Backoffer, batch batchKeys
 				Version: s.ts,
 			},
 			Context: pb.Context{
-				Priority:     s.Priority,
-				NotFillCache: s.NotFillCache,
+				Priority:       s.Priority,
+				IsolationLevel: s.IsolationLevel,
+				NotFillCache:   s.NotFillCache,
 			},
+			ReplicaReadType: s.ReplicaRead,
+			ReplicaReadSeed: s.nextReplicaReadSeed(),
 		}
 		resp, err := sender.SendReq(bo, req, batch.region, s.conf.RPC.ReadTimeoutMedium)
 		if err != nil {
@@ -197,7 +207,7 @@ func (s *TiKVSnapshot) batchGetSingleRegion(bo *retry.Backoffer, batch batchKeys
 
 // Get gets the value for key k from snapshot.
 func (s *TiKVSnapshot) Get(ctx context.Context, k key.Key) ([]byte, error) {
-	val, err := s.get(retry.NewBackoffer(ctx, retry.GetMaxBackoff), k)
+	val, err := s.get(retry.NewBackofferWithConfig(ctx, &s.conf.Retry, retry.OpGet), k)
 	if err != nil {
 		return nil, err
 	}
@@ -209,6 +219,7 @@ func (s *TiKVSnapshot) Get(ctx context.Context, k key.Key) ([]byte, error) {
 
 func (s *TiKVSnapshot) get(bo *retry.Backoffer, k key.Key) ([]byte, error) {
 	sender := rpc.NewRegionRequestSender(s.store.GetRegionCache(), s.store.GetRPCClient())
+	sender.SetHedgePolicy(s.store.hedge)
 
 	req := &rpc.Request{
 		Type: rpc.CmdGet,
@@ -217,9 +228,12 @@ func (s *TiKVSnapshot) get(bo *retry.Backoffer, k key.Key) ([]byte, error) {
 			Version: s.ts,
 		},
 		Context: pb.Context{
-			Priority:     s.Priority,
-			NotFillCache: s.NotFillCache,
+			Priority:       s.Priority,
+			IsolationLevel: s.IsolationLevel,
+			NotFillCache:   s.NotFillCache,
 		},
+		ReplicaReadType: s.ReplicaRead,
+		ReplicaReadSeed: s.nextReplicaReadSeed(),
 	}
 	for {
 		loc, err := s.store.regionCache.LocateKey(bo, k)
@@ -269,7 +283,12 @@ func (s *TiKVSnapshot) get(bo *retry.Backoffer, k key.Key) ([]byte, error) {
 
 // Iter returns a list of key-value pair after `k`.
 func (s *TiKVSnapshot) Iter(ctx context.Context, k key.Key, upperBound key.Key) (kv.Iterator, error) {
-	scanner, err := newScanner(ctx, s, k, upperBound, s.conf.Txn.ScanBatchSize)
+	return s.IterRange(ctx, key.Range{StartKey: k, EndKey: upperBound})
+}
+
+// IterRange returns a list of key-value pair in the range.
+func (s *TiKVSnapshot) IterRange(ctx context.Context, r key.Range) (kv.Iterator, error) {
+	scanner, err := newScanner(ctx, s, r, s.conf.Txn.ScanBatchSize)
 	return scanner, err
 }
 
@@ -283,18 +302,29 @@ func (s *TiKVSnapshot) SetPriority(priority int) {
 	s.Priority = pb.CommandPri(priority)
 }
 
+// SetReplicaRead sets the replica to read data from.
+func (s *TiKVSnapshot) SetReplicaRead(replicaRead kv.ReplicaReadType) {
+	s.ReplicaRead = replicaRead
+}
+
+// nextReplicaReadSeed returns a different seed for each request, so follower
+// reads are spread over the replicas in turn.
+func (s *TiKVSnapshot) nextReplicaReadSeed() uint32 {
+	return atomic.AddUint32(&s.replicaReadSeed, 1)
+}
+
 func extractLockFromKeyErr(keyErr *pb.KeyError, defaultTTL uint64) (*Lock, error) {
 	if locked := keyErr.GetLocked(); locked != nil {
 		return NewLock(locked, defaultTTL), nil
 	}
 	if keyErr.Conflict != nil {
 		err := errors.New(conflictToString(keyErr.Conflict))
-		return nil, errors.WithMessage(err, TxnRetryableMark)
+		return nil, markTxnRetryable(err, retry.ErrLockConflict)
 	}
 	if keyErr.Retryable != "" {
 		err := errors.Errorf("tikv restarts txn: %s", keyErr.GetRetryable())
 		log.Debug(err)
-		return nil, errors.WithMessage(err, TxnRetryableMark)
+		return nil, markTxnRetryable(err)
 	}
 	if keyErr.Abort != "" {
 		err := errors.Errorf("tikv aborts txn: %s", keyErr.GetAbort())
@@ -16,11 +16,14 @@ package store
 import (
 	"bytes"
 	"context"
+	"sort"
 
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/pdpb"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/locate"
 	"github.com/tikv/client-go/retry"
 	"github.com/tikv/client-go/rpc"
 )
@@ -29,7 +32,7 @@ import (
 // splitKey) and [splitKey, end).
 func SplitRegion(ctx context.Context, store *TiKVStore, splitKey key.Key) error {
 	log.Infof("start split_region at %q", splitKey)
-	bo := retry.NewBackoffer(ctx, retry.SplitRegionBackoff)
+	bo := retry.NewBackofferWithConfig(ctx, &store.GetConfig().Retry, retry.OpSplitRegion)
 	sender := rpc.NewRegionRequestSender(store.GetRegionCache(), store.GetRPCClient())
 	req := &rpc.Request{
 		Type: rpc.CmdSplitRegion,
@@ -67,3 +70,167 @@ func SplitRegion(ctx context.Context, store *TiKVStore, splitKey key.Key) error
 		return nil
 	}
 }
+
+// splitRegionBatchLimit is the max number of split keys sent in one
+// SplitRegion request.
+const splitRegionBatchLimit = 2048
+
+// SplitRegions splits the regions that contain the keys, so that each key
+// becomes the start key of a region. Keys that are already region boundaries
+// are skipped. If scatter is true, PD is asked to scatter the new regions, use
+// WaitScatterRegionsFinish to wait for it. It returns the IDs of the new
+// regions. The regions that are split before an error are returned with the
+// error, e.g. the regions that are split but fail to be scattered, so the
+// caller can wait for or retry scattering them.
+func SplitRegions(ctx context.Context, store *TiKVStore, keys [][]byte, scatter bool) ([]uint64, error) {
+	log.Infof("start split_regions at %d keys, scatter: %v", len(keys), scatter)
+	bo := retry.NewBackofferWithConfig(ctx, &store.GetConfig().Retry, retry.OpSplitRegion)
+	regionIDs, err := splitRegions(bo, store, keys, scatter)
+	if err != nil {
+		return regionIDs, err
+	}
+	log.Infof("split_regions complete, %d new regions", len(regionIDs))
+	return regionIDs, nil
+}
+
+func splitRegions(bo *retry.Backoffer, store *TiKVStore, keys [][]byte, scatter bool) ([]uint64, error) {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	groups := make(map[locate.RegionVerID][][]byte)
+	for i, k := range sorted {
+		if i > 0 && bytes.Equal(k, sorted[i-1]) {
+			continue
+		}
+		loc, err := store.GetRegionCache().LocateKey(bo, k)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(k, loc.StartKey) {
+			continue
+		}
+		groups[loc.Region] = append(groups[loc.Region], k)
+	}
+	var batches []batchKeys
+	for id, g := range groups {
+		batches = appendBatchBySize(batches, id, g, func([]byte) int { return 1 }, splitRegionBatchLimit)
+	}
+	if len(batches) == 0 {
+		return nil, nil
+	}
+
+	backoffer, cancel := bo.Fork()
+	defer cancel()
+	type splitResult struct {
+		regionIDs []uint64
+		err       error
+	}
+	ch := make(chan splitResult, len(batches))
+	for _, batch1 := range batches {
+		batch := batch1
+		go func() {
+			singleBatchBackoffer, singleBatchCancel := backoffer.Fork()
+			defer singleBatchCancel()
+			regionIDs, err := splitRegionBatch(singleBatchBackoffer, store, batch, scatter)
+			ch <- splitResult{regionIDs: regionIDs, err: err}
+		}()
+	}
+	var (
+		regionIDs []uint64
+		err       error
+	)
+	for i := 0; i < len(batches); i++ {
+		res := <-ch
+		regionIDs = append(regionIDs, res.regionIDs...)
+		if res.err != nil {
+			log.Debugf("split_regions batch failed: %v", res.err)
+			cancel()
+			if err == nil {
+				err = res.err
+			}
+		}
+	}
+	return regionIDs, err
+}
+
+func splitRegionBatch(bo *retry.Backoffer, store *TiKVStore, batch batchKeys, scatter bool) ([]uint64, error) {
+	sender := rpc.NewRegionRequestSender(store.GetRegionCache(), store.GetRPCClient())
+	req := &rpc.Request{
+		Type: rpc.CmdSplitRegion,
+		SplitRegion: &kvrpcpb.SplitRegionRequest{
+			SplitKeys: batch.keys,
+		},
+	}
+	req.Context.Priority = kvrpcpb.CommandPri_Normal
+	res, err := sender.SendReq(bo, req, batch.region, store.GetConfig().RPC.ReadTimeoutShort)
+	if err != nil {
+		return nil, err
+	}
+	regionErr, err := res.GetRegionError()
+	if err != nil {
+		return nil, err
+	}
+	if regionErr != nil {
+		err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
+		if err != nil {
+			return nil, err
+		}
+		// The region has changed, group the keys again.
+		return splitRegions(bo, store, batch.keys, scatter)
+	}
+
+	store.GetRegionCache().DropRegion(batch.region)
+
+	// One of the result regions keeps the ID of the original region, it is
+	// not a new region and does not need to be scattered.
+	var regionIDs []uint64
+	for _, r := range res.SplitRegion.GetRegions() {
+		if r.GetId() != batch.region.GetID() {
+			regionIDs = append(regionIDs, r.GetId())
+		}
+	}
+	log.Infof("split_region %d at %d keys complete, new regions: %v", batch.region.GetID(), len(batch.keys), regionIDs)
+	if scatter {
+		for _, id := range regionIDs {
+			if err := scatterRegion(bo, store, id); err != nil {
+				// The regions are split already, return them so that the
+				// caller can scatter them again.
+				return regionIDs, err
+			}
+		}
+	}
+	return regionIDs, nil
+}
+
+func scatterRegion(bo *retry.Backoffer, store *TiKVStore, regionID uint64) error {
+	for {
+		err := store.pdClient.ScatterRegion(bo.GetContext(), regionID)
+		if err == nil {
+			return nil
+		}
+		if err = bo.Backoff(retry.BoPDRPC, errors.Errorf("scatter region %d failed: %v", regionID, err)); err != nil {
+			return err
+		}
+	}
+}
+
+// WaitScatterRegionsFinish waits until PD finishes scattering the regions.
+func WaitScatterRegionsFinish(ctx context.Context, store *TiKVStore, regionIDs []uint64) error {
+	bo := retry.NewBackofferWithConfig(ctx, &store.GetConfig().Retry, retry.OpWaitScatterRegionFinish)
+	for _, regionID := range regionIDs {
+		for {
+			resp, err := store.pdClient.GetOperator(bo.GetContext(), regionID)
+			if err == nil {
+				if !bytes.Equal(resp.GetDesc(), []byte("scatter-region")) || resp.GetStatus() != pdpb.OperatorStatus_RUNNING {
+					break
+				}
+				err = errors.Errorf("region %d is still being scattered", regionID)
+			}
+			if err = bo.Backoff(retry.BoRegionMiss, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/retry"
+	pd "github.com/tikv/pd/client"
+)
+
+type testSplitRegionSuite struct {
+	cluster *mocktikv.Cluster
+	store   *TiKVStore
+}
+
+var _ = Suite(&testSplitRegionSuite{})
+
+func (s *testSplitRegionSuite) SetUpTest(c *C) {
+	s.cluster = mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(s.cluster, []byte("m"))
+	s.store = newTestStore(s.cluster, mocktikv.MustNewMVCCStore(), config.Default())
+}
+
+func (s *testSplitRegionSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+}
+
+func (s *testSplitRegionSuite) TestSplitRegions(c *C) {
+	var keys [][]byte
+	for i := 9; i >= 0; i-- {
+		keys = append(keys, []byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("a%d", i)))
+	}
+	// Duplicated keys and keys on region boundaries are skipped.
+	keys = append(keys, []byte("a5"), []byte("m"), []byte(""))
+
+	regionIDs, err := SplitRegions(context.Background(), s.store, keys, true)
+	c.Assert(err, IsNil)
+	c.Assert(regionIDs, HasLen, 20)
+	c.Assert(WaitScatterRegionsFinish(context.Background(), s.store, regionIDs), IsNil)
+
+	bo := retry.NewBackoffer(context.Background(), retry.SplitRegionBackoff)
+	for _, k := range keys[:20] {
+		loc, err := s.store.GetRegionCache().LocateKey(bo, k)
+		c.Assert(err, IsNil)
+		c.Assert(loc.StartKey, BytesEquals, k)
+	}
+	ids, err := s.store.GetRegionCache().ListRegionIDsInKeyRange(bo, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 22)
+
+	// Split again at the same keys is a no-op.
+	regionIDs, err = SplitRegions(context.Background(), s.store, keys, false)
+	c.Assert(err, IsNil)
+	c.Assert(regionIDs, HasLen, 0)
+}
+
+// scatterFailPDClient fails to scatter the regions.
+type scatterFailPDClient struct {
+	pd.Client
+}
+
+func (c scatterFailPDClient) ScatterRegion(ctx context.Context, regionID uint64) error {
+	return errors.New("scatter failed")
+}
+
+func (s *testSplitRegionSuite) TestSplitRegionsScatterFailure(c *C) {
+	s.store.pdClient = scatterFailPDClient{Client: s.store.pdClient}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// The regions are split before scattering them fails, their IDs are
+	// returned with the error.
+	regionIDs, err := SplitRegions(ctx, s.store, [][]byte{[]byte("a"), []byte("b")}, true)
+	c.Assert(err, NotNil)
+	c.Assert(regionIDs, HasLen, 2)
+	for _, id := range regionIDs {
+		region, _ := s.cluster.GetRegion(id)
+		c.Assert(region, NotNil)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -35,13 +36,15 @@ import (
 
 // TiKVStore contains methods to interact with a TiKV cluster.
 type TiKVStore struct {
-	conf         *config.Config
+	conf         atomic.Value // *config.Config
+	confMu       sync.Mutex   // this is used to serialize the updates of conf
 	clusterID    uint64
 	uuid         string
 	oracle       oracle.Oracle
 	client       rpc.Client
 	pdClient     pd.Client
 	regionCache  *locate.RegionCache
+	hedge        *rpc.HedgePolicy
 	lockResolver *LockResolver
 	txnLatches   *latch.LatchesScheduler
 	etcdAddrs    []string
@@ -54,22 +57,28 @@ type TiKVStore struct {
 	closed    chan struct{} // this is used to nofity when the store is closed
 }
 
-// NewStore creates a TiKVStore instance.
-func NewStore(ctx context.Context, pdAddrs []string, conf config.Config) (*TiKVStore, error) {
-	pdCli, err := pd.NewClient(pdAddrs, pd.SecurityOption{
-		CAPath:   conf.RPC.Security.SSLCA,
-		CertPath: conf.RPC.Security.SSLCert,
-		KeyPath:  conf.RPC.Security.SSLKey,
-	})
+// NewStore creates a TiKVStore instance. The interceptors wrap the RPC client
+// of the store, the first one is the outermost.
+func NewStore(ctx context.Context, pdAddrs []string, conf config.Config, interceptors ...rpc.Interceptor) (*TiKVStore, error) {
+	return NewStoreWithOracle(ctx, pdAddrs, conf, nil, interceptors...)
+}
+
+// NewStoreWithOracle creates a TiKVStore instance which gets timestamps from
+// the oracle instead of PD. If the oracle is nil, the timestamps are got from
+// PD. The oracle is closed when the store is closed.
+func NewStoreWithOracle(ctx context.Context, pdAddrs []string, conf config.Config, oracle oracle.Oracle, interceptors ...rpc.Interceptor) (*TiKVStore, error) {
+	pdCli, err := locate.NewPDClient(pdAddrs, &conf.RPC.Security)
 	if err != nil {
 		return nil, err
 	}
 
 	pdClient := &locate.CodecPDClient{Client: pdCli}
 
-	oracle, err := oracles.NewPdOracle(pdCli, &conf.Txn)
-	if err != nil {
-		return nil, err
+	if oracle == nil {
+		oracle, err = oracles.NewPdOracle(pdCli, &conf.Txn)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	tlsConfig, err := conf.RPC.Security.ToTLSConfig()
@@ -85,13 +94,13 @@ func NewStore(ctx context.Context, pdAddrs []string, conf config.Config) (*TiKVS
 	clusterID := pdCli.GetClusterID(ctx)
 
 	store := &TiKVStore{
-		conf:        &conf,
 		clusterID:   clusterID,
 		uuid:        fmt.Sprintf("tikv-%d", clusterID),
 		oracle:      oracle,
-		client:      rpc.NewRPCClient(&conf.RPC),
+		client:      rpc.Chain(rpc.NewRPCClient(&conf.RPC), interceptors...),
 		pdClient:    pdClient,
 		regionCache: locate.NewRegionCache(pdClient, &conf.RegionCache),
+		hedge:       rpc.NewHedgePolicy(conf.RPC.Hedge),
 		etcdAddrs:   pdAddrs,
 		tlsConfig:   tlsConfig,
 		spkv:        spkv,
@@ -99,19 +108,46 @@ func NewStore(ctx context.Context, pdAddrs []string, conf config.Config) (*TiKVS
 		closed:      make(chan struct{}),
 	}
 
+	store.conf.Store(&conf)
 	store.lockResolver = newLockResolver(store)
+	store.regionCache.SetRetryBudget(retry.NewRetryBudget(&conf.RPC.RetryBudget))
+	store.regionCache.Warmup(ctx, &conf.Retry)
 
 	if conf.Txn.Latch.Enable {
 		store.txnLatches = latch.NewScheduler(&conf.Txn.Latch)
 	}
 
 	go store.runSafePointChecker()
+	go store.runStoreProber()
 	return store, nil
 }
 
+func (s *TiKVStore) runStoreProber() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.closed
+		cancel()
+	}()
+	s.regionCache.RunStoreProber(ctx, rpc.NewStoreProbeFunc(s.client, s.GetConfig().RPC.ReadTimeoutShort))
+}
+
 // GetConfig returns the store's configurations.
 func (s *TiKVStore) GetConfig() *config.Config {
-	return s.conf
+	return s.conf.Load().(*config.Config)
+}
+
+// UpdateConfig updates the fields of the store's configurations that can be
+// changed at runtime, see config.Config.Update. The operations started after
+// the update use the new values.
+func (s *TiKVStore) UpdateConfig(conf config.Config) error {
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+	updated, err := s.GetConfig().Update(conf)
+	if err != nil {
+		return err
+	}
+	s.conf.Store(&updated)
+	return nil
 }
 
 // GetLockResolver returns the lock resolver instance.
@@ -186,21 +222,21 @@ func (s *TiKVStore) GetTimestampWithRetry(bo *retry.Backoffer) (uint64, error) {
 }
 
 func (s *TiKVStore) runSafePointChecker() {
-	d := s.conf.Txn.GcSafePointUpdateInterval
+	d := s.GetConfig().Txn.GcSafePointUpdateInterval
 	for {
 		select {
 		case spCachedTime := <-time.After(d):
-			cachedSafePoint, err := loadSafePoint(s.spkv, s.conf.Txn.GcSavedSafePoint)
+			cachedSafePoint, err := loadSafePoint(s.spkv, s.GetConfig().Txn.GcSavedSafePoint)
 			if err == nil {
 				metrics.LoadSafepointCounter.WithLabelValues("ok").Inc()
 				s.spMutex.Lock()
 				s.safePoint, s.spTime = cachedSafePoint, spCachedTime
 				s.spMutex.Unlock()
-				d = s.conf.Txn.GcSafePointUpdateInterval
+				d = s.GetConfig().Txn.GcSafePointUpdateInterval
 			} else {
 				metrics.LoadSafepointCounter.WithLabelValues("fail").Inc()
 				log.Errorf("fail to load safepoint from pd: %v", err)
-				d = s.conf.Txn.GcSafePointQuickRepeatInterval
+				d = s.GetConfig().Txn.GcSafePointQuickRepeatInterval
 			}
 		case <-s.Closed():
 			return
@@ -217,7 +253,7 @@ func (s *TiKVStore) CheckVisibility(startTS uint64) error {
 	s.spMutex.RUnlock()
 	diff := time.Since(cachedTime)
 
-	if diff > (s.conf.Txn.GcSafePointCacheInterval - s.conf.Txn.GcCPUTimeInaccuracyBound) {
+	if diff > (s.GetConfig().Txn.GcSafePointCacheInterval - s.GetConfig().Txn.GcCPUTimeInaccuracyBound) {
 		return errors.WithStack(ErrPDServerTimeout)
 	}
 
@@ -0,0 +1,55 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+// newTestStore creates a TiKVStore on top of a mocktikv cluster.
+func newTestStore(cluster *mocktikv.Cluster, mvccStore mocktikv.MVCCStore, conf config.Config) *TiKVStore {
+	return NewMockStore(cluster, mvccStore, conf)
+}
+
+// mustCommit writes kvs to the mvcc store directly in one transaction. It does
+// not go through the committer, whose secondary keys are committed in
+// background.
+func mustCommit(c *C, store *TiKVStore, mvccStore mocktikv.MVCCStore, kvs map[string]string) {
+	startTS, err := store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	var (
+		mutations []*pb.Mutation
+		keys      [][]byte
+	)
+	for k, v := range kvs {
+		mutations = append(mutations, &pb.Mutation{Op: pb.Op_Put, Key: []byte(k), Value: []byte(v)})
+		keys = append(keys, []byte(k))
+	}
+	for _, err := range mvccStore.Prewrite(mutations, keys[0], startTS, 3000) {
+		c.Assert(err, IsNil)
+	}
+	commitTS, err := store.GetOracle().GetTimestamp(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(mvccStore.Commit(keys, startTS, commitTS), IsNil)
+}
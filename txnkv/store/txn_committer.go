@@ -204,10 +204,9 @@ func (c *TxnCommitter) doActionOnKeys(bo *retry.Backoffer, action commitAction,
 	}
 	if action == actionCommit {
 		// Commit secondary batches in background goroutine to reduce latency.
-		// The backoffer instance is created outside of the goroutine to avoid
-		// potencial data race in unit test since `CommitMaxBackoff` will be updated
-		// by test suites.
-		secondaryBo := retry.NewBackoffer(context.Background(), retry.CommitMaxBackoff)
+		// The backoffer is not canceled with the context of the caller, but it
+		// keeps the request options of it.
+		secondaryBo := retry.NewBackofferWithConfig(rpc.BackgroundWithRequestOptions(bo.GetContext()), &c.store.GetConfig().Retry, retry.OpCommit)
 		go func() {
 			e := c.doActionOnBatches(secondaryBo, action, batches)
 			if e != nil {
@@ -451,7 +450,7 @@ func (c *TxnCommitter) commitSingleBatch(bo *retry.Backoffer, batch batchKeys) e
 		}
 		// The transaction maybe rolled back by concurrent transactions.
 		log.Debugf("2PC failed commit primary key: %v, retry later, tid: %d", err, c.startTS)
-		return errors.WithMessage(err, TxnRetryableMark)
+		return markTxnRetryable(err)
 	}
 
 	c.mu.Lock()
@@ -520,7 +519,7 @@ func (c *TxnCommitter) Execute(ctx context.Context) error {
 		if !committed && !undetermined {
 			c.cleanWg.Add(1)
 			go func() {
-				err := c.cleanupKeys(retry.NewBackoffer(context.Background(), retry.CleanupMaxBackoff), c.keys)
+				err := c.cleanupKeys(retry.NewBackofferWithConfig(rpc.BackgroundWithRequestOptions(ctx), &c.store.GetConfig().Retry, retry.OpCleanup), c.keys)
 				if err != nil {
 					metrics.SecondaryLockCleanupFailureCounter.WithLabelValues("rollback").Inc()
 					log.Infof("con:%d 2PC cleanup err: %v, tid: %d", c.ConnID, err, c.startTS)
@@ -532,7 +531,7 @@ func (c *TxnCommitter) Execute(ctx context.Context) error {
 		}
 	}()
 
-	prewriteBo := retry.NewBackoffer(ctx, retry.PrewriteMaxBackoff)
+	prewriteBo := retry.NewBackofferWithConfig(ctx, &c.store.GetConfig().Retry, retry.OpPrewrite)
 	start := time.Now()
 	err := c.prewriteKeys(prewriteBo, c.keys)
 	c.detail.PrewriteTime = time.Since(start)
@@ -544,7 +543,7 @@ func (c *TxnCommitter) Execute(ctx context.Context) error {
 	}
 
 	start = time.Now()
-	commitTS, err := c.store.GetTimestampWithRetry(retry.NewBackoffer(ctx, retry.TsoMaxBackoff))
+	commitTS, err := c.store.GetTimestampWithRetry(retry.NewBackofferWithConfig(ctx, &c.store.GetConfig().Retry, retry.OpTso))
 	if err != nil {
 		log.Warnf("con:%d 2PC get commitTS failed: %v, tid: %d", c.ConnID, err, c.startTS)
 		return err
@@ -562,11 +561,11 @@ func (c *TxnCommitter) Execute(ctx context.Context) error {
 
 	if c.store.GetOracle().IsExpired(c.startTS, c.maxTxnTimeUse) {
 		err = errors.Errorf("con:%d txn takes too much time, start: %d, commit: %d", c.ConnID, c.startTS, c.commitTS)
-		return errors.WithMessage(err, TxnRetryableMark)
+		return markTxnRetryable(err)
 	}
 
 	start = time.Now()
-	commitBo := retry.NewBackoffer(ctx, retry.CommitMaxBackoff)
+	commitBo := retry.NewBackofferWithConfig(ctx, &c.store.GetConfig().Retry, retry.OpCommit)
 	err = c.commitKeys(commitBo, c.keys)
 	c.detail.CommitTime = time.Since(start)
 	c.detail.TotalBackoffTime += commitBo.TotalSleep()
@@ -23,6 +23,7 @@ import (
 	"github.com/prometheus/common/log"
 	"github.com/tikv/client-go/key"
 	"github.com/tikv/client-go/metrics"
+	"github.com/tikv/client-go/retry"
 	"github.com/tikv/client-go/txnkv/kv"
 	"github.com/tikv/client-go/txnkv/store"
 )
@@ -38,14 +39,13 @@ type Transaction struct {
 	commitTS  uint64
 	valid     bool
 	lockKeys  [][]byte
+	opts      txnOptions
 }
 
-func newTransaction(tikvStore *store.TiKVStore, ts uint64) *Transaction {
-	metrics.TxnCounter.Inc()
-
+func newTransaction(tikvStore *store.TiKVStore, ts uint64, opts ...TxnOption) (*Transaction, error) {
 	snapshot := tikvStore.GetSnapshot(ts)
 	us := kv.NewUnionStore(&tikvStore.GetConfig().Txn, snapshot)
-	return &Transaction{
+	txn := &Transaction{
 		tikvStore: tikvStore,
 		snapshot:  snapshot,
 		us:        us,
@@ -54,6 +54,42 @@ func newTransaction(tikvStore *store.TiKVStore, ts uint64) *Transaction {
 		startTime: time.Now(),
 		valid:     true,
 	}
+	if err := txn.setOptions(opts...); err != nil {
+		return nil, err
+	}
+	metrics.TxnCounter.Inc()
+	return txn, nil
+}
+
+// setOptions validates the options and applies them to the transaction. The
+// options are not changed if they are invalid.
+func (txn *Transaction) setOptions(opts ...TxnOption) error {
+	o := txn.opts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return err
+	}
+	txn.opts = o
+
+	txn.snapshot.Priority = o.priority
+	txn.snapshot.IsolationLevel = o.isolationLevel
+	txn.snapshot.NotFillCache = o.notFillCache
+	txn.snapshot.SyncLog = o.syncLog
+	txn.snapshot.KeyOnly = o.keyOnly
+	txn.snapshot.SetReplicaRead(o.replicaRead)
+	if o.presumeKeyNotExists {
+		txn.us.SetOption(kv.PresumeKeyNotExists, nil)
+	} else {
+		txn.us.DelOption(kv.PresumeKeyNotExists)
+	}
+	if o.presumeKeyErr != nil {
+		txn.us.SetOption(kv.PresumeKeyNotExistsError, o.presumeKeyErr)
+	} else {
+		txn.us.DelOption(kv.PresumeKeyNotExistsError)
+	}
+	return nil
 }
 
 // Get implements transaction interface.
@@ -115,6 +151,9 @@ func (txn *Transaction) BatchGet(ctx context.Context, keys []key.Key) (map[strin
 func (txn *Transaction) Set(k key.Key, v []byte) error {
 	start := time.Now()
 	defer func() { metrics.TxnCmdHistogram.WithLabelValues("set").Observe(time.Since(start).Seconds()) }()
+	if txn.opts.readOnly {
+		return errors.WithStack(ErrReadOnlyTxn)
+	}
 	return txn.us.Set(k, v)
 }
 
@@ -133,6 +172,12 @@ func (txn *Transaction) Iter(ctx context.Context, k key.Key, upperBound key.Key)
 	return txn.us.Iter(ctx, k, upperBound)
 }
 
+// IterRange creates an Iterator that yields the entries in the range.
+// The Iterator must be closed after use.
+func (txn *Transaction) IterRange(ctx context.Context, r key.Range) (kv.Iterator, error) {
+	return txn.Iter(ctx, r.StartKey, r.EndKey)
+}
+
 // IterReverse creates a reversed Iterator positioned on the first entry which key is less than k.
 func (txn *Transaction) IterReverse(ctx context.Context, k key.Key) (kv.Iterator, error) {
 	start := time.Now()
@@ -149,28 +194,36 @@ func (txn *Transaction) IsReadOnly() bool {
 func (txn *Transaction) Delete(k key.Key) error {
 	start := time.Now()
 	defer func() { metrics.TxnCmdHistogram.WithLabelValues("delete").Observe(time.Since(start).Seconds()) }()
+	if txn.opts.readOnly {
+		return errors.WithStack(ErrReadOnlyTxn)
+	}
 	return txn.us.Delete(k)
 }
 
 // SetOption sets an option with a value, when val is nil, uses the default
-// value of this option.
+// value of this option. The options with invalid values are ignored with a
+// warning.
+//
+// Deprecated: pass the TxnOptions to BeginWithOptions or
+// BeginWithTSAndOptions instead.
 func (txn *Transaction) SetOption(opt kv.Option, val interface{}) {
-	txn.us.SetOption(opt, val)
-	switch opt {
-	case kv.Priority:
-		txn.snapshot.SetPriority(val.(int))
-	case kv.NotFillCache:
-		txn.snapshot.NotFillCache = val.(bool)
-	case kv.SyncLog:
-		txn.snapshot.SyncLog = val.(bool)
-	case kv.KeyOnly:
-		txn.snapshot.KeyOnly = val.(bool)
+	o, err := kvOption(opt, val)
+	if err == nil {
+		err = txn.setOptions(o)
+	}
+	if err != nil {
+		log.Warnf("[kv] ignore option of txn %d: %v", txn.startTS, err)
 	}
 }
 
 // DelOption deletes an option.
+//
+// Deprecated: pass the TxnOptions to BeginWithOptions or
+// BeginWithTSAndOptions instead.
 func (txn *Transaction) DelOption(opt kv.Option) {
-	txn.us.DelOption(opt)
+	if err := txn.setOptions(kvOptionDefault(opt)); err != nil {
+		log.Warnf("[kv] ignore option of txn %d: %v", txn.startTS, err)
+	}
 }
 
 func (txn *Transaction) close() {
@@ -231,10 +284,12 @@ func (txn *Transaction) Commit(ctx context.Context) error {
 	if err != nil || committer == nil {
 		return err
 	}
+	committer.Priority = txn.opts.priority
+	committer.SyncLog = txn.opts.syncLog
 
 	// latches disabled
 	if txn.tikvStore.GetTxnLatches() == nil {
-		err = committer.Execute(ctx)
+		err = txn.presumedKeyErr(committer.Execute(ctx))
 		log.Debug("[kv]", txn.startTS, " txnLatches disabled, 2pc directly:", err)
 		return err
 	}
@@ -250,9 +305,10 @@ func (txn *Transaction) Commit(ctx context.Context) error {
 	defer txn.tikvStore.GetTxnLatches().UnLock(lock)
 	if lock.IsStale() {
 		err = errors.Errorf("startTS %d is stale", txn.startTS)
-		return errors.WithMessage(err, store.TxnRetryableMark)
+		// Another txn has committed the keys after startTS.
+		return retry.Classify(errors.WithMessage(err, store.TxnRetryableMark), retry.ErrRetryable, retry.ErrLockConflict)
 	}
-	err = committer.Execute(ctx)
+	err = txn.presumedKeyErr(committer.Execute(ctx))
 	if err == nil {
 		lock.SetCommitTS(committer.GetCommitTS())
 	}
@@ -260,6 +316,17 @@ func (txn *Transaction) Commit(ctx context.Context) error {
 	return err
 }
 
+// presumedKeyErr returns the error of the presumed not existing key if err
+// reports that it exists.
+func (txn *Transaction) presumedKeyErr(err error) error {
+	if e, ok := errors.Cause(err).(store.ErrKeyAlreadyExist); ok {
+		if c := txn.us.LookupConditionPair(key.Key(e)); c != nil && c.Err() != nil {
+			return c.Err()
+		}
+	}
+	return err
+}
+
 // Rollback undoes the transaction operations to KV store.
 func (txn *Transaction) Rollback() error {
 	if !txn.valid {
@@ -280,6 +347,9 @@ func (txn *Transaction) Rollback() error {
 func (txn *Transaction) LockKeys(keys ...key.Key) error {
 	start := time.Now()
 	defer func() { metrics.TxnCmdHistogram.WithLabelValues("lock_keys").Observe(time.Since(start).Seconds()) }()
+	if txn.opts.readOnly {
+		return errors.WithStack(ErrReadOnlyTxn)
+	}
 	for _, key := range keys {
 		txn.lockKeys = append(txn.lockKeys, key)
 	}
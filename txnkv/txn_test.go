@@ -0,0 +1,183 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package txnkv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/config"
+	"github.com/tikv/client-go/key"
+	"github.com/tikv/client-go/mockstore/mocktikv"
+	"github.com/tikv/client-go/txnkv/kv"
+	"github.com/tikv/client-go/txnkv/oracle"
+	"github.com/tikv/client-go/txnkv/oracle/oracles"
+	"github.com/tikv/client-go/txnkv/store"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testTxnSuite struct {
+	client *Client
+}
+
+var _ = Suite(&testTxnSuite{})
+
+func (s *testTxnSuite) SetUpTest(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	s.client = &Client{tikvStore: store.NewMockStore(cluster, mocktikv.MustNewMVCCStore(), config.Default())}
+}
+
+func (s *testTxnSuite) TearDownTest(c *C) {
+	s.client.Close()
+}
+
+func (s *testTxnSuite) mustPut(c *C, k, v string) {
+	txn, err := s.client.Begin(context.TODO())
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set(key.Key(k), []byte(v)), IsNil)
+	c.Assert(txn.Commit(context.TODO()), IsNil)
+}
+
+func (s *testTxnSuite) TestInvalidOptions(c *C) {
+	for _, opts := range [][]TxnOption{
+		{WithPriority(kvrpcpb.CommandPri(10))},
+		{WithIsolationLevel(kvrpcpb.IsolationLevel(10))},
+		{WithReplicaRead(kv.ReplicaReadType(10))},
+		{WithReadOnly(), WithSyncLog()},
+		{WithReadOnly(), WithPresumeKeyNotExists(nil)},
+	} {
+		_, err := s.client.BeginWithOptions(context.TODO(), opts...)
+		c.Assert(err, NotNil)
+	}
+
+	txn, err := s.client.BeginWithOptions(context.TODO(), WithPriority(kvrpcpb.CommandPri_Low), WithNotFillCache())
+	c.Assert(err, IsNil)
+	c.Assert(txn.snapshot.Priority, Equals, kvrpcpb.CommandPri_Low)
+	c.Assert(txn.snapshot.NotFillCache, IsTrue)
+}
+
+func (s *testTxnSuite) TestReadOnly(c *C) {
+	s.mustPut(c, "a", "1")
+	ts, err := s.client.GetTS(context.TODO())
+	c.Assert(err, IsNil)
+	txn, err := s.client.BeginWithTSAndOptions(context.TODO(), ts, WithReadOnly())
+	c.Assert(err, IsNil)
+	v, err := txn.Get(context.TODO(), key.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, BytesEquals, []byte("1"))
+	c.Assert(errors.Cause(txn.Set(key.Key("a"), []byte("2"))), Equals, ErrReadOnlyTxn)
+	c.Assert(errors.Cause(txn.Delete(key.Key("a"))), Equals, ErrReadOnlyTxn)
+	c.Assert(errors.Cause(txn.LockKeys(key.Key("a"))), Equals, ErrReadOnlyTxn)
+	c.Assert(txn.Commit(context.TODO()), IsNil)
+}
+
+func (s *testTxnSuite) TestPresumeKeyNotExists(c *C) {
+	s.mustPut(c, "a", "1")
+	errDup := errors.New("duplicate entry")
+	txn, err := s.client.BeginWithOptions(context.TODO(), WithPresumeKeyNotExists(errDup))
+	c.Assert(err, IsNil)
+	_, err = txn.Get(context.TODO(), key.Key("a"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	c.Assert(txn.Set(key.Key("a"), []byte("2")), IsNil)
+	c.Assert(txn.Commit(context.TODO()), Equals, errDup)
+}
+
+func (s *testTxnSuite) TestSetOption(c *C) {
+	txn, err := s.client.Begin(context.TODO())
+	c.Assert(err, IsNil)
+	txn.SetOption(kv.Priority, int(kvrpcpb.CommandPri_High))
+	txn.SetOption(kv.KeyOnly, true)
+	c.Assert(txn.snapshot.Priority, Equals, kvrpcpb.CommandPri_High)
+	c.Assert(txn.snapshot.KeyOnly, IsTrue)
+
+	// The values of wrong types and the options without effect are ignored
+	// instead of panicking.
+	txn.SetOption(kv.Priority, "low")
+	txn.SetOption(kv.KeyOnly, 1)
+	txn.SetOption(kv.BinlogInfo, struct{}{})
+	c.Assert(txn.snapshot.Priority, Equals, kvrpcpb.CommandPri_High)
+	c.Assert(txn.snapshot.KeyOnly, IsTrue)
+
+	txn.DelOption(kv.Priority)
+	txn.SetOption(kv.KeyOnly, nil)
+	c.Assert(txn.snapshot.Priority, Equals, kvrpcpb.CommandPri_Normal)
+	c.Assert(txn.snapshot.KeyOnly, IsFalse)
+
+	// The isolation levels of kv are accepted.
+	txn.SetOption(kv.IsolationLevel, kv.RC)
+	c.Assert(txn.snapshot.IsolationLevel, Equals, kvrpcpb.IsolationLevel_RC)
+	txn.SetOption(kv.IsolationLevel, kv.IsoLevel(10))
+	c.Assert(txn.snapshot.IsolationLevel, Equals, kvrpcpb.IsolationLevel_RC)
+	txn.SetOption(kv.IsolationLevel, kv.SI)
+	c.Assert(txn.snapshot.IsolationLevel, Equals, kvrpcpb.IsolationLevel_SI)
+	txn.SetOption(kv.IsolationLevel, kvrpcpb.IsolationLevel_RC)
+	c.Assert(txn.snapshot.IsolationLevel, Equals, kvrpcpb.IsolationLevel_RC)
+	txn.DelOption(kv.IsolationLevel)
+	c.Assert(txn.snapshot.IsolationLevel, Equals, kvrpcpb.IsolationLevel_SI)
+}
+
+func (s *testTxnSuite) TestHLCOracle(c *C) {
+	dir, err := ioutil.TempDir("", "hlc")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	clock := oracles.NewFakeClock(now)
+	hlc, err := oracles.NewHLCOracle(filepath.Join(dir, "hlc"), clock)
+	c.Assert(err, IsNil)
+
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	client := &Client{tikvStore: store.NewMockStoreWithOracle(cluster, mocktikv.MustNewMVCCStore(), config.Default(), hlc)}
+	defer client.Close()
+
+	// The clock does not move, the transactions are ordered by the logical
+	// part of the timestamps.
+	var lastTS uint64
+	for _, v := range []string{"1", "2"} {
+		txn, err := client.Begin(context.TODO())
+		c.Assert(err, IsNil)
+		c.Assert(txn.Set(key.Key("a"), []byte(v)), IsNil)
+		c.Assert(txn.Commit(context.TODO()), IsNil)
+		c.Assert(oracle.ExtractPhysical(txn.startTS), Equals, oracle.GetPhysical(now))
+		c.Assert(txn.startTS, Greater, lastTS)
+		lastTS = txn.startTS
+	}
+	// The clock goes back, the timestamps keep ascending.
+	clock.Set(now.Add(-time.Hour))
+	txn, err := client.Begin(context.TODO())
+	c.Assert(err, IsNil)
+	c.Assert(txn.startTS, Greater, lastTS)
+	v, err := txn.Get(context.TODO(), key.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, BytesEquals, []byte("2"))
+	c.Assert(txn.Set(key.Key("a"), []byte("3")), IsNil)
+	c.Assert(txn.Commit(context.TODO()), IsNil)
+
+	txn, err = client.Begin(context.TODO())
+	c.Assert(err, IsNil)
+	v, err = txn.Get(context.TODO(), key.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, BytesEquals, []byte("3"))
+}